@@ -0,0 +1,101 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultPingStableAfter is the number of consecutive pongs before a tightened ping interval is relaxed, when none is
+// configured
+const defaultPingStableAfter = 5
+
+// pingState defines the thread-safe state of the adaptive ping interval
+type pingState struct {
+	lock     *sync.Mutex
+	interval time.Duration // The current ping interval
+	awaiting bool          // Whether the last ping is still waiting for its pong
+	stable   int           // The number of consecutive pongs since the interval last changed
+	missed   uint64        // The number of pings that never got a pong
+}
+
+// newPingState constructs a new ping state starting at the supplied interval
+func newPingState(interval time.Duration) *pingState {
+	return &pingState{
+		lock:     &sync.Mutex{},
+		interval: interval,
+	}
+}
+
+// reset forgets the outstanding ping when a new connection starts, since its pong will never arrive. The interval is
+// kept, so a degraded network is still watched closely after a reconnect
+func (p *pingState) reset() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.awaiting = false
+	p.stable = 0
+	return p.interval
+}
+
+// sent records a ping, halving the interval down to the minimum if the previous ping was never answered. A minimum of
+// zero keeps the interval fixed. Returns the interval until the next ping
+func (p *pingState) sent(minimum time.Duration) time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.awaiting {
+		p.missed++
+		p.stable = 0
+		if minimum > 0 && p.interval > minimum {
+			p.interval /= 2
+			if p.interval < minimum {
+				p.interval = minimum
+			}
+		}
+	}
+
+	p.awaiting = true
+	return p.interval
+}
+
+// ponged records a pong, doubling the interval back up to the maximum after enough consecutive pongs
+func (p *pingState) ponged(maximum time.Duration, stableAfter int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.awaiting {
+		return
+	}
+
+	p.awaiting = false
+	p.stable++
+	if p.stable >= stableAfter && p.interval < maximum {
+		p.interval *= 2
+		if p.interval > maximum {
+			p.interval = maximum
+		}
+		p.stable = 0
+	}
+}
+
+// snapshot gets the current interval and the number of missed pongs
+func (p *pingState) snapshot() (time.Duration, uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.interval, p.missed
+}
+
+// pongReceived records a pong from the peer, relaxing the ping interval once the connection has been stable for a while
+func (ws *Websocket) pongReceived() {
+	ws.pingState.ponged(ws.configuration.PingInterval, ws.configuration.getPingStableAfter())
+}
+
+// getPingStableAfter gets the number of consecutive pongs before a tightened ping interval is relaxed
+func (c *Configuration) getPingStableAfter() int {
+	if c.PingStableAfter > 0 {
+		return c.PingStableAfter
+	}
+
+	return defaultPingStableAfter
+}
@@ -0,0 +1,32 @@
+package gows
+
+// audit runs the configured outbound audit hook against a message, returning the (possibly annotated) message to send,
+// or the denial reason if it was denied
+func (ws *Websocket) audit(msg []byte) ([]byte, error) {
+	if ws.configuration.OutboundAudit == nil {
+		return msg, nil
+	}
+
+	approved, err := ws.configuration.OutboundAudit(msg)
+	if err != nil {
+		ws.configuration.Logger.Debug("Outbound message denied by audit hook:", err)
+		return nil, err
+	}
+
+	return approved, nil
+}
+
+// auditMessage runs a message built inside the websocket, such as a replayed subscription or a heartbeat, through the
+// audit hook before it's put on the send queue directly. Returns a copy carrying the approved payload, or false if it
+// was denied, in which case it's reported to the message dropped handler
+func (ws *Websocket) auditMessage(msg *message) (*message, bool) {
+	approved, err := ws.audit(msg.data)
+	if err != nil {
+		ws.dropMessage(msg.data, err)
+		return nil, false
+	}
+
+	audited := *msg
+	audited.data = approved
+	return &audited, true
+}
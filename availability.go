@@ -0,0 +1,153 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// interval defines a span of time spent either connected or disconnected
+type interval struct {
+	start     time.Time
+	end       time.Time
+	connected bool
+}
+
+// availability defines a thread-safe tracker of connected versus disconnected time
+type availability struct {
+	lock   *sync.Mutex
+	window time.Duration
+
+	started          bool
+	stopped          bool
+	connected        bool
+	since            time.Time
+	connectedTime    time.Duration
+	disconnectedTime time.Duration
+	intervals        []interval // Completed intervals overlapping the rolling window
+}
+
+// newAvailability constructs a new availability tracker with the supplied rolling window
+func newAvailability(window time.Duration) *availability {
+	return &availability{
+		lock:      &sync.Mutex{},
+		window:    window,
+		intervals: make([]interval, 0),
+	}
+}
+
+// mark records a change in connectivity, starting the tracker on the first call
+func (a *availability) mark(connected bool, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// The first mark starts the clock
+	if !a.started || a.stopped {
+		a.started = true
+		a.stopped = false
+		a.connected = connected
+		a.since = now
+		return
+	}
+
+	if connected == a.connected {
+		return
+	}
+
+	a.close(now)
+	a.connected = connected
+	a.since = now
+}
+
+// stop stops the clock, so a permanently closed websocket doesn't accumulate downtime
+func (a *availability) stop(now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !a.started || a.stopped {
+		return
+	}
+
+	a.close(now)
+	a.stopped = true
+}
+
+// close completes the current interval, adding it to the totals and the rolling window
+func (a *availability) close(now time.Time) {
+	elapsed := now.Sub(a.since)
+	if a.connected {
+		a.connectedTime += elapsed
+	} else {
+		a.disconnectedTime += elapsed
+	}
+
+	if a.window > 0 {
+		a.intervals = append(a.intervals, interval{start: a.since, end: now, connected: a.connected})
+		a.trim(now)
+	}
+}
+
+// trim drops intervals that ended before the rolling window
+func (a *availability) trim(now time.Time) {
+	cutoff := now.Add(-a.window)
+	for len(a.intervals) > 0 && a.intervals[0].end.Before(cutoff) {
+		a.intervals = a.intervals[1:]
+	}
+}
+
+// snapshot fills in the availability figures of a stats snapshot
+func (a *availability) snapshot(stats *Stats, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stats.ConnectedTime = a.connectedTime
+	stats.DisconnectedTime = a.disconnectedTime
+
+	// Include the interval in progress
+	if a.started && !a.stopped {
+		if a.connected {
+			stats.ConnectedTime += now.Sub(a.since)
+		} else {
+			stats.DisconnectedTime += now.Sub(a.since)
+		}
+	}
+	stats.Availability = ratio(stats.ConnectedTime, stats.DisconnectedTime)
+
+	if a.window <= 0 {
+		return
+	}
+
+	// Sum up the parts of each interval that fall inside the rolling window
+	cutoff := now.Add(-a.window)
+	var connected, disconnected time.Duration
+	add := func(start time.Time, end time.Time, wasConnected bool) {
+		if start.Before(cutoff) {
+			start = cutoff
+		}
+		if !end.After(start) {
+			return
+		}
+		if wasConnected {
+			connected += end.Sub(start)
+		} else {
+			disconnected += end.Sub(start)
+		}
+	}
+
+	for _, i := range a.intervals {
+		add(i.start, i.end, i.connected)
+	}
+	if a.started && !a.stopped {
+		add(a.since, now, a.connected)
+	}
+	stats.WindowAvailability = ratio(connected, disconnected)
+}
+
+// ratio computes the fraction of time spent connected, treating no time at all as fully available
+func ratio(connected time.Duration, disconnected time.Duration) float64 {
+	total := connected + disconnected
+	if total == 0 {
+		return 1
+	}
+
+	return float64(connected) / float64(total)
+}
@@ -0,0 +1,118 @@
+package gows
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffStrategy defines how long the reviver waits between connection attempts. Next is called with the number of
+// consecutive failed attempts so far, and Reset is called once a connection is considered healthy again
+type BackoffStrategy interface {
+	Next(attempt int) time.Duration
+	Reset()
+}
+
+// ExponentialBackoff defines a backoff that grows by a constant factor on every attempt, optionally randomized. This is
+// the default strategy, built from the ConnectionRetry* configuration fields when no strategy is supplied
+type ExponentialBackoff struct {
+	Min       time.Duration // The delay before the first retry
+	Max       time.Duration // The maximum delay
+	Factor    float64       // The factor the delay grows by on every attempt
+	Randomize bool          // Whether to multiply the delay by a random factor between 1 and 2
+}
+
+// Next computes the delay for the supplied attempt
+func (b *ExponentialBackoff) Next(attempt int) time.Duration {
+	random := float64(1)
+	if b.Randomize {
+		random = rand.Float64() + 1
+	}
+	min := float64(b.Min)
+	max := float64(b.Max)
+	retryInterval := int64(math.Min(random*min*math.Pow(b.Factor, float64(attempt)), max))
+
+	return time.Duration(retryInterval)
+}
+
+// Reset does nothing, the exponential backoff is stateless
+func (b *ExponentialBackoff) Reset() {}
+
+// ConstantBackoff defines a backoff that always waits the same amount of time
+type ConstantBackoff struct {
+	Delay time.Duration // The delay between attempts
+}
+
+// Next returns the constant delay
+func (b *ConstantBackoff) Next(int) time.Duration {
+	return b.Delay
+}
+
+// Reset does nothing, the constant backoff is stateless
+func (b *ConstantBackoff) Reset() {}
+
+// FibonacciBackoff defines a backoff that grows along the Fibonacci sequence (1, 1, 2, 3, 5, ...) in multiples of a
+// unit delay
+type FibonacciBackoff struct {
+	Unit time.Duration // The delay multiplied by the Fibonacci number for the attempt
+	Max  time.Duration // The maximum delay
+}
+
+// Next computes the delay for the supplied attempt
+func (b *FibonacciBackoff) Next(attempt int) time.Duration {
+	previous, current := time.Duration(0), b.Unit
+	for i := 0; i < attempt && current < b.Max; i++ {
+		previous, current = current, previous+current
+	}
+
+	if current > b.Max {
+		return b.Max
+	}
+	return current
+}
+
+// Reset does nothing, the Fibonacci backoff is stateless
+func (b *FibonacciBackoff) Reset() {}
+
+// DecorrelatedJitterBackoff defines a backoff that picks a random delay between the base delay and three times the
+// previous delay, spreading out reconnect storms from many clients
+type DecorrelatedJitterBackoff struct {
+	base     time.Duration
+	max      time.Duration
+	previous time.Duration
+	lock     *sync.Mutex
+}
+
+// NewDecorrelatedJitterBackoff constructs a new decorrelated jitter backoff
+func NewDecorrelatedJitterBackoff(base time.Duration, max time.Duration) *DecorrelatedJitterBackoff {
+	return &DecorrelatedJitterBackoff{
+		base:     base,
+		max:      max,
+		previous: base,
+		lock:     &sync.Mutex{},
+	}
+}
+
+// Next computes the next delay from the previous one
+func (b *DecorrelatedJitterBackoff) Next(int) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	upper := 3 * b.previous
+	delay := b.base + time.Duration(rand.Int63n(int64(upper-b.base)+1))
+	if delay > b.max {
+		delay = b.max
+	}
+
+	b.previous = delay
+	return delay
+}
+
+// Reset starts the delays over from the base delay
+func (b *DecorrelatedJitterBackoff) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.previous = b.base
+}
@@ -0,0 +1,61 @@
+package gows
+
+import (
+	"context"
+	"errors"
+)
+
+// Barrier sends a barrier marker built by the configured marker builder and waits for the server to echo it back. Since
+// the server processes messages in order, the echo guarantees that every message sent before the barrier was
+// processed, which is useful in tests and migrations. The marker is queued at normal priority, so it keeps its place
+// behind the normal and high priority messages sent before it, and isn't held back by later ones. Low priority
+// messages still waiting in the queue aren't covered. The barrier is abandoned when the context is cancelled
+func (ws *Websocket) Barrier(ctx context.Context) error {
+	if ws.configuration.BarrierMarker == nil || ws.configuration.BarrierMatcher == nil {
+		return errors.New("barriers are not configured")
+	}
+
+	// Register the barrier before sending, so a fast echo can't beat us to the registry
+	id, echoChannel := ws.barriers.register()
+	marker, err := ws.configuration.BarrierMarker(id)
+	if err != nil {
+		ws.barriers.unregister(id)
+		return err
+	}
+
+	// Queue the marker at normal priority, so it keeps its FIFO position among the writes it's fencing. In the lowest
+	// priority class, steady normal traffic could hold it back indefinitely
+	ws.configuration.Logger.Trace("Sending barrier", id)
+	err = ws.sendMessage(ws.configuration.getDefaultMessageType(), marker, func(queued *message) {
+		queued.priority = PriorityNormal
+	})
+	if err != nil {
+		ws.barriers.unregister(id)
+		return err
+	}
+
+	select {
+	case <-echoChannel:
+		ws.configuration.Logger.Trace("Passed barrier", id)
+		return nil
+
+	case <-ctx.Done():
+		ws.configuration.Logger.Trace("Barrier", id, "abandoned:", ctx.Err())
+		ws.barriers.unregister(id)
+		return ctx.Err()
+	}
+}
+
+// checkBarrier attempts to match an inbound message to a pending barrier, returning true if it was consumed
+func (ws *Websocket) checkBarrier(msg []byte) bool {
+	if ws.configuration.BarrierMatcher == nil {
+		return false
+	}
+
+	id, ok := ws.configuration.BarrierMatcher(msg)
+	if !ok {
+		return false
+	}
+
+	return ws.barriers.resolve(id, msg)
+}
@@ -0,0 +1,52 @@
+package gows
+
+import "time"
+
+// defaultBatchingFlushInterval is how often the queue is flushed while adaptive batching is batching, when no interval
+// is configured
+const defaultBatchingFlushInterval = 10 * time.Millisecond
+
+// OnBatching sets the onBatching handler, called with the queue depth when adaptive batching switches from sending
+// immediately to batching, or back
+func (ws *Websocket) OnBatching(handler func(batching bool, depth int)) {
+	ws.batchingHandlerLock.Lock()
+	ws.batchingHandler = handler
+	ws.batchingHandlerLock.Unlock()
+}
+
+// updateBatching compares the send queue depth against the batching threshold, notifying the batching handler when
+// the mode changes. Returns true if the sender should batch
+func (ws *Websocket) updateBatching() bool {
+	depth := ws.sendQueue.length()
+	switch ws.batching.update(depth) {
+
+	case 1:
+		ws.configuration.Logger.Debug("SENDER: Send queue reached", depth, "messages, batching writes")
+		ws.batchingHandlerLock.Lock()
+		ws.batchingHandler(true, depth)
+		ws.batchingHandlerLock.Unlock()
+
+	case -1:
+		ws.configuration.Logger.Debug("SENDER: Send queue fell back to", depth, "messages, sending immediately")
+		ws.batchingHandlerLock.Lock()
+		ws.batchingHandler(false, depth)
+		ws.batchingHandlerLock.Unlock()
+	}
+
+	return ws.batching.reached()
+}
+
+// adaptiveBatching determines if the sender switches between sending immediately and batching. A fixed flush
+// interval takes precedence
+func (c *Configuration) adaptiveBatching() bool {
+	return c.BatchingThreshold > 0 && c.FlushInterval <= 0
+}
+
+// getBatchingFlushInterval gets how often the queue is flushed while adaptive batching is batching
+func (c *Configuration) getBatchingFlushInterval() time.Duration {
+	if c.BatchingFlushInterval > 0 {
+		return c.BatchingFlushInterval
+	}
+
+	return defaultBatchingFlushInterval
+}
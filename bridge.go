@@ -0,0 +1,214 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bridge defaults, applied when the corresponding configuration value isn't positive
+const (
+	defaultBridgeBatchSize     = 100
+	defaultBridgeFlushInterval = time.Second
+	defaultBridgeBufferSize    = 1000
+)
+
+// Sink defines a destination that inbound messages can be forwarded to, such as a message broker
+type Sink interface {
+	Publish(ctx context.Context, batch [][]byte) error
+}
+
+// SinkFunc adapts a plain function to the Sink interface
+type SinkFunc func(ctx context.Context, batch [][]byte) error
+
+// Publish publishes the batch
+func (f SinkFunc) Publish(ctx context.Context, batch [][]byte) error {
+	return f(ctx, batch)
+}
+
+// NATSSink constructs a sink that publishes every message in a batch to a NATS subject. The publish function has the
+// same signature as (*nats.Conn).Publish, so the method value can be passed directly
+func NATSSink(publish func(subject string, data []byte) error, subject string) Sink {
+	return SinkFunc(func(_ context.Context, batch [][]byte) error {
+		for _, msg := range batch {
+			err := publish(subject, msg)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// KafkaSink constructs a sink that writes each batch to a Kafka topic with a single producer call. The write function
+// is expected to wrap the producer of choice, e.g. (*kafka.Writer).WriteMessages
+func KafkaSink(write func(ctx context.Context, topic string, values [][]byte) error, topic string) Sink {
+	return SinkFunc(func(ctx context.Context, batch [][]byte) error {
+		return write(ctx, topic, batch)
+	})
+}
+
+// BridgeConfiguration defines the options structure for a bridge. The batch size defaults to 100 messages, the flush
+// interval to a second, and the buffer to 1000 messages
+type BridgeConfiguration struct {
+	BatchSize      int           // The maximum number of messages to publish at once
+	FlushInterval  time.Duration // The maximum time a message waits before its batch is published
+	BufferSize     int           // The number of messages buffered before new ones are dropped
+	PublishTimeout time.Duration // The timeout for a single publish attempt
+	RetryAttempts  int           // The number of times a failed publish is retried before the batch is dropped
+	RetryInterval  time.Duration // The time to wait between publish retries
+}
+
+// Bridge defines a goroutine that forwards inbound websocket messages to a sink in batches
+type Bridge struct {
+	ws            *Websocket
+	sink          Sink
+	configuration *BridgeConfiguration
+
+	messageChannel chan []byte   // Channel of messages waiting to be batched
+	detach         func()        // Removes the bridge from the websocket's inbound listeners
+	stopChannel    chan struct{} // Channel closed when the bridge is stopped
+	doneChannel    chan struct{} // Channel closed when the bridge has flushed its last batch
+	stopOnce       *sync.Once    // Ensures the bridge is only stopped once
+}
+
+// Bridge starts forwarding inbound messages to the supplied sink. Messages are still delivered to the message handler
+func (ws *Websocket) Bridge(sink Sink, configuration *BridgeConfiguration) *Bridge {
+	if configuration == nil {
+		configuration = &BridgeConfiguration{}
+	}
+
+	bridge := &Bridge{
+		ws:             ws,
+		sink:           sink,
+		configuration:  configuration,
+		messageChannel: make(chan []byte, configuration.getBufferSize()),
+		stopChannel:    make(chan struct{}),
+		doneChannel:    make(chan struct{}),
+		stopOnce:       &sync.Once{},
+	}
+
+	bridge.detach = ws.listeners.add(bridge.offer)
+	go bridge.run()
+	return bridge
+}
+
+// Close stops forwarding messages, publishing whatever is already buffered before returning
+func (b *Bridge) Close() {
+	b.stopOnce.Do(func() {
+
+		// Detach from the websocket so the consumer stops handing us messages
+		b.detach()
+		close(b.stopChannel)
+	})
+	<-b.doneChannel
+}
+
+// offer hands an inbound message to the bridge, dropping it if the buffer is full
+func (b *Bridge) offer(msg []byte) {
+	select {
+	case b.messageChannel <- msg:
+	default:
+		b.ws.reportError(errors.New("bridge buffer is full, dropping inbound message"))
+	}
+}
+
+// run defines the goroutine responsible for batching messages and publishing them to the sink
+func (b *Bridge) run() {
+	defer close(b.doneChannel)
+
+	flushTicker := time.NewTicker(b.configuration.getFlushInterval())
+	defer flushTicker.Stop()
+
+	batch := make([][]byte, 0, b.configuration.getBatchSize())
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		b.publish(batch)
+		batch = make([][]byte, 0, b.configuration.getBatchSize())
+	}
+
+	for {
+		select {
+
+		// Stopped, drain whatever is buffered and publish it
+		case <-b.stopChannel:
+			for {
+				select {
+				case msg := <-b.messageChannel:
+					batch = append(batch, msg)
+					if len(batch) >= b.configuration.getBatchSize() {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+
+		case msg := <-b.messageChannel:
+			batch = append(batch, msg)
+			if len(batch) >= b.configuration.getBatchSize() {
+				flush()
+			}
+
+		case <-flushTicker.C:
+			flush()
+		}
+	}
+}
+
+// publish publishes a batch to the sink, retrying on failure and reporting the batch as lost if it never succeeds
+func (b *Bridge) publish(batch [][]byte) {
+	var err error
+	for attempt := 0; attempt <= b.configuration.RetryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(b.configuration.RetryInterval)
+		}
+
+		// Only apply a timeout if one is configured
+		ctx, cancel := context.Background(), func() {}
+		if b.configuration.PublishTimeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), b.configuration.PublishTimeout)
+		}
+		err = b.sink.Publish(ctx, batch)
+		cancel()
+
+		if err == nil {
+			return
+		}
+		b.ws.configuration.Logger.Debug("Failed to publish batch to sink:", err)
+	}
+
+	b.ws.reportError(fmt.Errorf("failed to forward %d inbound messages to sink: %w", len(batch), err))
+}
+
+// getBatchSize gets the maximum number of messages published at once
+func (c *BridgeConfiguration) getBatchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+
+	return defaultBridgeBatchSize
+}
+
+// getFlushInterval gets the maximum time a message waits before its batch is published
+func (c *BridgeConfiguration) getFlushInterval() time.Duration {
+	if c.FlushInterval > 0 {
+		return c.FlushInterval
+	}
+
+	return defaultBridgeFlushInterval
+}
+
+// getBufferSize gets the number of messages buffered before new ones are dropped
+func (c *BridgeConfiguration) getBufferSize() int {
+	if c.BufferSize > 0 {
+		return c.BufferSize
+	}
+
+	return defaultBridgeBufferSize
+}
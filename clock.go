@@ -0,0 +1,50 @@
+package gows
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock defines a source of the current time. Injecting a clock makes time-dependent behavior such as TTLs, idle
+// pruning, and statistics reproducible in simulations. Network deadlines and timers always use the system clock
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock defines the clock used when none is configured
+type systemClock struct{}
+
+// Now gets the current system time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// getClock gets the configured clock, falling back to the system clock
+func (c *Configuration) getClock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+
+	return systemClock{}
+}
+
+// now gets the current time from the configured clock
+func (ws *Websocket) now() time.Time {
+	return ws.configuration.getClock().Now()
+}
+
+// SequentialIDs constructs an ID generator that returns increasing decimal numbers, starting at 1. It's the default
+// generator for request correlation IDs, and is safe for concurrent use
+func SequentialIDs() func() string {
+	lock := &sync.Mutex{}
+	counter := uint64(0)
+
+	return func() string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		counter++
+		return strconv.FormatUint(counter, 10)
+	}
+}
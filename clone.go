@@ -0,0 +1,124 @@
+package gows
+
+// Clone constructs a new, unconnected websocket with a copy of this websocket's configuration, for fanning out to the
+// same endpoint with different credentials or query parameters. The configure function, if supplied, can adjust the
+// copy before the clone is built. The copy is shallow, so slices, maps, and shared objects such as the rate limiter
+// are shared with this websocket. When copyHandlers is set, the handlers set with the On* functions and the middleware
+// are copied as well. Topic handlers, subscriptions, listeners, and queued messages are never copied, and the clone's
+// send queue isn't persistent unless the configure function gives it storage of its own
+func (ws *Websocket) Clone(copyHandlers bool, configure func(*Configuration)) *Websocket {
+	configuration := *ws.configuration
+	configuration.dialer = nil
+	configuration.Queue = nil
+	if configure != nil {
+		configure(&configuration)
+	}
+
+	clone := New(&configuration)
+	if copyHandlers {
+		ws.copyHandlers(clone)
+	}
+	return clone
+}
+
+// copyHandlers copies every handler and middleware to another websocket
+func (ws *Websocket) copyHandlers(clone *Websocket) {
+	ws.messageHandlerLock.Lock()
+	clone.messageHandler = ws.messageHandler
+	ws.messageHandlerLock.Unlock()
+
+	ws.connectedHandlerLock.Lock()
+	clone.connectedHandler = ws.connectedHandler
+	ws.connectedHandlerLock.Unlock()
+
+	ws.disconnectedHandlerLock.Lock()
+	clone.disconnectedHandler = ws.disconnectedHandler
+	ws.disconnectedHandlerLock.Unlock()
+
+	ws.messageDroppedHandlerLock.Lock()
+	clone.messageDroppedHandler = ws.messageDroppedHandler
+	ws.messageDroppedHandlerLock.Unlock()
+
+	ws.errorHandlerLock.Lock()
+	clone.errorHandler = ws.errorHandler
+	ws.errorHandlerLock.Unlock()
+
+	ws.replayHandlerLock.Lock()
+	clone.replayHandler = ws.replayHandler
+	ws.replayHandlerLock.Unlock()
+
+	ws.reconnectingHandlerLock.Lock()
+	clone.reconnectingHandler = ws.reconnectingHandler
+	ws.reconnectingHandlerLock.Unlock()
+
+	ws.reconnectedHandlerLock.Lock()
+	clone.reconnectedHandler = ws.reconnectedHandler
+	ws.reconnectedHandlerLock.Unlock()
+
+	ws.connectionEstablishedHandlerLock.Lock()
+	clone.connectionEstablishedHandler = ws.connectionEstablishedHandler
+	ws.connectionEstablishedHandlerLock.Unlock()
+
+	ws.stateChangeHandlerLock.Lock()
+	clone.stateChangeHandler = ws.stateChangeHandler
+	ws.stateChangeHandlerLock.Unlock()
+
+	ws.disconnectedWithReasonHandlerLock.Lock()
+	clone.disconnectedWithReasonHandler = ws.disconnectedWithReasonHandler
+	ws.disconnectedWithReasonHandlerLock.Unlock()
+
+	ws.queueHighWatermarkHandlerLock.Lock()
+	clone.queueHighWatermarkHandler = ws.queueHighWatermarkHandler
+	ws.queueHighWatermarkHandlerLock.Unlock()
+
+	ws.queueLowWatermarkHandlerLock.Lock()
+	clone.queueLowWatermarkHandler = ws.queueLowWatermarkHandler
+	ws.queueLowWatermarkHandlerLock.Unlock()
+
+	ws.loginFailedHandlerLock.Lock()
+	clone.loginFailedHandler = ws.loginFailedHandler
+	ws.loginFailedHandlerLock.Unlock()
+
+	ws.messageStreamHandlerLock.Lock()
+	clone.messageStreamHandler = ws.messageStreamHandler
+	ws.messageStreamHandlerLock.Unlock()
+
+	ws.sessionResumedHandlerLock.Lock()
+	clone.sessionResumedHandler = ws.sessionResumedHandler
+	ws.sessionResumedHandlerLock.Unlock()
+
+	ws.sessionResetHandlerLock.Lock()
+	clone.sessionResetHandler = ws.sessionResetHandler
+	ws.sessionResetHandlerLock.Unlock()
+
+	ws.terminatedHandlerLock.Lock()
+	clone.terminatedHandler = ws.terminatedHandler
+	ws.terminatedHandlerLock.Unlock()
+
+	ws.deliveryHandlerLock.Lock()
+	clone.deliveryHandler = ws.deliveryHandler
+	ws.deliveryHandlerLock.Unlock()
+
+	ws.panicHandlerLock.Lock()
+	clone.panicHandler = ws.panicHandler
+	ws.panicHandlerLock.Unlock()
+
+	ws.fencedHandlerLock.Lock()
+	clone.fencedHandler = ws.fencedHandler
+	ws.fencedHandlerLock.Unlock()
+
+	ws.expiredHandlerLock.Lock()
+	clone.expiredHandler = ws.expiredHandler
+	ws.expiredHandlerLock.Unlock()
+
+	ws.suspendedHandlerLock.Lock()
+	clone.suspendedHandler = ws.suspendedHandler
+	ws.suspendedHandlerLock.Unlock()
+
+	ws.batchingHandlerLock.Lock()
+	clone.batchingHandler = ws.batchingHandler
+	ws.batchingHandlerLock.Unlock()
+
+	clone.inboundMiddleware.add(ws.inboundMiddleware.list()...)
+	clone.outboundMiddleware.add(ws.outboundMiddleware.list()...)
+}
@@ -0,0 +1,82 @@
+package gows
+
+// CloseAction defines what the reviver does after the connection is closed with a specific close code
+type CloseAction int
+
+const (
+	// CloseReconnect reconnects right away, carrying on with the backoff if the connection wasn't up for long
+	CloseReconnect CloseAction = iota
+
+	// CloseReconnectImmediately starts the backoff over and reconnects right away, e.g. after a 1001 (going away)
+	CloseReconnectImmediately
+
+	// CloseReconnectWithBackoff waits for the next backoff delay before the first reconnect attempt, e.g. after a 1013
+	// (try again later)
+	CloseReconnectWithBackoff
+
+	// CloseStopPermanently stops the websocket without reconnecting, e.g. after an application code meaning the
+	// credentials were revoked. It stays closed until Connect() is called again
+	CloseStopPermanently
+
+	// CloseCallback asks the configured CloseDecider which of the other actions to take
+	CloseCallback
+)
+
+// OnTerminated sets the onTerminated handler, called when the reviver stops for good instead of reconnecting because
+// of the close code, e.g. a terminal close code or a ShouldReconnect hook that returned false. It's called with the
+// close code and message sent by the peer, along with the error that caused the drop
+func (ws *Websocket) OnTerminated(handler func(code int, message string, err error)) {
+	ws.terminatedHandlerLock.Lock()
+	ws.terminatedHandler = handler
+	ws.terminatedHandlerLock.Unlock()
+}
+
+// callTerminatedHandler calls the terminated handler
+func (ws *Websocket) callTerminatedHandler(reason error) {
+	code, text := closeCode(reason)
+	ws.terminatedHandlerLock.Lock()
+	ws.terminatedHandler(code, text, reason)
+	ws.terminatedHandlerLock.Unlock()
+}
+
+// closeAction gets the action for the close code of the error that caused a connection to drop. Connections that
+// dropped without a close frame are looked up as an abnormal closure (1006). Terminal close codes and the reconnect
+// hook take precedence over the mapped actions
+func (ws *Websocket) closeAction(reason error) CloseAction {
+	code, text := closeCode(reason)
+
+	if ws.isTerminal(code, reason) {
+		return CloseStopPermanently
+	}
+
+	action, ok := ws.configuration.CloseActions[code]
+	if !ok {
+		return CloseReconnect
+	}
+
+	if action == CloseCallback {
+		if ws.configuration.CloseDecider == nil {
+			return CloseReconnect
+		}
+		action = ws.configuration.CloseDecider(code, text)
+	}
+
+	// The decider can't defer the decision again
+	if action == CloseCallback {
+		return CloseReconnect
+	}
+
+	return action
+}
+
+// isTerminal determines if a close code means the websocket shouldn't reconnect, either because it's one of the
+// terminal close codes, or because the reconnect hook said so
+func (ws *Websocket) isTerminal(code int, reason error) bool {
+	for _, terminal := range ws.configuration.TerminalCloseCodes {
+		if code == terminal {
+			return true
+		}
+	}
+
+	return ws.configuration.ShouldReconnect != nil && !ws.configuration.ShouldReconnect(code, reason)
+}
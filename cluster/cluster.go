@@ -0,0 +1,260 @@
+// Package cluster coordinates a single active gows connection across horizontally-scaled instances of a service. Each
+// instance runs an Elector against a shared lock backend, and only the instance currently holding the lock keeps the
+// upstream websocket connected. When the holder dies, its lease expires and another instance takes over.
+package cluster
+
+import (
+	"context"
+	"github.com/miratronix/gows"
+	"github.com/miratronix/logpher"
+	"sync"
+	"time"
+)
+
+// abandonPollInterval is how often an abandoned connect is told to stop until it returns
+const abandonPollInterval = 10 * time.Millisecond
+
+// Lock defines a leadership lock backend. Implementations must be safe for concurrent use, and must only allow a single
+// owner to hold a key at a time. Leases expire after the supplied TTL unless refreshed
+type Lock interface {
+	Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) // Attempts to take the lock
+	Refresh(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) // Extends a held lock
+	Release(ctx context.Context, key string, owner string) error                            // Gives up a held lock
+}
+
+// Configuration defines the options structure for the elector
+type Configuration struct {
+	Key             string                 // The lock key shared by all instances
+	Owner           string                 // The unique identity of this instance
+	TTL             time.Duration          // How long a lease lasts without being refreshed
+	RefreshInterval time.Duration          // How often the leader refreshes its lease. Should be well below the TTL
+	RetryInterval   time.Duration          // How often followers attempt to take over the lock
+	Logger          *logpher.Logger        // The logger for the elector
+	Connect         func() *gows.Websocket // Builds a fresh websocket whenever this instance becomes the leader
+	OnElected       func(*gows.Websocket)  // Called after this instance becomes the leader and connects
+	OnDemoted       func()                 // Called after this instance loses leadership and disconnects
+}
+
+// Elector defines a leader election loop that holds the upstream websocket while leading
+type Elector struct {
+	configuration *Configuration
+	lock          Lock
+
+	websocket     *gows.Websocket // The websocket, if this instance is the leader
+	websocketLock *sync.Mutex     // Lock for the websocket
+}
+
+// New constructs a new elector
+func New(lock Lock, configuration *Configuration) *Elector {
+	return &Elector{
+		configuration: configuration,
+		lock:          lock,
+		websocketLock: &sync.Mutex{},
+	}
+}
+
+// Run runs the election loop until the context is cancelled, releasing the lock and disconnecting on the way out. The
+// leader also steps down if its websocket stops for good, e.g. because it gave up reconnecting
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		leading := e.IsLeader()
+
+		// Try to take or keep the lock
+		var held bool
+		var err error
+		if leading {
+			held, err = e.lock.Refresh(ctx, e.configuration.Key, e.configuration.Owner, e.configuration.TTL)
+		} else {
+			held, err = e.lock.Acquire(ctx, e.configuration.Key, e.configuration.Owner, e.configuration.TTL)
+		}
+		if err != nil {
+			e.configuration.Logger.Warn("Leadership lock operation failed:", err)
+		}
+
+		// React to changes in leadership. A failed refresh means we can no longer be sure we hold the lock, so step down
+		switch {
+		case held && !leading:
+			e.promote(ctx)
+		case !held && leading:
+			e.demote()
+		}
+
+		// Sleep until the next lock operation. While leading, also watch the websocket: if it stops for good (it gave
+		// up reconnecting or was terminated), holding the lock would keep every other instance from connecting
+		interval := e.configuration.RetryInterval
+		var stopped <-chan struct{}
+		if ws := e.Websocket(); ws != nil {
+			interval = e.configuration.RefreshInterval
+			stopped = ws.Done()
+		}
+
+		select {
+		case <-ctx.Done():
+			e.stop()
+			return
+		case <-stopped:
+			e.abdicate(ctx)
+			if !sleep(ctx, e.configuration.RetryInterval) {
+				return
+			}
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sleep waits for the supplied interval, returning false if the context was cancelled first
+func sleep(ctx context.Context, interval time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(interval):
+		return true
+	}
+}
+
+// Websocket gets the websocket held by this instance, or nil if it's not the leader
+func (e *Elector) Websocket() *gows.Websocket {
+	e.websocketLock.Lock()
+	defer e.websocketLock.Unlock()
+
+	return e.websocket
+}
+
+// IsLeader determines if this instance currently holds the upstream websocket
+func (e *Elector) IsLeader() bool {
+	return e.Websocket() != nil
+}
+
+// promote connects a fresh websocket after this instance becomes the leader. Connecting can take a while with retries
+// and backoff, so the lease keeps being refreshed in the meantime, and the connect is abandoned if the lease is lost or
+// the context is cancelled. Otherwise, another instance could take over and connect upstream alongside this one
+func (e *Elector) promote(ctx context.Context) {
+	e.configuration.Logger.Info("Acquired leadership for", e.configuration.Key)
+
+	ws := e.configuration.Connect()
+	connected := make(chan error, 1)
+	go func() {
+		connected <- ws.Connect()
+	}()
+
+	refreshTicker := time.NewTicker(e.configuration.RefreshInterval)
+	defer refreshTicker.Stop()
+
+	for {
+		select {
+
+		// Connected, or gave up. If that fails, give the lock back so another instance can try. If it succeeded, make
+		// sure the lease is still ours before taking over
+		case err := <-connected:
+			if err != nil {
+				e.configuration.Logger.Warn("Failed to connect websocket after acquiring leadership:", err)
+				e.release(ctx)
+				return
+			}
+			if !e.refresh(ctx) {
+				e.configuration.Logger.Warn("Lost leadership for", e.configuration.Key, "while connecting, disconnecting")
+				ws.Disconnect()
+				return
+			}
+
+			e.websocketLock.Lock()
+			e.websocket = ws
+			e.websocketLock.Unlock()
+
+			if e.configuration.OnElected != nil {
+				e.configuration.OnElected(ws)
+			}
+			return
+
+		// Keep the lease while connecting, giving up on the connect if it's lost
+		case <-refreshTicker.C:
+			if !e.refresh(ctx) {
+				e.configuration.Logger.Warn("Lost leadership for", e.configuration.Key, "while connecting, giving up")
+				abandon(ws, connected)
+				return
+			}
+
+		// Stopped while connecting, give up on the connect and the lock. The run context is already cancelled, so give
+		// the release its own short deadline
+		case <-ctx.Done():
+			abandon(ws, connected)
+			releaseCtx, cancel := context.WithTimeout(context.Background(), e.configuration.RefreshInterval)
+			e.release(releaseCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// refresh extends the lease, returning false if it's no longer held or the refresh failed
+func (e *Elector) refresh(ctx context.Context) bool {
+	held, err := e.lock.Refresh(ctx, e.configuration.Key, e.configuration.Owner, e.configuration.TTL)
+	if err != nil {
+		e.configuration.Logger.Warn("Leadership lock operation failed:", err)
+		return false
+	}
+
+	return held
+}
+
+// abandon stops a connect in progress and waits for it to return. Disconnect() does nothing until Connect() has started
+// the websocket, so it's repeated until the connect returns
+func abandon(ws *gows.Websocket, connected chan error) {
+	for {
+		ws.Disconnect()
+		select {
+		case err := <-connected:
+			if err == nil {
+				ws.Disconnect()
+			}
+			return
+		case <-time.After(abandonPollInterval):
+		}
+	}
+}
+
+// demote disconnects the websocket after this instance loses leadership
+func (e *Elector) demote() {
+	e.configuration.Logger.Info("Lost leadership for", e.configuration.Key)
+
+	e.websocketLock.Lock()
+	ws := e.websocket
+	e.websocket = nil
+	e.websocketLock.Unlock()
+
+	ws.Disconnect()
+
+	if e.configuration.OnDemoted != nil {
+		e.configuration.OnDemoted()
+	}
+}
+
+// abdicate steps down and releases the lock after the leader's websocket stopped for good, so another instance can take
+// over. The election loop then waits a retry interval before trying for the lock again, giving the others a head start
+func (e *Elector) abdicate(ctx context.Context) {
+	e.configuration.Logger.Warn("Websocket stopped while leading", e.configuration.Key+", stepping down")
+	e.demote()
+	e.release(ctx)
+}
+
+// stop steps down and releases the lock when the election loop exits
+func (e *Elector) stop() {
+	if !e.IsLeader() {
+		return
+	}
+
+	e.demote()
+
+	// The run context is already cancelled, so give the release its own short deadline
+	ctx, cancel := context.WithTimeout(context.Background(), e.configuration.RefreshInterval)
+	defer cancel()
+	e.release(ctx)
+}
+
+// release gives up the lock, logging any failure
+func (e *Elector) release(ctx context.Context) {
+	err := e.lock.Release(ctx, e.configuration.Key, e.configuration.Owner)
+	if err != nil {
+		e.configuration.Logger.Warn("Failed to release leadership lock:", err)
+	}
+}
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EtcdClient defines the subset of etcd operations required by the etcd lock backend. Each method maps onto a single
+// clientv3 call: Grant and Revoke onto the lease API, KeepAliveOnce onto Lease.KeepAliveOnce, and CreateIfAbsent onto a
+// transaction comparing the key's CreateRevision to 0 before putting it with the lease attached
+type EtcdClient interface {
+	Grant(ctx context.Context, ttl time.Duration) (lease int64, err error)
+	CreateIfAbsent(ctx context.Context, key string, value string, lease int64) (bool, error)
+	KeepAliveOnce(ctx context.Context, lease int64) error
+	Revoke(ctx context.Context, lease int64) error
+}
+
+// EtcdLock defines a lock backend built on etcd leases. The key is attached to a lease, so it disappears when the
+// holder stops refreshing it
+type EtcdLock struct {
+	client EtcdClient
+	lock   *sync.Mutex
+	leases map[string]int64 // Leases held by this process, keyed by lock key
+}
+
+// NewEtcdLock constructs a new etcd lock backend
+func NewEtcdLock(client EtcdClient) *EtcdLock {
+	return &EtcdLock{
+		client: client,
+		lock:   &sync.Mutex{},
+		leases: make(map[string]int64),
+	}
+}
+
+// Acquire grants a lease and creates the key with it attached, provided the key doesn't already exist
+func (e *EtcdLock) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	lease, err := e.client.Grant(ctx, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	created, err := e.client.CreateIfAbsent(ctx, key, owner, lease)
+	if err != nil || !created {
+		_ = e.client.Revoke(ctx, lease)
+		return false, err
+	}
+
+	e.lock.Lock()
+	e.leases[key] = lease
+	e.lock.Unlock()
+
+	return true, nil
+}
+
+// Refresh keeps the key's lease alive. The TTL is fixed when the lease is granted, so it's ignored here
+func (e *EtcdLock) Refresh(ctx context.Context, key string, _ string, _ time.Duration) (bool, error) {
+	e.lock.Lock()
+	lease, ok := e.leases[key]
+	e.lock.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	err := e.client.KeepAliveOnce(ctx, lease)
+	if err != nil {
+		e.forget(key)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release revokes the key's lease, deleting the key
+func (e *EtcdLock) Release(ctx context.Context, key string, _ string) error {
+	e.lock.Lock()
+	lease, ok := e.leases[key]
+	e.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	e.forget(key)
+	return e.client.Revoke(ctx, lease)
+}
+
+// forget removes the lease for a key from the local lease map
+func (e *EtcdLock) forget(key string) {
+	e.lock.Lock()
+	delete(e.leases, key)
+	e.lock.Unlock()
+}
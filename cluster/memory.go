@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lease defines a held lock in the memory backend
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+// MemoryLock defines an in-process lock backend, useful for tests and for coordinating several electors inside a single
+// process
+type MemoryLock struct {
+	lock   *sync.Mutex
+	leases map[string]*lease
+}
+
+// NewMemoryLock constructs a new in-process lock backend
+func NewMemoryLock() *MemoryLock {
+	return &MemoryLock{
+		lock:   &sync.Mutex{},
+		leases: make(map[string]*lease),
+	}
+}
+
+// Acquire takes the lock if it's free or expired
+func (m *MemoryLock) Acquire(_ context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current, ok := m.leases[key]
+	if ok && current.owner != owner && time.Now().Before(current.expires) {
+		return false, nil
+	}
+
+	m.leases[key] = &lease{owner: owner, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+// Refresh extends the lock if it's still held by the owner
+func (m *MemoryLock) Refresh(_ context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current, ok := m.leases[key]
+	if !ok || current.owner != owner || time.Now().After(current.expires) {
+		return false, nil
+	}
+
+	current.expires = time.Now().Add(ttl)
+	return true, nil
+}
+
+// Release gives up the lock if it's held by the owner
+func (m *MemoryLock) Release(_ context.Context, key string, owner string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current, ok := m.leases[key]
+	if ok && current.owner == owner {
+		delete(m.leases, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Lua scripts implementing the lock operations atomically on the Redis side
+const (
+	redisAcquireScript = `return redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) and 1 or 0`
+	redisRefreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// RedisEvaluator defines the subset of a Redis client required by the Redis lock backend. It can be satisfied by
+// wrapping any client's EVAL command, e.g. for go-redis:
+//
+//	cluster.RedisEvalFunc(func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return client.Eval(ctx, script, keys, args...).Result()
+//	})
+type RedisEvaluator interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisEvalFunc adapts a plain function to the RedisEvaluator interface
+type RedisEvalFunc func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+// Eval evaluates the script
+func (f RedisEvalFunc) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return f(ctx, script, keys, args...)
+}
+
+// RedisLock defines a lock backend built on Redis keys with expiry
+type RedisLock struct {
+	client RedisEvaluator
+}
+
+// NewRedisLock constructs a new Redis lock backend
+func NewRedisLock(client RedisEvaluator) *RedisLock {
+	return &RedisLock{
+		client: client,
+	}
+}
+
+// Acquire takes the lock if the key doesn't exist
+func (r *RedisLock) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	return r.eval(ctx, redisAcquireScript, key, owner, ttl.Milliseconds())
+}
+
+// Refresh extends the key's expiry if it's still held by the owner
+func (r *RedisLock) Refresh(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	return r.eval(ctx, redisRefreshScript, key, owner, ttl.Milliseconds())
+}
+
+// Release deletes the key if it's held by the owner
+func (r *RedisLock) Release(ctx context.Context, key string, owner string) error {
+	_, err := r.eval(ctx, redisReleaseScript, key, owner)
+	return err
+}
+
+// eval runs a lock script, interpreting an integer reply of 1 as success
+func (r *RedisLock) eval(ctx context.Context, script string, key string, args ...interface{}) (bool, error) {
+	reply, err := r.client.Eval(ctx, script, []string{key}, args...)
+	if err != nil {
+		return false, err
+	}
+
+	switch result := reply.(type) {
+	case int64:
+		return result == 1, nil
+	case int:
+		return result == 1, nil
+	default:
+		return false, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+}
@@ -0,0 +1,98 @@
+package gows
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec defines how values are marshalled onto and unmarshalled from websocket messages
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)      // Encodes a value into a message payload
+	Unmarshal(data []byte, v interface{}) error // Decodes a message payload into a value
+	MessageType() int                           // The frame type encoded messages are sent with
+}
+
+// JSONCodec defines a codec that encodes values as JSON text messages. It is the default codec
+type JSONCodec struct{}
+
+// Marshal encodes a value as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON into a value
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// MessageType sends JSON as text messages
+func (JSONCodec) MessageType() int {
+	return TextMessage
+}
+
+// getDefaultMessageType gets the frame type of sends that don't take one, falling back to BinaryMessage
+func (c *Configuration) getDefaultMessageType() int {
+	if c.DefaultMessageType != 0 {
+		return c.DefaultMessageType
+	}
+
+	return BinaryMessage
+}
+
+// getCodec gets the configured codec, falling back to JSON
+func (c *Configuration) getCodec() Codec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+
+	return JSONCodec{}
+}
+
+// SendJSON encodes a value as JSON and sends it as a text message
+func (ws *Websocket) SendJSON(v interface{}) error {
+	return ws.sendWith(JSONCodec{}, v)
+}
+
+// SendEncoded encodes a value with the configured codec and sends it
+func (ws *Websocket) SendEncoded(v interface{}) error {
+	return ws.sendWith(ws.configuration.getCodec(), v)
+}
+
+// sendWith encodes a value with the supplied codec and sends it
+func (ws *Websocket) sendWith(codec Codec, v interface{}) error {
+	msg, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ws.send(codec.MessageType(), msg)
+}
+
+// OnJSON sets the onMessage handler to one that receives every message as raw JSON. Messages that aren't valid JSON are
+// reported to the error handler instead
+func (ws *Websocket) OnJSON(handler func(json.RawMessage)) {
+	ws.OnMessage(func(msg []byte) {
+		if !json.Valid(msg) {
+			ws.reportError(errors.New("received a message that isn't valid JSON"))
+			return
+		}
+		handler(msg)
+	})
+}
+
+// OnDecoded sets the onMessage handler to one that decodes every message with the configured codec. The newValue
+// function supplies a pointer to decode each message into, and the handler receives that pointer once it's filled in.
+// Messages that fail to decode are reported to the error handler instead
+func (ws *Websocket) OnDecoded(newValue func() interface{}, handler func(v interface{})) {
+	codec := ws.configuration.getCodec()
+	ws.OnMessage(func(msg []byte) {
+		v := newValue()
+		err := codec.Unmarshal(msg, v)
+		if err != nil {
+			ws.reportError(fmt.Errorf("failed to decode message: %w", err))
+			return
+		}
+		handler(v)
+	})
+}
@@ -0,0 +1,38 @@
+package gows
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+)
+
+// SendUncompressed sends a message with the provided body, without compressing it even if compression is
+// enabled. Useful for payloads that are already compressed, such as images or archives
+func (ws *Websocket) SendUncompressed(msg []byte) error {
+	return ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		queued.uncompressed = true
+	})
+}
+
+// prepareCompression applies the configured compression level to a new connection
+func (ws *Websocket) prepareCompression(connection *websocket.Conn) {
+	if !ws.configuration.EnableCompression || ws.configuration.CompressionLevel == 0 {
+		return
+	}
+
+	err := connection.SetCompressionLevel(ws.configuration.CompressionLevel)
+	if err != nil {
+		ws.reportError(fmt.Errorf("failed to set compression level: %w", err))
+	}
+}
+
+// setWriteCompression determines whether the next message written to the connection is compressed. Messages are only
+// compressed if compression is enabled and negotiated, they weren't sent uncompressed, and they're at least as big as
+// the compression threshold
+func (ws *Websocket) setWriteCompression(connection *websocket.Conn, msg *message) {
+	if !ws.configuration.EnableCompression {
+		return
+	}
+
+	compress := !msg.uncompressed && len(msg.data) >= ws.configuration.CompressionThreshold
+	connection.EnableWriteCompression(compress)
+}
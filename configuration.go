@@ -1,11 +1,13 @@
 package gows
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"github.com/miratronix/logpher"
-	"math"
-	"math/rand"
+	"net"
+	"net/http"
 	"net/url"
 	"time"
 )
@@ -22,24 +24,328 @@ type Configuration struct {
 	ConnectionRetryRandomize  bool
 	PingInterval              time.Duration
 	WriteTimeout              time.Duration
+	ControlWriteTimeout       time.Duration
 	ReadTimeout               time.Duration
 	InsecureLocalhost         bool
 	RetryInitialConnection    bool
 
+	// Backoff. When no strategy is supplied, an exponential backoff is built from the ConnectionRetry* fields above
+	Backoff           BackoffStrategy // The strategy used to compute the delay between connection attempts
+	BackoffResetAfter time.Duration   // How long a connection must stay up before the backoff starts over
+
+	// Connecting. The handshake timeout bounds a single connection attempt, network dial included, while the connect
+	// deadline bounds every attempt of a connect, retries and backoff included
+	HandshakeTimeout time.Duration // How long a single connection attempt can take, defaults to 45 seconds
+	ConnectDeadline  time.Duration // How long connecting can take across all attempts (0 for no limit)
+
+	// Adaptive pings. When a minimum is set, the ping interval halves every time a pong is missed, down to the
+	// minimum, and doubles back up to PingInterval after enough consecutive pongs, which defaults to 5
+	PingIntervalMin time.Duration // The shortest ping interval after missed pongs (0 for a fixed interval)
+	PingStableAfter int           // The number of consecutive pongs before the interval is relaxed again
+
+	// Keepalive payloads. The ping payload is sent with every protocol-level ping, and is left out if it's longer than
+	// the 125 bytes a control frame can carry. The heartbeat, when set, sends an application-level message on an
+	// interval and expects a reply, for servers that ignore protocol-level pings
+	PingPayload []byte
+	Heartbeat   *Heartbeat
+
+	// Suspend detection. When the clock jumps by more than the threshold, e.g. after a laptop resumes from sleep or a VM
+	// is unpaused, the connection is checked right away instead of waiting for a read deadline that didn't advance
+	// while suspended. Keep the threshold well above any expected wall clock adjustments
+	SuspendThreshold time.Duration // How far the clock has to jump to count as a suspend (0 to disable)
+	SuspendAction    SuspendAction // Whether to ping (the default) or reconnect after a suspend
+
+	// Request/response correlation
+	RequestTimeout       time.Duration                                   // Default timeout applied to Request() calls
+	CorrelationInjector  func(id string, payload []byte) ([]byte, error) // Attaches a correlation ID to an outgoing request
+	CorrelationExtractor func(message []byte) (id string, ok bool)       // Extracts the correlation ID from an inbound response
+
+	// Barriers. The marker builder creates the message Barrier() sends, and the matcher recognizes the server's echo of
+	// it, returning the barrier ID. Echoes aren't passed to the message handler
+	BarrierMarker  func(id string) ([]byte, error)           // Builds the barrier marker with the supplied ID
+	BarrierMatcher func(message []byte) (id string, ok bool) // Extracts the barrier ID from an echoed marker
+
+	// Reliable delivery. Messages sent with SendReliable() are sent again after every reconnect until they're
+	// acknowledged. The injector attaches the delivery ID to an outgoing message, and the extractor recognizes the
+	// peer's acknowledgements, which aren't passed to the message handler. Without them, messages are acknowledged
+	// with Ack()
+	AckInjector  func(id string, payload []byte) ([]byte, error) // Attaches a delivery ID to an outgoing reliable message
+	AckExtractor func(message []byte) (id string, ok bool)       // Extracts the acknowledged delivery ID from an inbound message
+
+	// At-least-once inbound delivery. When set, inbound messages carrying a delivery ID are passed to the delivery
+	// handler, which acknowledges or rejects them with the frames built here
+	InboundAcks *InboundAcks
+
+	// Session resumption. When set, the session resume token is sent after every reconnect, so servers that support
+	// resumption can replay missed messages
+	Session *SessionResume
+
+	// Epoch fencing. When enabled, messages queued before a reconnect are held back after it, so commands meant for
+	// the old session can't run in the new one until the application releases them with ReleaseFenced() or drops them
+	// with DiscardFenced()
+	EpochFencing bool
+
+	// Connect hold. By default, messages queued before a connection is established are held while the connected
+	// handler runs, so the messages it sends, e.g. login frames, go out first. The handler can keep them held with
+	// HoldQueue() until ReleaseQueue() is called. When disabled, the handler's messages queue up behind them instead
+	DisableConnectHold bool
+
+	// Send window
+	SendWindow       func(now time.Time) bool // Determines if messages may be transmitted at the supplied time
+	SendWindowPolicy SendWindowPolicy         // What to do with messages while the send window is closed
+
+	// Outbound auditing. The hook is called synchronously for every message passed to Send and its variants, as well as
+	// the messages the websocket sends by itself, like resubscriptions, acknowledgements, and heartbeats. It can return
+	// an annotated copy of the message to send instead, or an error to deny it. SendStream is unavailable while it's set,
+	// since streamed payloads can't be audited
+	OutboundAudit func(msg []byte) ([]byte, error)
+
+	// Inbound replay protection. The sequence extractor returns a monotonic sequence number or timestamp for a message,
+	// or false if the message doesn't carry one
+	InboundSequence func(msg []byte) (int64, bool) // Extracts the sequence from an inbound message
+	ReplayPolicy    ReplayPolicy                   // What to do with out-of-order or replayed messages
+
+	// Backpressure. Producers using SendFrom stop reading from their channel while the send queue holds more than this
+	// many messages. Zero disables backpressure
+	BackpressureThreshold int
+
+	// Streams. When set, the delimiter marks message boundaries in the byte streams returned by Stream(). The buffer size
+	// caps the unread inbound bytes held by each stream reader, stream codec, and NetConn(), defaulting to 4MB. Inbound
+	// messages that would overflow it are dropped and reported to the error handler
+	StreamDelimiter  []byte
+	StreamBufferSize int
+
+	// Handler concurrency. Zero handlers means there's no cap on the number of message handlers running at once
+	MaxConcurrentHandlers int                   // The maximum number of message handlers running at once
+	HandlerOverflowPolicy HandlerOverflowPolicy // What to do with messages that arrive while the cap is reached
+
+	// Handler worker pool. When either is set, message handlers run on a fixed pool of workers instead of a goroutine
+	// each, and the handler cap above is ignored. Ordered delivery uses a single worker, so handlers run one at a time in
+	// the order messages were received
+	HandlerConcurrency int  // The number of workers running message handlers, zero for a goroutine per message
+	OrderedDelivery    bool // Whether to deliver messages strictly in order on a single worker
+
+	// Server-side websockets. The upgrader is used by Upgrade(), and defaults to one with default buffer sizes and origin
+	// checks
+	Upgrader *websocket.Upgrader
+
+	// Statistics. The availability window is the rolling window WindowAvailability is computed over, zero disables it
+	AvailabilityWindow time.Duration
+
+	// Inbound buffering. The number of messages buffered between the network read loop and the dispatcher, defaults to
+	// 256. When the buffer is full, the read loop waits for the dispatcher to catch up
+	InboundBufferSize int
+
+	// Inbound spilling. When a spill directory is set, inbound messages that arrive while the dispatcher is behind are
+	// kept in memory up to the threshold, which defaults to the inbound buffer size, then spilled to a file in the
+	// directory and replayed in order. The read loop never waits for the dispatcher, and nothing is dropped
+	InboundSpillDir       string // The directory spill files are created in
+	InboundSpillThreshold int    // The number of inbound messages kept in memory before spilling
+
+	// Persistent send queue. When set, queued messages are stored until they're sent or discarded, so they survive a
+	// process restart and are queued again by New(). Streamed messages aren't stored. Use NewFileQueue() for a
+	// file-backed queue, and keep one queue per websocket
+	Queue Queue
+
+	// Encryption at rest. When a key is set, messages written to disk are encrypted with AES-GCM, since payloads often
+	// contain data that mustn't sit on disk in plaintext. The key must be 16, 24, or 32 bytes long
+	SpoolEncryptionKey []byte
+
+	// Message channel. The size of the channel returned by Messages(), defaults to 256, and what happens to messages
+	// that arrive while it's full
+	MessageChannelSize   int                  // The number of messages buffered on the message channel
+	MessageChannelPolicy MessageChannelPolicy // Whether to block (MessageChannelBlock) or drop (MessageChannelDrop) when full
+
+	// Send queue limits. Messages that can't be queued are dropped, and SendErr returns the reason
+	MaxQueueSize int  // The maximum number of messages in the send queue, zero for no limit
+	FailFast     bool // Whether to refuse messages while the websocket isn't connected instead of queueing them
+
+	// Send queue watermarks. The watermark handlers are called when the queue depth reaches the high watermark, and when
+	// it falls back to the low watermark, which defaults to half the high watermark. Zero disables the watermarks
+	QueueHighWatermark int // The queue depth that triggers the high watermark handler
+	QueueLowWatermark  int // The queue depth that triggers the low watermark handler after a high watermark
+
+	// Encoding. The frame type of Send and the other sends that don't take one, which defaults to BinaryMessage, the
+	// codec used by SendEncoded and OnDecoded, which defaults to JSON, and the codec queued messages and their metadata
+	// are stored with when the queue is persisted, which defaults to the versioned binary format
+	DefaultMessageType int
+	Codec              Codec
+	QueueCodec         QueueCodec
+
+	// Progress reporting. The number of bytes written between progress reports for SendWithProgress, defaults to the
+	// target frame size if there is one, or 32KB otherwise
+	ProgressChunkSize int
+
+	// Message size limit. Inbound messages bigger than the limit drop the connection, since reading them would mean
+	// allocating as much memory as the server cares to send, and outbound messages bigger than it are refused with
+	// ErrMessageTooLarge. Zero means there's no limit
+	MaxMessageSize int64
+
+	// Frame sizing. When set, the connection's write buffer is sized so messages bigger than the target are split into
+	// frames of at most this many payload bytes, which helps on links where large frames cause fragmentation latency.
+	// Messages sent with SendWithProgress and SendStream are written in chunks of the same size. Zero uses gorilla's
+	// default buffer size
+	TargetFrameSize int
+
+	// Rate limiting. The limiter can be shared between websockets to enforce an aggregate rate across all of them
+	RateLimiter RateLimiter
+
+	// Bandwidth cap. Outbound payloads are shaped to the limit with a leaky bucket, for links that must not be
+	// saturated. The burst defaults to one second's worth of bytes. A limit of zero disables the cap
+	BandwidthLimit int // The maximum average number of payload bytes sent per second
+	BandwidthBurst int // The number of bytes that can be sent at once before shaping kicks in
+
+	// Topics. The extractor gets the topic an inbound message was published on, for per-topic statistics and routing to
+	// the handlers registered with Subscribe(). The separator splits topics into levels for wildcard matching, and
+	// defaults to "/". The topics with the most recent inbound bytes are reported as top talkers, 10 of them by
+	// default, ranked over the last one to two windows of a minute by default. Statistics and sampling state are kept
+	// for up to 10000 topics by default, forgetting the least recently active one to make room for a new one
+	TopicExtractor   func([]byte) (string, bool) // Extracts the topic from an inbound message
+	TopicSeparator   string                      // The separator between topic levels
+	TopTalkers       int                         // The number of topics reported as top talkers
+	TopTalkersWindow time.Duration               // The window top talkers are ranked over
+	MaxTrackedTopics int                         // The maximum number of topics statistics and sampling state are kept for
+
+	// Traffic accounting. The classifier buckets messages in both directions into application-defined categories, e.g.
+	// "chat", "telemetry", or "sync", for the per-category byte counts in Stats(). Messages classified as "" aren't
+	// counted
+	TrafficClassifier func(messageType int, msg []byte) string
+
+	// Subscription confirmations. The matcher recognizes the server's responses to subscription messages, driving the
+	// lifecycle handlers of every Subscription. Matched responses aren't passed to the message handler
+	SubscriptionMatcher SubscriptionMatcher
+
+	// Subscription cursors. The injector adds a subscription's last seen cursor to its resubscribe message, and the
+	// honored function inspects the confirmation to determine if the server resumed from the cursor
+	CursorInjector CursorInjector    // Builds a resubscribe message that resumes from a cursor
+	CursorHonored  func([]byte) bool // Determines if a confirmation honored the resubscribe cursor
+
+	// Subscription pruning. When an unsubscriber is set, subscriptions linked to a topic with ForTopic() are removed and
+	// unsubscribed once no topic handler matches them anymore, or once no matching message has been received for the
+	// idle timeout. Zero disables idle pruning
+	Unsubscriber            func(subscription []byte) ([]byte, error) // Builds the unsubscribe message for a subscription
+	SubscriptionIdleTimeout time.Duration                             // How long a subscription can go without data
+
+	// Inbound TTL. Inbound messages older than the TTL, according to the timestamp extracted from them, are dropped
+	// before they're dispatched. Zero disables the TTL
+	InboundTTL       time.Duration                  // The maximum age of an inbound message
+	InboundTimestamp func([]byte) (time.Time, bool) // Extracts the time an inbound message was produced
+
+	// Failover. When URLs are set, they're used instead of the URL field, and the reviver rotates through them on
+	// failed connection attempts in the order determined by the strategy. The URL provider takes precedence over both,
+	// and is called before every attempt with the number of consecutive failures
+	URLs        []string                  // The endpoints to fail over between
+	URLStrategy URLStrategy               // Whether to rotate round-robin (URLRoundRobin) or by priority (URLPriority)
+	URLProvider func(failures int) string // Supplies the URL for the next connection attempt
+
+	// Compression. When enabled, permessage-deflate is negotiated with the server, and messages at least as big as the
+	// threshold are compressed at the configured level, unless they're sent with SendUncompressed(). A level of zero
+	// uses the default level
+	EnableCompression    bool // Whether to negotiate per-message compression
+	CompressionLevel     int  // The flate compression level, from -2 to 9
+	CompressionThreshold int  // The minimum size of a message that gets compressed, in bytes
+
+	// Subprotocols. The subprotocols offered to the server, in order of preference. When set, a connection is rejected
+	// and retried unless the server selects one of them
+	Subprotocols []string
+
+	// Login. When set, the login flow runs on every connection, holding back everything else in the send queue until
+	// the server confirms the login
+	Login *LoginFlow
+
+	// Dial hook. When set, it's called before every connection attempt and can supply a fresh URL, query, and headers,
+	// so expiring tokens or signed URLs can be regenerated on every reconnect. An empty URL or nil query falls back to
+	// the URL and Query fields. Returning an error fails the attempt
+	BeforeDial func(ctx context.Context) (url string, query url.Values, header http.Header, err error)
+
+	// Batching. By default, queued messages are sent immediately. With a flush interval, the sender flushes the queue on
+	// every tick instead, batching the messages sent in between
+	FlushInterval time.Duration
+
+	// Adaptive batching. When a threshold is set and there's no flush interval, messages are sent immediately while the
+	// queue is shallow, for latency, and batched on the batching flush interval once the queue depth reaches the
+	// threshold, for throughput, until it falls back to half the threshold
+	BatchingThreshold     int           // The queue depth that switches to batched writes (0 to disable)
+	BatchingFlushInterval time.Duration // How often the queue is flushed while batching, defaults to 10ms
+
+	// Close handling. Maps close codes to what the reviver does about them, e.g. stopping on an application code that
+	// means the credentials were revoked. Codes that aren't mapped reconnect as usual. Codes mapped to CloseCallback
+	// are passed to the decider, which picks one of the other actions
+	CloseActions map[int]CloseAction                     // The action taken for each close code
+	CloseDecider func(code int, text string) CloseAction // Decides the action for codes mapped to CloseCallback
+
+	// Terminal closes. The reviver stops instead of reconnecting when the connection is closed with one of the terminal
+	// codes, e.g. 1008 (policy violation) or an application code meaning the client is unauthorized, or when the
+	// reconnect hook returns false. Both take precedence over the close actions, and the terminated handler is called
+	TerminalCloseCodes []int                          // The close codes that stop the websocket for good
+	ShouldReconnect    func(code int, err error) bool // Decides if the websocket reconnects after a connection drops
+
+	// Tracing. When a tracer provider is set, dial attempts, message writes, and handler invocations are traced. The
+	// propagator adds the dial span's trace context to the handshake headers, e.g. as a traceparent header
+	TracerProvider  TracerProvider                                // Supplies the tracer spans are started with
+	TracePropagator func(ctx context.Context, header http.Header) // Injects the trace context into the handshake headers
+
+	// Self-profiling. When enabled, the time spent writing and dispatching messages is measured, and allocations are
+	// sampled on the profile interval, which defaults to 10 seconds. The results are included in Stats()
+	SelfProfiling   bool          // Whether to profile the sender and dispatcher
+	ProfileInterval time.Duration // How often allocations are sampled
+
+	// Handler metrics. When enabled, every message, topic, delivery, channel, and publish/subscribe handler invocation
+	// is counted and timed, for the per-handler metrics in Stats()
+	HandlerMetrics bool
+
+	// Proxying. The proxy function picks the proxy for every connection attempt, returning a nil URL to connect
+	// directly. HTTPProxy() and SOCKS5Proxy() build one for a fixed proxy, with or without credentials. Defaults to the
+	// proxy configured in the environment (HTTP_PROXY, HTTPS_PROXY, and NO_PROXY)
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Networking. When set, the dial function creates the underlying network connection instead of the default dialer,
+	// e.g. to connect through an in-memory transport in tests
+	NetDial func(network string, addr string) (net.Conn, error)
+
+	// Determinism. The ID generator supplies request correlation and delivery IDs and defaults to SequentialIDs(). The clock is used
+	// for TTLs, idle pruning, send windows, and statistics, and defaults to the system clock
+	IDGenerator func() string // Generates the ID of every request and reliable message
+	Clock       Clock         // The time source for time-dependent behavior
+
 	dialer *websocket.Dialer
 }
 
-// getRetryDuration computes the retry duration for a reconnect attempt
-func (c *Configuration) getRetryDuration(attempt int) time.Duration {
-	random := float64(1)
-	if c.ConnectionRetryRandomize {
-		random = rand.Float64() + 1
+// getBackoff gets the backoff strategy, falling back to an exponential backoff built from the retry fields
+func (c *Configuration) getBackoff() BackoffStrategy {
+	if c.Backoff != nil {
+		return c.Backoff
 	}
-	min := float64(c.ConnectionRetryTimeoutMin)
-	max := float64(c.ConnectionRetryTimeoutMax)
-	retryInterval := int64(math.Min(random*min*math.Pow(c.ConnectionRetryFactor, float64(attempt)), max))
 
-	return time.Duration(retryInterval)
+	return &ExponentialBackoff{
+		Min:       c.ConnectionRetryTimeoutMin,
+		Max:       c.ConnectionRetryTimeoutMax,
+		Factor:    c.ConnectionRetryFactor,
+		Randomize: c.ConnectionRetryRandomize,
+	}
+}
+
+// tooLarge determines if a message of the supplied size exceeds the maximum message size
+func (c *Configuration) tooLarge(size int64) bool {
+	return c.MaxMessageSize > 0 && size > c.MaxMessageSize
+}
+
+// messageTooLarge builds the error for a message of the supplied size that exceeds the maximum message size
+func (c *Configuration) messageTooLarge(size int64) error {
+	return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, size, c.MaxMessageSize)
+}
+
+// getUpgrader gets the websocket upgrader for server-side websockets
+func (c *Configuration) getUpgrader() *websocket.Upgrader {
+	if c.Upgrader != nil {
+		return c.Upgrader
+	}
+
+	return &websocket.Upgrader{
+		EnableCompression: c.EnableCompression,
+		Subprotocols:      c.Subprotocols,
+		WriteBufferSize:   c.TargetFrameSize,
+	}
 }
 
 // getDialer gets the websocket dialer
@@ -56,33 +362,47 @@ func (c *Configuration) getDialer() (*websocket.Dialer, error) {
 		return nil, err
 	}
 
-	// If insecure localhost is not set, we're not using wss, or we're not connecting to localhost, use the default dialer
-	if !c.InsecureLocalhost || uri.Scheme != "wss" || uri.Host != "localhost" {
-		c.dialer = websocket.DefaultDialer
-		return c.dialer, nil
+	// Start from a copy of the default dialer
+	dialer := *websocket.DefaultDialer
+
+	// If insecure localhost is set and we're connecting to localhost over wss, clone the TLS configuration and set the
+	// insecure skip flag
+	if c.InsecureLocalhost && uri.Scheme == "wss" && uri.Host == "localhost" {
+		tlsConfig := &tls.Config{}
+		if dialer.TLSClientConfig != nil {
+			tlsConfig = dialer.TLSClientConfig.Clone()
+		}
+		tlsConfig.InsecureSkipVerify = true
+		dialer.TLSClientConfig = tlsConfig
 	}
 
-	// Clone the TLS configuration and set the insecure skip flag
-	tlsConfig := &tls.Config{}
-	if websocket.DefaultDialer.TLSClientConfig != nil {
-		tlsConfig = websocket.DefaultDialer.TLSClientConfig.Clone()
+	// Bound every connection attempt by the configured handshake timeout
+	if c.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = c.HandshakeTimeout
 	}
-	tlsConfig.InsecureSkipVerify = true
-
-	// Clone the default dialer but modify the TLS config
-	c.dialer = &websocket.Dialer{
-		NetDial:           websocket.DefaultDialer.NetDial,
-		NetDialContext:    websocket.DefaultDialer.NetDialContext,
-		Proxy:             websocket.DefaultDialer.Proxy,
-		HandshakeTimeout:  websocket.DefaultDialer.HandshakeTimeout,
-		ReadBufferSize:    websocket.DefaultDialer.ReadBufferSize,
-		WriteBufferSize:   websocket.DefaultDialer.WriteBufferSize,
-		WriteBufferPool:   websocket.DefaultDialer.WriteBufferPool,
-		Subprotocols:      websocket.DefaultDialer.Subprotocols,
-		EnableCompression: websocket.DefaultDialer.EnableCompression,
-		Jar:               websocket.DefaultDialer.Jar,
-		TLSClientConfig:   tlsConfig,
+
+	// Offer per-message compression if it's enabled
+	dialer.EnableCompression = c.EnableCompression
+
+	// Offer the configured subprotocols
+	dialer.Subprotocols = c.Subprotocols
+
+	// Size the write buffer to the target frame size, since that's the largest frame the connection writes
+	if c.TargetFrameSize > 0 {
+		dialer.WriteBufferSize = c.TargetFrameSize
+	}
+
+	// Use the configured proxy instead of the one from the environment
+	if c.Proxy != nil {
+		dialer.Proxy = c.Proxy
+	}
+
+	// If a custom network dialer is set, use it instead of the default one. When proxying, it connects to the proxy
+	if c.NetDial != nil {
+		dialer.NetDial = nil
+		dialer.NetDialContext = cancellableDial(c.NetDial)
 	}
 
+	c.dialer = &dialer
 	return c.dialer, nil
 }
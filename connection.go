@@ -1,63 +1,153 @@
 package gows
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/gorilla/websocket"
-	"strings"
+	"net/http"
 	"time"
 )
 
-// connect connects the websocket, either indefinitely or using the maximum number of retries
-func (ws *Websocket) connect(retries bool) (*websocket.Conn, error) {
+// connect connects the websocket, either indefinitely or using the maximum number of retries. When reconnecting, the
+// reconnecting handler is notified before every attempt, and the first attempt is made after the supplied delay. Gives
+// up with ErrDisconnected if the stop channel is closed while dialing or waiting between attempts, and with a
+// ConnectDeadlineError if the connect deadline passes first. Returns the number of attempts it took to connect
+func (ws *Websocket) connect(stopChannel chan struct{}, retries bool, reconnecting bool, delay time.Duration) (*websocket.Conn, int, error) {
 	attempt := 0
 
-	for {
-		url := ws.configuration.URL
-		ws.configuration.Logger.Info("Attempting connection to", url)
-
-		// Append the provided query parameters
-		if len(ws.configuration.Query) != 0 {
-			url = fmt.Sprintf("%s?%s", url, ws.configuration.Query)
+	// The first reconnect attempt happens immediately, unless a delay was requested
+	if reconnecting {
+		ws.callReconnectingHandler(1, delay)
+		if delay > 0 && !sleep(stopChannel, delay) {
+			ws.configuration.Logger.Info("Stopped connecting websocket before the first attempt")
+			return nil, 0, ErrDisconnected
 		}
+	}
+
+	// Cancel any dial in progress when we're stopped
+	stopCtx, cancel := stopContext(stopChannel)
+	defer cancel()
+
+	// Bound all the attempts by the connect deadline, keeping the error of every attempt to report if it passes
+	ctx := stopCtx
+	var deadline time.Time
+	var attemptErrors []error
+	if ws.configuration.ConnectDeadline > 0 {
+		var cancelDeadline context.CancelFunc
+		deadline = time.Now().Add(ws.configuration.ConnectDeadline)
+		ctx, cancelDeadline = context.WithDeadline(stopCtx, deadline)
+		defer cancelDeadline()
+	}
+
+	// Start the URL rotation over
+	ws.startFailover()
+
+	for {
 
 		// Create the dialer
 		dialer, err := ws.configuration.getDialer()
 		if err != nil {
-			return nil, err
+			ws.reportError(err)
+			return nil, attempt + 1, err
 		}
 
-		// Dial the connection
-		connection, _, err := dialer.Dial(url, nil)
+		// Work out where to dial, then dial the connection in its own span, propagating the trace to the server
+		attemptCtx, span := ws.startDialSpan(ctx, attempt+1)
+		url, header, err := ws.dialTarget(attemptCtx)
 		if err == nil {
-			ws.configuration.Logger.Info("Successfully connected websocket")
-			return connection, nil
+			var connection *websocket.Conn
+			var response *http.Response
+			header = ws.injectTraceContext(attemptCtx, header)
+			connection, response, err = dialer.DialContext(ctx, url, header)
+
+			// Hang up if the server didn't select an acceptable subprotocol
+			if err == nil {
+				err = ws.checkSubprotocol(connection)
+				if err != nil {
+					ws.writeClose(connection, websocket.CloseProtocolError, "unacceptable subprotocol")
+					_ = connection.Close()
+				}
+			}
+
+			if err == nil {
+				endSpan(span, nil)
+				ws.configuration.Logger.Debug("Successfully dialed websocket")
+				ws.connectedAt = ws.now()
+				ws.setHandshakeResponse(response)
+				return connection, attempt + 1, nil
+			}
+		}
+
+		endSpan(span, err)
+
+		// Stopped while dialing, give up without reporting the cancellation
+		if stopCtx.Err() != nil {
+			ws.configuration.Logger.Info("Stopped connecting websocket after", attempt+1, "attempts")
+			return nil, attempt + 1, ErrDisconnected
+		}
+		err = wrapDialError(err)
+		ws.reportError(err)
+		ws.dialFailed()
+		attemptErrors = append(attemptErrors, err)
+
+		// Out of time, give up with every attempt's error
+		if ctx.Err() != nil {
+			ws.configuration.Logger.Info("Connect deadline passed after", attempt+1, "attempts")
+			return nil, attempt + 1, &ConnectDeadlineError{Deadline: ws.configuration.ConnectDeadline, Attempts: attemptErrors}
 		}
 
 		// Keep trying if retrying is allowed and the configured retries are set to 0, or if we have attempts left
 		keepTrying := retries && (ws.configuration.ConnectionRetries == 0 || attempt < (ws.configuration.ConnectionRetries-1))
 
 		if !keepTrying {
-			ws.configuration.Logger.Info("Failed to connect websocket after", retries, "attempts")
-			return nil, err
+			ws.configuration.Logger.Info("Failed to connect websocket after", attempt+1, "attempts")
+			return nil, attempt + 1, err
 		}
 
-		// Sleep for the retry interval
-		time.Sleep(ws.configuration.getRetryDuration(attempt))
+		// Sleep for the retry interval, letting the application know how long it'll be waiting. Don't bother if the
+		// deadline passes before the next attempt
+		delay := ws.backoff.Next(ws.backoffAttempt)
+		if !deadline.IsZero() && !time.Now().Add(delay).Before(deadline) {
+			ws.configuration.Logger.Info("Connect deadline passes before the next attempt, giving up after", attempt+1, "attempts")
+			return nil, attempt + 1, &ConnectDeadlineError{Deadline: ws.configuration.ConnectDeadline, Attempts: attemptErrors}
+		}
+		if reconnecting {
+			ws.callReconnectingHandler(attempt+2, delay)
+		}
+		if !sleep(stopChannel, delay) {
+			ws.configuration.Logger.Info("Stopped connecting websocket after", attempt+1, "attempts")
+			return nil, attempt + 1, ErrDisconnected
+		}
+		ws.backoffAttempt++
 		attempt++
 	}
 }
 
+// resetBackoff starts the backoff over from the first attempt
+func (ws *Websocket) resetBackoff() {
+	ws.backoff.Reset()
+	ws.backoffAttempt = 0
+}
+
 // reviver is a Goroutine responsible for initializing the websocket connection and reconnecting it when the connection is dropped
-func (ws *Websocket) reviver(initialConnectionErrorChannel chan error) {
+func (ws *Websocket) reviver(stopChannel chan struct{}, doneChannel chan struct{}, initialConnectionErrorChannel chan error) {
+	defer close(doneChannel)
+	defer ws.flushRetries()
 
-	connection, err := ws.connect(ws.configuration.RetryInitialConnection)
+	connection, attempts, err := ws.connect(stopChannel, ws.configuration.RetryInitialConnection, false, 0)
 	if err != nil {
+		if err != ErrDisconnected {
+			ws.gaveUp(err)
+		}
+		ws.setState(Disconnected)
 		initialConnectionErrorChannel <- err
 		return
 	}
 
 	// Save the connection
 	ws.setConnection(connection)
+	ws.setState(Connected)
+	ws.connectionEstablished(false, attempts, 0)
 
 	// Connected successfully, no error to push onto the channel
 	close(initialConnectionErrorChannel)
@@ -66,8 +156,9 @@ func (ws *Websocket) reviver(initialConnectionErrorChannel chan error) {
 	for {
 		select {
 
-		case <-ws.stopChannel:
-			ws.clearConnection()
+		case <-stopChannel:
+			ws.clearConnection(nil)
+			ws.setState(Closed)
 			return
 
 		case err := <-ws.connectionDroppedChannel:
@@ -77,17 +168,96 @@ func (ws *Websocket) reviver(initialConnectionErrorChannel chan error) {
 				break
 			}
 
-			// Clear out the connection
+			// Work out what to do about the close code
 			ws.configuration.Logger.Warn("Websocket connection lost:", err)
-			ws.clearConnection()
+			disconnectedAt := ws.now()
+			action := ws.closeAction(err)
+
+			// The close code means we shouldn't come back, clear out the connection and stop
+			if action == CloseStopPermanently {
+				code, _ := closeCode(err)
+				ws.configuration.Logger.Warn("Not reconnecting websocket after close code", code)
+				ws.setState(Closing)
+				ws.clearConnection(err)
+				ws.setState(Closed)
+				ws.gaveUp(err)
+				ws.callTerminatedHandler(err)
+				return
+			}
+
+			// Clear out the connection
+			ws.setState(Reconnecting)
+			ws.clearConnection(err)
+
+			// If the connection was healthy for long enough, start the backoff over. Otherwise, carry on where the
+			// last reconnect left off, so a flapping connection doesn't reconnect at full speed
+			if action == CloseReconnectImmediately || ws.now().Sub(ws.connectedAt) >= ws.configuration.BackoffResetAfter {
+				ws.resetBackoff()
+			}
+
+			// Hold off on the first attempt if the close code asked for it
+			delay := time.Duration(0)
+			if action == CloseReconnectWithBackoff {
+				delay = ws.backoff.Next(ws.backoffAttempt)
+				ws.backoffAttempt++
+			}
 
 			// And establish a new one
-			connection, _ := ws.connect(true)
+			connection, attempts, err := ws.connect(stopChannel, true, true, delay)
+
+			// Out of retries or disconnected while reconnecting, the websocket is stopped until it's connected again
+			if err != nil {
+				if err != ErrDisconnected {
+					ws.configuration.Logger.Warn("Giving up on reconnecting websocket:", err)
+					ws.gaveUp(err)
+				}
+				ws.setState(Closed)
+				return
+			}
+
 			ws.setConnection(connection)
+			ws.setState(Connected)
+			ws.connectionEstablished(true, attempts, ws.now().Sub(disconnectedAt))
+			ws.callReconnectedHandler(attempts)
 		}
 	}
 }
 
+// sleep waits for the supplied delay, returning false if the stop channel was closed in the meantime
+func sleep(stopChannel chan struct{}, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stopChannel:
+		return false
+	}
+}
+
+// connectionEstablished logs a successful connection with its metadata and notifies the connection established handler
+func (ws *Websocket) connectionEstablished(reconnect bool, attempts int, downtime time.Duration) {
+	info := ConnectionInfo{
+		Reconnect:  reconnect,
+		Generation: ws.getGeneration(),
+		Attempts:   attempts,
+		Downtime:   downtime,
+	}
+
+	ws.configuration.Logger.Info(info.String())
+	ws.connectionStats.established(reconnect, ws.now())
+	ws.emit(LifecycleEvent{
+		Type:       EventConnected,
+		Generation: info.Generation,
+		Attempts:   attempts,
+		Downtime:   downtime,
+	})
+	ws.connectionEstablishedHandlerLock.Lock()
+	ws.connectionEstablishedHandler(info)
+	ws.connectionEstablishedHandlerLock.Unlock()
+}
+
 // setConnection initializes the websocket, starting up the reader and unblocking any goroutines trying to send stuff
 func (ws *Websocket) setConnection(connection *websocket.Conn) {
 	ws.configuration.Logger.Debug("Preparing new connection...")
@@ -96,27 +266,46 @@ func (ws *Websocket) setConnection(connection *websocket.Conn) {
 	ws.configuration.Logger.Trace("Initializing connection object...")
 	ws.connectionLock.Lock()
 
-	// Set the connection
+	// Set the connection and move on to the next generation
 	ws.connection = connection
+	ws.generation++
+
+	// Apply the compression level, which only matters if compression was negotiated
+	ws.prepareCompression(connection)
 
-	// Add a close listener that writes on the connection drop channel
+	// Create the connection drop channel, which the consumer's close handler writes on
 	ws.connectionDroppedChannel = make(chan error)
-	ws.connection.SetCloseHandler(func(code int, message string) error {
-		ws.connectionDroppedChannel <- fmt.Errorf("websocket closed with code %d:%s", code, message)
-		return nil
-	})
 
 	// Release the connection lock
+	generation := ws.generation
 	ws.connectionLock.Unlock()
 	ws.configuration.Logger.Trace("Successfully initialized connection object")
 
-	// Call the connection handler
+	// If this is a reconnect, fence off messages queued before it and send unacknowledged messages again
+	if generation > 1 {
+		ws.fenceStale(generation)
+		ws.redeliver()
+	}
+
+	// Hold everything queued so far while the connection handler runs, then put the subscription messages ahead of
+	// whatever it sends, and the session resume token ahead of everything
+	ws.holdBacklog()
+	if generation > 1 {
+		ws.resubscribe()
+		ws.resumeSession()
+	}
+
+	// Call the connection handler, releasing the held messages once it returns
 	ws.configuration.Logger.Trace("Calling connection handler...")
 	ws.connectedHandlerLock.Lock()
-	ws.connectedHandler()
+	ws.safely("connected", ws.connectedHandler)
 	ws.connectedHandlerLock.Unlock()
+	ws.endHold()
 	ws.configuration.Logger.Trace("Successfully called connection handler")
 
+	// Put the login message at the front of the queue, blocking everything else until the login is confirmed
+	loginResult := ws.beginLogin()
+
 	// Start the message consumer and sender after calling the connection handler, to ensure no events come in
 	// before the connected handler has completed
 	ws.configuration.Logger.Trace("Starting consumer/sender goroutines...")
@@ -124,11 +313,17 @@ func (ws *Websocket) setConnection(connection *websocket.Conn) {
 	ws.startSender()
 	ws.configuration.Logger.Trace("Successfully started consumer/sender goroutines")
 
+	// Wait for the login to complete in the background
+	if loginResult != nil {
+		go ws.awaitLogin(loginResult, ws.senderStopChannel)
+	}
+
 	ws.configuration.Logger.Debug("Successfully prepared new connection")
 }
 
-// clearConnection terminates the connection, cleaning up the consumer and closing the connection if present
-func (ws *Websocket) clearConnection() {
+// clearConnection terminates the connection, cleaning up the consumer and closing the connection if present. The
+// reason is the error that caused the connection to drop, or nil if it was closed deliberately
+func (ws *Websocket) clearConnection(reason error) {
 	ws.configuration.Logger.Debug("Clearing out connection...")
 
 	// Stop the consumer and sender
@@ -141,12 +336,14 @@ func (ws *Websocket) clearConnection() {
 	ws.configuration.Logger.Trace("Closing and removing connection object...")
 	ws.connectionLock.Lock()
 
-	// Close the connection and log an error if closing it failed
+	// Say goodbye, then close the connection and log an error if closing it failed
 	if ws.connection != nil {
+		ws.writeClose(ws.connection, websocket.CloseNormalClosure, "")
 		err := ws.connection.Close()
-		if err != nil && !strings.HasSuffix(err.Error(), "use of closed connection") {
+		if err != nil && ClassifyError(err) != ErrorClosed {
 			ws.configuration.Logger.Warn("Failed to close connection:", err)
 		}
+		ws.connectionStats.closed(ws.now())
 	}
 
 	// Clear the connection
@@ -159,13 +356,48 @@ func (ws *Websocket) clearConnection() {
 	// Call the disconnect handler
 	ws.configuration.Logger.Trace("Calling disconnect handler...")
 	ws.disconnectedHandlerLock.Lock()
-	ws.disconnectedHandler()
+	ws.safely("disconnected", ws.disconnectedHandler)
 	ws.disconnectedHandlerLock.Unlock()
 	ws.configuration.Logger.Trace("Successfully called disconnect handler")
 
+	// Call the disconnect handler that wants to know why
+	code, text := closeCode(reason)
+	ws.configuration.Logger.Trace("Calling disconnect with reason handler...")
+	ws.disconnectedWithReasonHandlerLock.Lock()
+	ws.safely("disconnected with reason", func() { ws.disconnectedWithReasonHandler(code, text, reason) })
+	ws.disconnectedWithReasonHandlerLock.Unlock()
+	ws.configuration.Logger.Trace("Successfully called disconnect with reason handler")
+
+	// Let the lifecycle listeners know
+	event := LifecycleEvent{Type: EventDisconnected, Generation: ws.getGeneration(), Code: code, Reason: text}
+	if reason != nil {
+		event.Error = reason.Error()
+	}
+	ws.emit(event)
+
 	ws.configuration.Logger.Debug("Successfully cleared out connection")
 }
 
+// closeCode extracts the close code and message from the error that caused a connection to drop. Connections closed
+// deliberately report a normal closure, and connections that dropped without a close frame report an abnormal closure
+func closeCode(reason error) (int, string) {
+	if reason == nil {
+		return websocket.CloseNormalClosure, ""
+	}
+
+	var closeErr *CloseError
+	if errors.As(reason, &closeErr) {
+		return closeErr.Code, closeErr.Reason
+	}
+
+	var gorillaCloseErr *websocket.CloseError
+	if errors.As(reason, &gorillaCloseErr) {
+		return gorillaCloseErr.Code, gorillaCloseErr.Text
+	}
+
+	return websocket.CloseAbnormalClosure, ""
+}
+
 // getConnection gets the current websocket connection
 func (ws *Websocket) getConnection() *websocket.Conn {
 
@@ -176,6 +408,66 @@ func (ws *Websocket) getConnection() *websocket.Conn {
 	return ws.connection
 }
 
+// callReconnectingHandler notifies the reconnecting handler of an upcoming reconnect attempt
+func (ws *Websocket) callReconnectingHandler(attempt int, delay time.Duration) {
+	ws.configuration.Logger.Debug("Reconnect attempt", attempt, "in", delay)
+	ws.reconnectingHandlerLock.Lock()
+	ws.reconnectingHandler(attempt, delay)
+	ws.reconnectingHandlerLock.Unlock()
+}
+
+// callReconnectedHandler notifies the reconnected handler of a successful reconnect
+func (ws *Websocket) callReconnectedHandler(attempts int) {
+	ws.reconnectedHandlerLock.Lock()
+	ws.reconnectedHandler(attempts)
+	ws.reconnectedHandlerLock.Unlock()
+}
+
+// reportError passes an internal failure to the error handler
+func (ws *Websocket) reportError(err error) {
+	ws.connectionStats.failed(err, ws.now())
+	ws.errorHandlerLock.Lock()
+	ws.errorHandler(err)
+	ws.errorHandlerLock.Unlock()
+}
+
+// setHandshakeResponse saves the server's response to the most recent successful handshake
+func (ws *Websocket) setHandshakeResponse(response *http.Response) {
+	ws.connectionLock.Lock()
+	ws.handshakeResponse = response
+	ws.connectionLock.Unlock()
+}
+
+// HandshakeResponse gets the server's HTTP response to the most recent successful handshake, including any cookies or
+// headers it set. Returns nil before the first connection, and for server-side websockets
+func (ws *Websocket) HandshakeResponse() *http.Response {
+	ws.connectionLock.Lock()
+	defer ws.connectionLock.Unlock()
+
+	return ws.handshakeResponse
+}
+
+// Subprotocol gets the subprotocol negotiated for the current connection, or an empty string if none was negotiated or
+// the websocket isn't connected
+func (ws *Websocket) Subprotocol() string {
+	connection := ws.getConnection()
+	if connection == nil {
+		return ""
+	}
+
+	return connection.Subprotocol()
+}
+
+// getGeneration gets the generation of the current connection
+func (ws *Websocket) getGeneration() uint64 {
+
+	// Lock on the connection lock
+	ws.connectionLock.Lock()
+	defer ws.connectionLock.Unlock()
+
+	return ws.generation
+}
+
 // handleConnectionError writes the supplied connection error to the connection drop channel. If there are no goroutines
 // currently waiting on the drop channel, it means that we're currently reviving already, so the error can be dropped
 func (ws *Websocket) handleConnectionError(err error) {
@@ -1,13 +1,12 @@
 package gows
 
 import (
-	"errors"
-	"strings"
+	"github.com/gorilla/websocket"
 	"time"
 )
 
 // consumer defines the goroutine responsible for reading messages from the connection
-func (ws *Websocket) consumer() {
+func (ws *Websocket) consumer(stopChannel chan struct{}) {
 
 	// Get the current connection. If it's nil, it means that the connection dropped while we were starting up. Nothing
 	// to do with this connection, so just exit and let the reviver start us up again
@@ -17,57 +16,136 @@ func (ws *Websocket) consumer() {
 		return
 	}
 
-	// Set up the read deadline and a pong handler that refreshes the deadline
+	// Limit the size of inbound messages
+	if ws.configuration.MaxMessageSize > 0 {
+		connection.SetReadLimit(ws.configuration.MaxMessageSize)
+	}
+
+	// Set up the read deadline, which every frame we receive refreshes, since any traffic shows the connection is alive.
+	// Servers that ping us but never answer our pings would otherwise time out the connection
 	ws.configuration.Logger.Trace("CONSUMER: Setting read deadline...")
-	_ = connection.SetReadDeadline(time.Now().Add(ws.configuration.ReadTimeout))
+	ws.refreshReadDeadline(connection)
 	connection.SetPongHandler(func(string) error {
-		_ = connection.SetReadDeadline(time.Now().Add(ws.configuration.ReadTimeout))
+		ws.refreshReadDeadline(connection)
+		ws.pongReceived()
 		return nil
 	})
+	connection.SetPingHandler(func(payload string) error {
+		ws.refreshReadDeadline(connection)
+		return ws.writePong(connection, []byte(payload))
+	})
 	ws.configuration.Logger.Trace("CONSUMER: Successfully set read deadline")
 
+	// Add a close listener that writes on the connection drop channel. The peer's reply to our own close frame arrives
+	// after the reviver stopped listening, so give up once the consumer is stopped instead of blocking forever
+	droppedChannel := ws.connectionDroppedChannel
+	connection.SetCloseHandler(func(code int, message string) error {
+		err := newCloseError(code, message)
+		ws.reportError(err)
+		select {
+		case droppedChannel <- err:
+		case <-stopChannel:
+		}
+		return nil
+	})
+
+	// Start up the dispatcher, which decodes and dispatches messages separately from this read loop. Closing the
+	// inbound channel on the way out lets it finish dispatching whatever was already read, then exit. When spilling,
+	// messages go through the spill queue instead, and the spiller closes the inbound channel once it's drained
+	var spill *spillQueue
+	inbound := make(chan *message, ws.configuration.getInboundBufferSize())
+	if ws.configuration.InboundSpillDir != "" {
+		spill = ws.newInboundSpill()
+	}
+	if spill != nil {
+		defer spill.close()
+		inbound = make(chan *message)
+		go ws.spiller(spill, inbound)
+	} else {
+		defer close(inbound)
+	}
+	go ws.dispatcher(inbound)
+
 	for {
 		select {
 
-		case <-ws.consumerStopChannel:
+		case <-stopChannel:
 			ws.configuration.Logger.Trace("CONSUMER: Shutting down")
 			return
 
 		default:
+
+			// If messages are being streamed, hand the next one straight to the stream handler
+			if handler := ws.getMessageStreamHandler(); handler != nil {
+				ws.configuration.Logger.Trace("CONSUMER: Streaming message...")
+				err := ws.readStream(connection, handler)
+				if err != nil {
+					ws.readFailed(err)
+					return
+				}
+				ws.configuration.Logger.Trace("CONSUMER: Successfully streamed message")
+				ws.refreshReadDeadline(connection)
+				continue
+			}
+
 			ws.configuration.Logger.Trace("CONSUMER: Reading message...")
-			_, message, err := connection.ReadMessage()
+			messageType, message, err := connection.ReadMessage()
 
-			// Connection dropped, stop consuming, clear the consumer stop channel, and kill this goroutine
+			// Connection dropped, stop consuming and kill this goroutine
 			if err != nil {
+				ws.readFailed(err)
+				return
+			}
+
+			ws.configuration.Logger.Trace("CONSUMER: Successfully read message")
+			ws.refreshReadDeadline(connection)
+			msg := newMessage(messageType, message)
+			msg.receivedAt = ws.now()
+			ws.throughput.received(len(message), msg.receivedAt)
+			ws.inboundSizes.record(len(message))
 
-				// If the network connection was closed, clean up the logged message
-				if strings.HasSuffix(err.Error(), "use of closed network connection") {
-					err = errors.New("client was closed")
+			// Spill the message if the dispatcher is behind, which never blocks the read loop
+			if spill != nil {
+				err = spill.push(msg)
+				if err != nil {
+					ws.reportError(err)
 				}
+				continue
+			}
 
-				// Write an error to the connection error channel and kill this goroutine
-				ws.configuration.Logger.Trace("CONSUMER: Failed to read message, flagging connection drop...")
-				ws.handleConnectionError(err)
-				ws.configuration.Logger.Trace("CONSUMER: Successfully flagged connection drop")
+			// Hand the message over to the dispatcher. If the buffer is full, this applies backpressure to the read loop
+			// rather than buffering without bound
+			select {
+			case inbound <- msg:
+			case <-stopChannel:
+				ws.configuration.Logger.Trace("CONSUMER: Shutting down")
 				return
 			}
-
-			// Handle the message in a goroutine
-			ws.configuration.Logger.Trace("CONSUMER: Successfully read message")
-			go func() {
-				ws.configuration.Logger.Trace("CONSUMER: Calling message handler...")
-				ws.messageHandler(message)
-				ws.configuration.Logger.Trace("CONSUMER: Successfully called message handler")
-			}()
 		}
 	}
 }
 
+// readFailed flags a connection drop after a failed read
+func (ws *Websocket) readFailed(err error) {
+
+	// If the network connection was closed underneath us, there's nothing to report. Otherwise, it's a genuine read
+	// failure that the application should hear about
+	err = wrapError(err)
+	if ClassifyError(err) != ErrorClosed {
+		ws.reportError(err)
+	}
+
+	// Write an error to the connection error channel
+	ws.configuration.Logger.Trace("CONSUMER: Failed to read message, flagging connection drop...")
+	ws.handleConnectionError(err)
+	ws.configuration.Logger.Trace("CONSUMER: Successfully flagged connection drop")
+}
+
 // startConsumer starts the websocket consumer
 func (ws *Websocket) startConsumer() {
 	ws.configuration.Logger.Trace("Starting consumer goroutine...")
 	ws.consumerStopChannel = make(chan struct{})
-	go ws.consumer()
+	go ws.consumer(ws.consumerStopChannel)
 	ws.configuration.Logger.Trace("Successfully started consumer goroutine")
 }
 
@@ -77,3 +155,8 @@ func (ws *Websocket) stopConsumer() {
 	close(ws.consumerStopChannel)
 	ws.configuration.Logger.Trace("Successfully stopped consumer goroutine")
 }
+
+// refreshReadDeadline pushes the read deadline of the connection back by the read timeout
+func (ws *Websocket) refreshReadDeadline(connection *websocket.Conn) {
+	_ = connection.SetReadDeadline(time.Now().Add(ws.configuration.ReadTimeout))
+}
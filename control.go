@@ -0,0 +1,89 @@
+package gows
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// pinger defines the goroutine responsible for sending pings. It runs alongside the sender and writes through the
+// control path, so keepalives are never starved by a large message being written or a saturated send queue. With
+// adaptive pings, the time until the next ping depends on whether the last one was answered
+func (ws *Websocket) pinger(stopChannel chan struct{}) {
+
+	// Set up the ping timer and shut it down when we exit this goroutine
+	pingTimer := time.NewTimer(ws.pingState.reset())
+	defer pingTimer.Stop()
+
+	for {
+		select {
+
+		// Stopped, kill this goroutine
+		case <-stopChannel:
+			ws.configuration.Logger.Trace("PINGER: Shutting down")
+			return
+
+		// Send a ping
+		case <-pingTimer.C:
+
+			// Get the connection. If it's nil, we're about to restarted. Ignore the ping and kill this goroutine, the
+			// reviver will restart us when a new connection comes in
+			connection := ws.getConnection()
+			if connection == nil {
+				ws.configuration.Logger.Trace("PINGER: No connection for ping, shutting down")
+				return
+			}
+
+			// Write the ping message. If there's a timeout, write the error and kill this goroutine
+			ws.configuration.Logger.Trace("PINGER: Writing ping message")
+			interval := ws.pingState.sent(ws.configuration.PingIntervalMin)
+			err := ws.writeControl(connection, websocket.PingMessage, ws.configuration.getPingPayload())
+			if err != nil {
+				ws.configuration.Logger.Trace("PINGER: Encountered ping timeout, flagging the websocket drop...")
+				ws.reportError(err)
+				ws.handleConnectionError(err)
+				ws.configuration.Logger.Trace("PINGER: Successfully flagged websocket drop")
+				return
+			}
+			ws.configuration.Logger.Trace("PINGER: Successfully wrote ping, next one in", interval)
+			pingTimer.Reset(interval)
+		}
+	}
+}
+
+// writeControl writes a control frame (ping, pong, or close) with its own deadline. Control frames can be written
+// concurrently with the sender's data frames, so they don't have to wait for the queue
+func (ws *Websocket) writeControl(connection *websocket.Conn, messageType int, data []byte) error {
+	return connection.WriteControl(messageType, data, time.Now().Add(ws.configuration.getControlWriteTimeout()))
+}
+
+// writePong answers a ping from the server with a pong carrying the same payload. A pong that can't be written because
+// we're closing the connection or a large message is holding up the connection is skipped, like gorilla's default ping
+// handler does, since the server will just ping again. Any other failure drops the connection
+func (ws *Websocket) writePong(connection *websocket.Conn, payload []byte) error {
+	ws.configuration.Logger.Trace("CONSUMER: Answering ping")
+	err := ws.writeControl(connection, websocket.PongMessage, payload)
+	if err == nil || errors.Is(err, websocket.ErrCloseSent) || ClassifyError(err) == ErrorTimeout {
+		return nil
+	}
+
+	return err
+}
+
+// writeClose writes a close frame with the supplied code and reason, ignoring failures since the connection is going
+// away regardless
+func (ws *Websocket) writeClose(connection *websocket.Conn, code int, reason string) {
+	err := ws.writeControl(connection, websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	if err != nil {
+		ws.configuration.Logger.Trace("Failed to write close frame:", err)
+	}
+}
+
+// getControlWriteTimeout gets the write timeout for control frames, falling back to the regular write timeout
+func (c *Configuration) getControlWriteTimeout() time.Duration {
+	if c.ControlWriteTimeout > 0 {
+		return c.ControlWriteTimeout
+	}
+
+	return c.WriteTimeout
+}
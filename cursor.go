@@ -0,0 +1,47 @@
+package gows
+
+import "fmt"
+
+// CursorInjector defines a function that builds a resubscribe message resuming a subscription from the supplied cursor
+type CursorInjector func(subscription []byte, cursor string) ([]byte, error)
+
+// SetCursor records the last seen position in the subscription's data, such as a sequence number or event ID. After a
+// reconnect, the configured cursor injector includes it in the resubscribe message so the server can resume from there
+func (s *Subscription) SetCursor(cursor string) {
+	s.subscriptions.lock.Lock()
+	s.cursor = cursor
+	s.subscriptions.lock.Unlock()
+}
+
+// Cursor gets the last seen position recorded with SetCursor
+func (s *Subscription) Cursor() string {
+	s.subscriptions.lock.Lock()
+	defer s.subscriptions.lock.Unlock()
+
+	return s.cursor
+}
+
+// OnCursorResult sets the handler called after a resubscribe with a cursor is confirmed, with the cursor that was sent
+// and whether the server honored it. When it wasn't honored, data between the cursor and the resubscribe was missed
+// and may need to be backfilled. Requires a SubscriptionMatcher and a CursorHonored function
+func (s *Subscription) OnCursorResult(handler func(cursor string, honored bool)) {
+	s.subscriptions.lock.Lock()
+	s.cursorHandler = handler
+	s.subscriptions.lock.Unlock()
+}
+
+// withCursor gets the message to replay for the subscription, with its cursor injected if it has one. Must be called
+// with the registry lock held
+func (s *Subscription) withCursor(injector CursorInjector) (*message, error) {
+	if s.cursor == "" || injector == nil {
+		return s.message, nil
+	}
+
+	data, err := injector(s.message.data, s.cursor)
+	if err != nil {
+		return s.message, fmt.Errorf("failed to inject cursor into resubscribe message: %w", err)
+	}
+
+	s.sentCursor = s.cursor
+	return newMessage(s.message.messageType, data), nil
+}
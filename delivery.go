@@ -0,0 +1,152 @@
+package gows
+
+import (
+	"fmt"
+	"sync"
+)
+
+// InboundAcks defines the at-least-once inbound mode, where the server keeps redelivering a message until the client
+// acknowledges it. Messages carrying a delivery ID are passed to the delivery handler along with a Delivery, which the
+// handler settles with Ack() or Nack()
+type InboundAcks struct {
+	DeliveryID  func(msg []byte) (string, bool)               // Extracts the delivery ID from an inbound message
+	Ack         func(id string) ([]byte, error)               // Builds the acknowledgement for a delivery
+	Nack        func(id string, requeue bool) ([]byte, error) // Builds the negative acknowledgement, nil if the protocol has none
+	MessageType int                                           // The frame type of acknowledgements, defaults to the default message type
+}
+
+// Delivery defines an inbound message awaiting acknowledgement. It's settled by the first call to Ack() or Nack(), and
+// later calls return ErrDeliverySettled
+type Delivery struct {
+	ID string // The delivery ID extracted from the message
+
+	ws      *Websocket
+	lock    *sync.Mutex
+	settled bool
+}
+
+// newDelivery constructs a new, unsettled delivery
+func (ws *Websocket) newDelivery(id string) *Delivery {
+	return &Delivery{
+		ID:   id,
+		ws:   ws,
+		lock: &sync.Mutex{},
+	}
+}
+
+// Ack acknowledges the delivery, telling the server it was processed
+func (d *Delivery) Ack() error {
+	if !d.settle() {
+		return ErrDeliverySettled
+	}
+
+	acks := d.ws.configuration.InboundAcks
+	data, err := acks.Ack(d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to build acknowledgement: %w", err)
+	}
+
+	return acks.send(d.ws, data)
+}
+
+// Nack rejects the delivery, telling the server whether to redeliver it. If the protocol has no negative
+// acknowledgement, the delivery is just left unacknowledged for the server to redeliver
+func (d *Delivery) Nack(requeue bool) error {
+	if !d.settle() {
+		return ErrDeliverySettled
+	}
+
+	acks := d.ws.configuration.InboundAcks
+	if acks.Nack == nil {
+		return nil
+	}
+
+	data, err := acks.Nack(d.ID, requeue)
+	if err != nil {
+		return fmt.Errorf("failed to build negative acknowledgement: %w", err)
+	}
+
+	return acks.send(d.ws, data)
+}
+
+// settle marks the delivery as settled, returning false if it already was
+func (d *Delivery) settle() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.settled {
+		return false
+	}
+
+	d.settled = true
+	return true
+}
+
+// send audits an acknowledgement and queues it with a high priority so it isn't stuck behind a backlog. The frame type
+// falls back to the websocket's default message type
+func (a *InboundAcks) send(ws *Websocket, data []byte) error {
+	messageType := a.MessageType
+	if messageType == 0 {
+		messageType = ws.configuration.getDefaultMessageType()
+	}
+
+	return ws.sendMessage(messageType, data, func(msg *message) {
+		msg.priority = PriorityHigh
+	})
+}
+
+// OnDelivery sets the onDelivery handler, called instead of the message handler for inbound messages carrying a
+// delivery ID when InboundAcks is configured. The handler settles the delivery with Ack() or Nack(). If it panics, the
+// delivery is rejected with a requeue before the panic is reported to the panic handler
+func (ws *Websocket) OnDelivery(handler func(msg []byte, delivery *Delivery)) {
+	ws.deliveryHandlerLock.Lock()
+	ws.deliveryHandler = handler
+	ws.deliveryHandlerLock.Unlock()
+}
+
+// getDeliveryHandler gets the delivery handler, or nil if none was set
+func (ws *Websocket) getDeliveryHandler() func([]byte, *Delivery) {
+	ws.deliveryHandlerLock.Lock()
+	defer ws.deliveryHandlerLock.Unlock()
+
+	return ws.deliveryHandler
+}
+
+// checkDelivery hands an inbound message carrying a delivery ID to the delivery handler using the supplied handle
+// function. Returns true if the message was handed over
+func (ws *Websocket) checkDelivery(msg []byte, handle func(func())) bool {
+	acks := ws.configuration.InboundAcks
+	if acks == nil || acks.DeliveryID == nil {
+		return false
+	}
+
+	handler := ws.getDeliveryHandler()
+	if handler == nil {
+		return false
+	}
+
+	id, ok := acks.DeliveryID(msg)
+	if !ok {
+		return false
+	}
+
+	delivery := ws.newDelivery(id)
+	handle(func() {
+
+		// Reject the delivery if the handler panics, so the server redelivers it instead of waiting for an ack
+		defer func() {
+			if r := recover(); r != nil {
+				ws.configuration.Logger.Warn("Delivery handler panicked, rejecting delivery", id)
+				_ = delivery.Nack(true)
+				panic(r)
+			}
+		}()
+
+		ws.configuration.Logger.Trace("DISPATCHER: Calling delivery handler...")
+		ws.measure("delivery", func() {
+			handler(msg, delivery)
+		})
+		ws.configuration.Logger.Trace("DISPATCHER: Successfully called delivery handler")
+	})
+	return true
+}
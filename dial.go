@@ -0,0 +1,100 @@
+package gows
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+)
+
+// dialTarget works out the URL and headers for the next connection attempt. The URL comes from the failover rotation
+// and the query from the configuration, unless the BeforeDial hook supplies fresh ones
+func (ws *Websocket) dialTarget(ctx context.Context) (string, http.Header, error) {
+	url, query, header := ws.baseURL(), ws.configuration.Query, http.Header(nil)
+
+	// Let the application regenerate the URL, query, and headers, e.g. to refresh an expiring token
+	if ws.configuration.BeforeDial != nil {
+		dialURL, dialQuery, dialHeader, err := ws.configuration.BeforeDial(ctx)
+		if err != nil {
+			return "", nil, fmt.Errorf("before dial hook failed: %w", err)
+		}
+
+		if dialURL != "" {
+			url = dialURL
+		}
+		if dialQuery != nil {
+			query = dialQuery.Encode()
+		}
+		header = dialHeader
+	}
+
+	// Log the URL before appending the query, which may contain credentials
+	ws.configuration.Logger.Info("Attempting connection to", url)
+
+	// Append the query parameters
+	if len(query) != 0 {
+		url = fmt.Sprintf("%s?%s", url, query)
+	}
+
+	return url, header, nil
+}
+
+// stopContext constructs a context that is cancelled when the supplied stop channel is closed
+func stopContext(stopChannel chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stopChannel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// cancellableDial adapts a network dial function to honor the context's deadline and cancellation, so a custom dialer
+// that hangs can't stall a connection attempt. A connection that arrives after the context is done is closed
+func cancellableDial(dial func(network string, addr string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		type result struct {
+			connection net.Conn
+			err        error
+		}
+
+		results := make(chan result, 1)
+		go func() {
+			connection, err := dial(network, addr)
+			results <- result{connection: connection, err: err}
+		}()
+
+		select {
+		case r := <-results:
+			return r.connection, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-results; r.connection != nil {
+					_ = r.connection.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checkSubprotocol validates the subprotocol selected by the server against the configured subprotocols. When any are
+// configured, the server must select one of them
+func (ws *Websocket) checkSubprotocol(connection *websocket.Conn) error {
+	if len(ws.configuration.Subprotocols) == 0 {
+		return nil
+	}
+
+	selected := connection.Subprotocol()
+	for _, subprotocol := range ws.configuration.Subprotocols {
+		if selected == subprotocol {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("server selected unacceptable subprotocol %q, expected one of %v", selected, ws.configuration.Subprotocols)
+}
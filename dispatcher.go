@@ -0,0 +1,151 @@
+package gows
+
+// defaultInboundBufferSize is the size of the buffer between the read loop and the dispatcher when none is configured
+const defaultInboundBufferSize = 256
+
+// dispatcher defines the goroutine responsible for decoding and dispatching inbound messages. It runs separately from
+// the consumer's network read loop, so slow extractors, listeners, or handlers never delay reading control frames. It
+// exits once the consumer closes the inbound channel and everything in it has been dispatched
+func (ws *Websocket) dispatcher(inbound <-chan *message) {
+
+	// Run handlers on a worker pool if one is configured, otherwise in a goroutine each, subject to the handler cap
+	handle := ws.handleWithLimiter
+	if concurrency := ws.configuration.getHandlerConcurrency(); concurrency > 0 {
+		ws.configuration.Logger.Trace("DISPATCHER: Starting", concurrency, "handler workers")
+		pool := newWorkerPool(concurrency)
+		defer pool.stop()
+		handle = pool.submit
+	}
+	handle = ws.traceHandlers(ws.recoverHandlers(handle))
+
+	for msg := range inbound {
+		start := ws.profiler.start()
+		ws.dispatch(msg, handle)
+		ws.profiler.dispatched(start)
+	}
+	ws.configuration.Logger.Trace("DISPATCHER: Shutting down")
+}
+
+// dispatch runs an inbound message through the inbound middleware, the TTL check, replay validation, the session,
+// request correlation, heartbeats, barriers, acknowledgements, the login flow, subscription confirmation, channels,
+// sampling, and the listeners, then hands it to the matching topic handlers, the delivery handler, or the message
+// channel and the message handler using the supplied handle function
+func (ws *Websocket) dispatch(msg *message, handle func(func())) {
+	messageType := msg.messageType
+
+	// Run the message through the inbound middleware, skipping it if it was dropped
+	data, ok := ws.applyInbound(msg.data)
+	if !ok {
+		ws.configuration.Logger.Trace("DISPATCHER: Inbound middleware dropped message")
+		return
+	}
+	ws.receivedTraffic(messageType, data, len(msg.data))
+
+	// Skip stale messages, which are often worse than no data after an outage
+	if !ws.checkTTL(data, ws.now()) {
+		ws.configuration.Logger.Debug("DISPATCHER: Dropped expired inbound message")
+		return
+	}
+
+	// Validate the message sequence, skipping it if it's a replay we're supposed to drop
+	if !ws.checkReplay(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Dropped replayed message")
+		return
+	}
+
+	// If the message is the session resume reply or a replay we already received, the session takes care of it
+	if ws.checkSession(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was handled by the session")
+		return
+	}
+
+	// If the message is a response to an in-flight request, hand it to the requester instead of the handler
+	if ws.resolveResponse(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message resolved an in-flight request")
+		return
+	}
+
+	// If the message is a heartbeat reply, the connection is alive
+	if ws.checkHeartbeat(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was a heartbeat reply")
+		return
+	}
+
+	// If the message is the echo of a barrier, release whoever is waiting on it
+	if ws.checkBarrier(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was a barrier echo")
+		return
+	}
+
+	// If the message acknowledges a reliable message, it's done
+	if ws.checkAck(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was an acknowledgement")
+		return
+	}
+
+	// If the message is the login reply, hand it to the login flow instead of the handler
+	if ws.checkLogin(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was the login reply")
+		return
+	}
+
+	// If the message confirms or rejects a subscription, notify the subscription instead of the handler
+	if ws.confirmSubscription(data) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message confirmed a subscription")
+		return
+	}
+
+	// If the message is framed for an open channel, hand it to the channel instead of the handler
+	if ws.routeChannel(messageType, data, handle) {
+		ws.configuration.Logger.Trace("DISPATCHER: Message was routed to a channel")
+		return
+	}
+
+	// Extract the topic, keeping track of the traffic on it
+	topic, hasTopic := ws.extractTopic(data)
+
+	// Skip messages that aren't sampled
+	if !ws.sampler.sample(topic, hasTopic) {
+		ws.inboundSampled.increment()
+		return
+	}
+
+	// Pass the message to any attached listeners
+	ws.listeners.notify(data)
+
+	// Hand the message to any matching topic handlers instead of the message handler
+	if hasTopic && ws.route(topic, data, handle) {
+		return
+	}
+
+	// Hand messages awaiting acknowledgement to the delivery handler instead of the message handler
+	if ws.checkDelivery(data, handle) {
+		return
+	}
+
+	// Deliver the message on the message channel, and hand it to the message handler
+	ws.deliverMessage(Message{Type: messageType, Data: data, ReceivedAt: msg.receivedAt})
+	handle(func() {
+		ws.configuration.Logger.Trace("DISPATCHER: Calling message handler...")
+		ws.measure("message", func() {
+			ws.messageHandler(messageType, data)
+		})
+		ws.configuration.Logger.Trace("DISPATCHER: Successfully called message handler")
+	})
+}
+
+// handleWithLimiter runs a message handler in a goroutine, subject to the handler cap
+func (ws *Websocket) handleWithLimiter(handler func()) {
+	if !ws.handlerLimiter.dispatch(handler) {
+		ws.configuration.Logger.Debug("DISPATCHER: Handler cap reached, dropped inbound message")
+	}
+}
+
+// getInboundBufferSize gets the size of the buffer between the read loop and the dispatcher
+func (c *Configuration) getInboundBufferSize() int {
+	if c.InboundBufferSize > 0 {
+		return c.InboundBufferSize
+	}
+
+	return defaultInboundBufferSize
+}
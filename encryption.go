@@ -0,0 +1,73 @@
+package gows
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// errSpoolDecrypt is the reason reported when a message written to disk can't be decrypted, e.g. because it was
+// tampered with or written with a different key
+var errSpoolDecrypt = errors.New("failed to decrypt spooled message")
+
+// spoolCipher defines the AES-GCM cipher messages are encrypted with before they're written to disk. Every message is
+// sealed with a random nonce, which is stored in front of the ciphertext. A nil cipher leaves messages as they are
+type spoolCipher struct {
+	aead cipher.AEAD
+}
+
+// newSpoolCipher constructs a cipher for the supplied key, which must be 16, 24, or 32 bytes long to select AES-128,
+// AES-192, or AES-256. Without a key, it returns a nil cipher that doesn't encrypt anything
+func newSpoolCipher(key []byte) (*spoolCipher, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spool encryption key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spool encryption key: %w", err)
+	}
+
+	return &spoolCipher{aead: aead}, nil
+}
+
+// seal encrypts a message, authenticating the additional data along with it, e.g. the header of the record it's
+// stored in
+func (c *spoolCipher) seal(plaintext []byte, additional []byte) ([]byte, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate spool encryption nonce: %w", err)
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open decrypts a message sealed with the same key and additional data
+func (c *spoolCipher) open(sealed []byte, additional []byte) ([]byte, error) {
+	if c == nil {
+		return sealed, nil
+	}
+
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errSpoolDecrypt
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, errSpoolDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,77 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+)
+
+// ErrorClass defines the broad category of an error reported by the websocket, so callers can decide how to react
+// without matching error strings
+type ErrorClass int
+
+// Error classes, from ClassifyError()
+const (
+	ErrorOther   ErrorClass = iota // The error isn't related to the connection, e.g. a message that couldn't be encoded
+	ErrorClosed                    // The connection was closed locally, e.g. by Disconnect(), while it was in use
+	ErrorRemote                    // The peer closed the connection with a close frame, see CloseError for the code
+	ErrorTimeout                   // A connect, read, or write deadline passed
+	ErrorNetwork                   // The connection broke, e.g. it was reset or the peer went away without a close frame
+)
+
+// String gets the name of the error class
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClosed:
+		return "closed"
+	case ErrorRemote:
+		return "remote"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorNetwork:
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// Connection determines if errors of the class mean the connection itself is unusable, as opposed to a single message
+// or operation failing
+func (c ErrorClass) Connection() bool {
+	return c != ErrorOther
+}
+
+// ClassifyError determines the class of an error reported or returned by the websocket, looking through any wrapping.
+// Close frames are recognized as both CloseError and gorilla's close error, and timeouts as ErrTimeout,
+// ErrConnectTimeout, context deadlines, and network errors reporting a timeout
+func ClassifyError(err error) ErrorClass {
+	var closeErr *CloseError
+	var gorillaCloseErr *websocket.CloseError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ErrorOther
+	case errors.As(err, &closeErr), errors.As(err, &gorillaCloseErr):
+		return ErrorRemote
+	case errors.Is(err, ErrClosed), errors.Is(err, net.ErrClosed), errors.Is(err, websocket.ErrCloseSent),
+		errors.Is(err, io.ErrClosedPipe):
+		return ErrorClosed
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrConnectTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorNetwork
+	}
+
+	return ErrorOther
+}
+
+// isConnectionError determines if a write error means the connection itself is broken, as opposed to the message being
+// unwritable
+func isConnectionError(err error) bool {
+	return ClassifyError(err).Connection()
+}
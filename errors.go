@@ -0,0 +1,176 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotConnected is returned when a message can't be sent because fail-fast mode is enabled and the websocket is
+	// not connected
+	ErrNotConnected = errors.New("websocket is not connected")
+
+	// ErrQueueFull is returned when a message can't be sent because the send queue is at its configured maximum size
+	ErrQueueFull = errors.New("send queue is full")
+
+	// ErrAlreadyStarted is returned when connecting a websocket that is already running
+	ErrAlreadyStarted = errors.New("websocket is already started")
+
+	// ErrDisconnected is returned by Connect() when the websocket was disconnected before the initial connection was
+	// established, and by WaitForConnected() when the websocket stops for good while waiting
+	ErrDisconnected = errors.New("websocket was disconnected")
+
+	// ErrShuttingDown is returned when a message can't be sent because the websocket is shutting down
+	ErrShuttingDown = errors.New("websocket is shutting down")
+
+	// ErrMessageTooLarge is returned when a message can't be sent because it's bigger than the configured maximum
+	// message size. The returned error wraps it with the message size and the limit
+	ErrMessageTooLarge = errors.New("message is too large")
+
+	// ErrConnectTimeout is returned when a connection attempt times out. The returned error wraps it along with the
+	// underlying network error
+	ErrConnectTimeout = errors.New("timed out connecting websocket")
+
+	// ErrClosed is reported when the network connection is closed underneath a read or write, e.g. by Disconnect().
+	// The reported error wraps it along with the underlying network error
+	ErrClosed = errors.New("websocket connection was closed")
+
+	// ErrTimeout is reported when a read or write deadline passes on an established connection. The reported error wraps
+	// it along with the underlying network error
+	ErrTimeout = errors.New("websocket connection timed out")
+
+	// ErrDeliverySettled is returned when acknowledging or rejecting a delivery that was already acknowledged or
+	// rejected
+	ErrDeliverySettled = errors.New("delivery was already settled")
+
+	// ErrFenced is reported when a message queued before a reconnect is discarded with DiscardFenced()
+	ErrFenced = errors.New("message was queued before a reconnect and discarded")
+
+	// ErrExpired is reported when a message sent with SendWithTTL is discarded because it expired in the queue
+	ErrExpired = errors.New("message expired before it was sent")
+
+	// ErrSuspended is reported when the connection is dropped because the machine was suspended
+	ErrSuspended = errors.New("connection dropped after a suspend")
+
+	// ErrQueueRecord is returned when a persisted queue record can't be decoded
+	ErrQueueRecord = errors.New("invalid queue record")
+)
+
+// CloseError defines the close frame a connection was closed with. It wraps gorilla's close error, so either can be
+// used with errors.As
+type CloseError struct {
+	Code   int    // The close code
+	Reason string // The close reason
+
+	err error // The underlying error
+}
+
+// newCloseError constructs a new close error for the supplied close code and reason
+func newCloseError(code int, reason string) *CloseError {
+	return &CloseError{
+		Code:   code,
+		Reason: reason,
+		err:    &websocket.CloseError{Code: code, Text: reason},
+	}
+}
+
+// Error gets the error message
+func (e *CloseError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap gets the underlying error
+func (e *CloseError) Unwrap() error {
+	return e.err
+}
+
+// ConnectDeadlineError is returned when the connect deadline passes before a connection is established. It lists the
+// error of every attempt, and matches ErrConnectTimeout with errors.Is
+type ConnectDeadlineError struct {
+	Deadline time.Duration // The configured connect deadline
+	Attempts []error       // The error of every attempt, in order
+}
+
+// Error gets the error message
+func (e *ConnectDeadlineError) Error() string {
+	attempts := make([]string, len(e.Attempts))
+	for i, err := range e.Attempts {
+		attempts[i] = fmt.Sprintf("attempt %d: %s", i+1, err)
+	}
+
+	return fmt.Sprintf("%s: gave up after %d attempts in %s (%s)", ErrConnectTimeout, len(e.Attempts), e.Deadline, strings.Join(attempts, "; "))
+}
+
+// Is determines if the error matches the supplied target
+func (e *ConnectDeadlineError) Is(target error) bool {
+	return target == ErrConnectTimeout
+}
+
+// Unwrap gets the error of the last attempt
+func (e *ConnectDeadlineError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// wrappedError defines an underlying error wrapped with one of the exported sentinel errors, so callers can match
+// either with errors.Is or errors.As
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+// Error gets the error message
+func (e *wrappedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.sentinel, e.err)
+}
+
+// Is determines if the error matches the supplied target
+func (e *wrappedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// Unwrap gets the underlying error
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// wrapError wraps an error returned by gorilla or the network with the matching exported error type, so callers can use
+// errors.Is and errors.As instead of matching error strings. Errors that don't match any of them are returned as is
+func wrapError(err error) error {
+	var closeErr *CloseError
+	var gorillaCloseErr *websocket.CloseError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &closeErr):
+		return err
+	case errors.As(err, &gorillaCloseErr):
+		return &CloseError{Code: gorillaCloseErr.Code, Reason: gorillaCloseErr.Text, err: err}
+	case errors.Is(err, net.ErrClosed):
+		return &wrappedError{sentinel: ErrClosed, err: err}
+	case errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, ErrTimeout):
+		return &wrappedError{sentinel: ErrTimeout, err: err}
+	}
+
+	return err
+}
+
+// wrapDialError wraps an error from a failed connection attempt, marking timeouts with ErrConnectTimeout
+func wrapDialError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &wrappedError{sentinel: ErrConnectTimeout, err: err}
+	}
+
+	return wrapError(err)
+}
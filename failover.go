@@ -0,0 +1,42 @@
+package gows
+
+// URLStrategy defines the order the reviver tries the configured URLs in
+type URLStrategy int
+
+const (
+	// URLRoundRobin moves on to the next URL after every failed attempt, and keeps using a URL for as long as it works
+	URLRoundRobin URLStrategy = iota
+
+	// URLPriority starts from the first URL on every connect and reconnect, only moving down the list on failures, so
+	// the websocket returns to the preferred endpoint whenever it's available
+	URLPriority
+)
+
+// baseURL gets the URL for the next connection attempt, before the query is appended
+func (ws *Websocket) baseURL() string {
+	if ws.configuration.URLProvider != nil {
+		return ws.configuration.URLProvider(ws.dialFailures)
+	}
+
+	if len(ws.configuration.URLs) == 0 {
+		return ws.configuration.URL
+	}
+
+	return ws.configuration.URLs[ws.urlIndex%len(ws.configuration.URLs)]
+}
+
+// startFailover prepares the URL rotation for a new round of connection attempts
+func (ws *Websocket) startFailover() {
+	ws.dialFailures = 0
+	if ws.configuration.URLStrategy == URLPriority {
+		ws.urlIndex = 0
+	}
+}
+
+// dialFailed moves on to the next URL after a failed connection attempt
+func (ws *Websocket) dialFailed() {
+	ws.dialFailures++
+	if len(ws.configuration.URLs) > 0 {
+		ws.urlIndex = (ws.urlIndex + 1) % len(ws.configuration.URLs)
+	}
+}
@@ -0,0 +1,111 @@
+package gows
+
+import "sync"
+
+// fence defines the thread-safe holding area for messages that were queued before a reconnect, while epoch fencing is
+// enabled
+type fence struct {
+	lock *sync.Mutex
+	held []*message
+}
+
+// newFence constructs a new, empty fence
+func newFence() *fence {
+	return &fence{
+		lock: &sync.Mutex{},
+		held: make([]*message, 0),
+	}
+}
+
+// hold adds messages to the fence, behind the ones already held. Returns the number of messages held
+func (f *fence) hold(msgs []*message) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.held = append(f.held, msgs...)
+	return len(f.held)
+}
+
+// take removes and returns every held message, in the order they were queued
+func (f *fence) take() []*message {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	held := f.held
+	f.held = make([]*message, 0)
+	return held
+}
+
+// length gets the number of held messages
+func (f *fence) length() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.held)
+}
+
+// Epoch gets the epoch of the current connection, which starts at 1 and goes up by one on every reconnect. Outbound
+// messages are tagged with the epoch they were queued in
+func (ws *Websocket) Epoch() uint64 {
+	return ws.getGeneration()
+}
+
+// OnFenced sets the onFenced handler, called after a reconnect with the new epoch and the number of messages held back
+// because they were queued in an earlier epoch. Only called when epoch fencing is enabled and messages were held. The
+// held messages stay fenced until ReleaseFenced() or DiscardFenced() is called
+func (ws *Websocket) OnFenced(handler func(epoch uint64, held int)) {
+	ws.fencedHandlerLock.Lock()
+	ws.fencedHandler = handler
+	ws.fencedHandlerLock.Unlock()
+}
+
+// ReleaseFenced confirms the new session, putting the messages held back by epoch fencing at the front of the send
+// queue in their original order. Returns the number of messages released
+func (ws *Websocket) ReleaseFenced() int {
+	held := ws.fence.take()
+	if len(held) > 0 {
+		ws.configuration.Logger.Debug("Releasing", len(held), "fenced messages")
+		ws.sendQueue.requeueAll(held)
+		ws.checkWatermarks()
+	}
+	return len(held)
+}
+
+// DiscardFenced drops the messages held back by epoch fencing, reporting each of them to the message dropped handler
+// with ErrFenced. Returns the number of messages discarded
+func (ws *Websocket) DiscardFenced() int {
+	held := ws.fence.take()
+	for _, msg := range held {
+		ws.dropMessage(msg.data, ErrFenced)
+		ws.unpersist(msg)
+	}
+	return len(held)
+}
+
+// FencedLength gets the number of messages held back by epoch fencing
+func (ws *Websocket) FencedLength() int {
+	return ws.fence.length()
+}
+
+// fenceStale moves every queued message from an earlier epoch out of the send queue and into the fence, so nothing
+// queued before a reconnect is sent in the new session until the application confirms it
+func (ws *Websocket) fenceStale(epoch uint64) {
+	if !ws.configuration.EpochFencing {
+		return
+	}
+
+	stale := ws.sendQueue.extract(func(msg *message) bool {
+		return msg.epoch < epoch
+	})
+	if len(stale) == 0 {
+		return
+	}
+
+	held := ws.fence.hold(stale)
+	ws.configuration.Logger.Debug("Fenced", len(stale), "messages queued before epoch", epoch)
+	ws.checkWatermarks()
+
+	ws.fencedHandlerLock.Lock()
+	ws.fencedHandler(epoch, held)
+	ws.fencedHandlerLock.Unlock()
+}
@@ -0,0 +1,288 @@
+package gows
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// Operations recorded in a file queue's log
+const (
+	fileQueueAppend = 'A'
+	fileQueueRemove = 'R'
+)
+
+// fileQueueHeaderSize is the size of a file queue entry header: the entry length, the operation, and the record ID
+const fileQueueHeaderSize = 4 + 1 + 8
+
+// fileQueueChecksumSize is the size of the checksum that follows every file queue entry
+const fileQueueChecksumSize = 4
+
+// fileQueueCheckpointMin is the number of removed records a file queue's log holds before it's checkpointed
+const fileQueueCheckpointMin = 1024
+
+// errFileQueueClosed is returned when a file queue is used after it's closed
+var errFileQueueClosed = errors.New("file queue is closed")
+
+// FileQueue defines a Queue kept in an append-only log file. Stored and removed records are appended to the log, and
+// stored records are synced to disk before Append returns, so a message is never lost once it's queued. A crash can
+// lose a removal, in which case the message is sent again after the restart. Once the log holds more removed records
+// than stored ones, it's checkpointed: the stored records are written to a fresh log that atomically replaces the old
+// one. A torn entry at the end of the log, left by a crash part way through a write, is discarded when it's opened
+type FileQueue struct {
+	lock    *sync.Mutex
+	path    string
+	file    *os.File          // The log, nil once the queue is closed
+	records map[uint64][]byte // The stored records
+	removed int               // The number of removed records still in the log
+}
+
+// NewFileQueue opens the file queue at the supplied path, creating it if it doesn't exist
+func NewFileQueue(path string) (*FileQueue, error) {
+	q := &FileQueue{
+		lock:    &sync.Mutex{},
+		path:    path,
+		records: make(map[uint64][]byte),
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	q.file = file
+
+	err = q.replay()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if q.removed >= fileQueueCheckpointMin {
+		err = q.checkpoint()
+		if err != nil {
+			_ = q.file.Close()
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// Append stores a record under the ID, syncing it to disk before returning
+func (q *FileQueue) Append(id uint64, record []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return errFileQueueClosed
+	}
+
+	err := q.write(fileQueueAppend, id, record)
+	if err != nil {
+		return err
+	}
+	err = q.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	q.records[id] = record
+	return nil
+}
+
+// Remove removes the record stored under the ID, checkpointing the log once it's mostly removed records. The removal
+// isn't synced to disk right away
+func (q *FileQueue) Remove(id uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return errFileQueueClosed
+	}
+	if _, ok := q.records[id]; !ok {
+		return nil
+	}
+
+	err := q.write(fileQueueRemove, id, nil)
+	if err != nil {
+		return err
+	}
+
+	delete(q.records, id)
+	q.removed++
+	if q.removed >= fileQueueCheckpointMin && q.removed > len(q.records) {
+		return q.checkpoint()
+	}
+	return nil
+}
+
+// Records gets every stored record
+func (q *FileQueue) Records() ([]StoredRecord, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return nil, errFileQueueClosed
+	}
+
+	records := make([]StoredRecord, 0, len(q.records))
+	for id, data := range q.records {
+		records = append(records, StoredRecord{ID: id, Data: data})
+	}
+	return records, nil
+}
+
+// Len gets the number of stored records
+func (q *FileQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.records)
+}
+
+// Checkpoint rewrites the log with only the stored records, reclaiming the space taken by removed ones
+func (q *FileQueue) Checkpoint() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return errFileQueueClosed
+	}
+	return q.checkpoint()
+}
+
+// Close syncs and closes the log. The queue can't be used afterwards, but it can be opened again with NewFileQueue()
+func (q *FileQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+
+	err := q.file.Sync()
+	closeErr := q.file.Close()
+	q.file = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// write appends an entry to the log. Must be called with the lock held
+func (q *FileQueue) write(operation byte, id uint64, record []byte) error {
+	_, err := q.file.Write(encodeFileQueueEntry(operation, id, record))
+	return err
+}
+
+// replay reads the log from the start, rebuilding the stored records. A torn or corrupted entry ends the log, and is
+// truncated along with anything after it. Must be called with the lock held
+func (q *FileQueue) replay() error {
+	contents, err := io.ReadAll(q.file)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for offset < len(contents) {
+		operation, id, record, size, ok := decodeFileQueueEntry(contents[offset:])
+		if !ok {
+			break
+		}
+		offset += size
+
+		switch operation {
+		case fileQueueAppend:
+			q.records[id] = record
+		case fileQueueRemove:
+			delete(q.records, id)
+			q.removed++
+		}
+	}
+
+	if offset < len(contents) {
+		err = q.file.Truncate(int64(offset))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = q.file.Seek(int64(offset), io.SeekStart)
+	return err
+}
+
+// checkpoint writes the stored records to a new log, then replaces the current log with it. Must be called with the
+// lock held
+func (q *FileQueue) checkpoint() error {
+	temporary := q.path + ".checkpoint"
+	file, err := os.OpenFile(temporary, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	fail := func(err error) error {
+		_ = file.Close()
+		_ = os.Remove(temporary)
+		return err
+	}
+
+	for id, record := range q.records {
+		_, err = file.Write(encodeFileQueueEntry(fileQueueAppend, id, record))
+		if err != nil {
+			return fail(err)
+		}
+	}
+	err = file.Sync()
+	if err != nil {
+		return fail(err)
+	}
+
+	err = os.Rename(temporary, q.path)
+	if err != nil {
+		return fail(err)
+	}
+
+	_ = q.file.Close()
+	q.file = file
+	q.removed = 0
+	return nil
+}
+
+// encodeFileQueueEntry encodes a log entry: the length of everything up to the checksum, the operation, the record ID,
+// the record, and a CRC32 checksum of the operation, ID, and record
+func encodeFileQueueEntry(operation byte, id uint64, record []byte) []byte {
+	entry := make([]byte, fileQueueHeaderSize+len(record)+fileQueueChecksumSize)
+	binary.BigEndian.PutUint32(entry, uint32(1+8+len(record)))
+	entry[4] = operation
+	binary.BigEndian.PutUint64(entry[5:], id)
+	copy(entry[fileQueueHeaderSize:], record)
+
+	checksum := crc32.ChecksumIEEE(entry[4 : fileQueueHeaderSize+len(record)])
+	binary.BigEndian.PutUint32(entry[fileQueueHeaderSize+len(record):], checksum)
+	return entry
+}
+
+// decodeFileQueueEntry decodes the log entry at the start of the data, returning its operation, record ID, record, and
+// total size. Returns false if the entry is truncated or fails its checksum
+func decodeFileQueueEntry(data []byte) (byte, uint64, []byte, int, bool) {
+	if len(data) < fileQueueHeaderSize+fileQueueChecksumSize {
+		return 0, 0, nil, 0, false
+	}
+
+	length := int(binary.BigEndian.Uint32(data))
+	if length < 1+8 || len(data)-4-fileQueueChecksumSize < length {
+		return 0, 0, nil, 0, false
+	}
+
+	end := 4 + length
+	if crc32.ChecksumIEEE(data[4:end]) != binary.BigEndian.Uint32(data[end:]) {
+		return 0, 0, nil, 0, false
+	}
+
+	record := make([]byte, end-fileQueueHeaderSize)
+	copy(record, data[fileQueueHeaderSize:end])
+	return data[4], binary.BigEndian.Uint64(data[5:]), record, end + fileQueueChecksumSize, true
+}
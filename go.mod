@@ -1,6 +1,6 @@
 module github.com/miratronix/gows
 
-go 1.14
+go 1.16
 
 require (
 	github.com/fatih/color v1.9.0 // indirect
@@ -0,0 +1,98 @@
+package gowstest
+
+import (
+	"runtime"
+	"strings"
+	"time"
+)
+
+// gowsPackage is the prefix of every function in the gows package, as it appears in a goroutine dump. The trailing dot
+// keeps this package's own goroutines out of it
+const gowsPackage = "github.com/miratronix/gows."
+
+// leakTimeout is how long VerifyNoLeaks waits for goroutines that are still winding down
+const leakTimeout = 2 * time.Second
+
+// leakPollInterval is how often VerifyNoLeaks checks if the goroutines have exited
+const leakPollInterval = 10 * time.Millisecond
+
+// TestingT defines the parts of *testing.T that VerifyNoLeaks uses
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// VerifyNoLeaks fails the test if any goroutine started by gows is still running, e.g. a reviver, sender, pinger,
+// consumer, dispatcher, or handler that outlived Disconnect(). Goroutines get a couple of seconds to finish winding
+// down before they count as leaked. Call it with defer at the start of a test, after the server is set up, and make
+// sure every websocket is disconnected before the test returns. It sees every goroutine in the process, so it can't
+// tell websockets of tests running in parallel apart
+func VerifyNoLeaks(t TestingT) {
+	t.Helper()
+
+	deadline := time.Now().Add(leakTimeout)
+	leaked := gowsGoroutines()
+	for len(leaked) > 0 && time.Now().Before(deadline) {
+		time.Sleep(leakPollInterval)
+		leaked = gowsGoroutines()
+	}
+
+	for _, goroutine := range leaked {
+		t.Errorf("gowstest: leaked goroutine %s\n%s", goroutine.name, goroutine.stack)
+	}
+}
+
+// goroutine defines a goroutine in a goroutine dump
+type goroutine struct {
+	name  string // The function the goroutine was started with, without the package, e.g. "(*Websocket).sender"
+	stack string // The goroutine's stack trace
+}
+
+// gowsGoroutines gets every running goroutine that was started with a function from the gows package
+func gowsGoroutines() []goroutine {
+	goroutines := make([]goroutine, 0)
+	for _, stack := range strings.Split(dumpGoroutines(), "\n\n") {
+		entry := entryFunction(stack)
+		if strings.HasPrefix(entry, gowsPackage) {
+			goroutines = append(goroutines, goroutine{
+				name:  strings.TrimPrefix(entry, gowsPackage),
+				stack: stack,
+			})
+		}
+	}
+	return goroutines
+}
+
+// entryFunction gets the function a goroutine was started with, which is the last function in its stack trace before
+// the line saying where it was created
+func entryFunction(stack string) string {
+	lines := strings.Split(stack, "\n")
+	entry := ""
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "created by ") {
+			break
+		}
+		if strings.HasPrefix(line, "\t") || line == "" {
+			continue
+		}
+
+		// Strip the arguments from a line like "github.com/miratronix/gows.(*Websocket).sender(0xc000010000, ...)"
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+		entry = line
+	}
+	return entry
+}
+
+// dumpGoroutines gets the stack traces of every goroutine, growing the buffer until they fit
+func dumpGoroutines() string {
+	buffer := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buffer, true)
+		if n < len(buffer) {
+			return string(buffer[:n])
+		}
+		buffer = make([]byte, 2*len(buffer))
+	}
+}
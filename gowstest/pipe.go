@@ -0,0 +1,93 @@
+package gowstest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// errListenerClosed is returned when accepting from, or dialing, a closed pipe listener
+var errListenerClosed = errors.New("gowstest: listener closed")
+
+// pipeAddr defines the address of both ends of an in-memory connection
+type pipeAddr struct{}
+
+// Network gets the name of the network
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+// String gets the address
+func (pipeAddr) String() string {
+	return "gowstest"
+}
+
+// pipeListener defines a net.Listener that accepts in-memory connections created with net.Pipe. Writes on both ends of
+// every connection are delayed by the injected latency
+type pipeListener struct {
+	connections chan net.Conn
+	stopChannel chan struct{}
+	stopOnce    *sync.Once
+	latency     func() time.Duration
+}
+
+// newPipeListener constructs a new pipe listener with the supplied latency function
+func newPipeListener(latency func() time.Duration) *pipeListener {
+	return &pipeListener{
+		connections: make(chan net.Conn),
+		stopChannel: make(chan struct{}),
+		stopOnce:    &sync.Once{},
+		latency:     latency,
+	}
+}
+
+// dial creates a new in-memory connection, handing the server end to the listener and returning the client end
+func (l *pipeListener) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.connections <- &latencyConn{Conn: server, latency: l.latency}:
+		return &latencyConn{Conn: client, latency: l.latency}, nil
+	case <-l.stopChannel:
+		_ = client.Close()
+		_ = server.Close()
+		return nil, errListenerClosed
+	}
+}
+
+// Accept waits for the next in-memory connection
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case connection := <-l.connections:
+		return connection, nil
+	case <-l.stopChannel:
+		return nil, errListenerClosed
+	}
+}
+
+// Close stops accepting connections
+func (l *pipeListener) Close() error {
+	l.stopOnce.Do(func() {
+		close(l.stopChannel)
+	})
+	return nil
+}
+
+// Addr gets the listener address
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// latencyConn defines a connection that delays every write by the latency of its server
+type latencyConn struct {
+	net.Conn
+	latency func() time.Duration
+}
+
+// Write waits for the injected latency, then writes to the underlying connection
+func (c *latencyConn) Write(p []byte) (int, error) {
+	if latency := c.latency(); latency > 0 {
+		time.Sleep(latency)
+	}
+	return c.Conn.Write(p)
+}
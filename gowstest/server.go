@@ -0,0 +1,294 @@
+// Package gowstest provides an in-memory websocket server for testing code built on gows. Websockets connect to it over
+// net.Pipe instead of a real network, so tests don't bind ports, and the server can script responses, inject latency,
+// refuse connections, and drop connections on demand to exercise reconnect behavior.
+package gowstest
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/miratronix/gows"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// URL is the websocket URL of every in-memory server. The address is never resolved, since connections are created by
+// the server's Dial function
+const URL = "ws://gowstest/"
+
+// ErrUnavailable is returned when dialing a server that was made unavailable with SetAvailable
+var ErrUnavailable = errors.New("gowstest: server unavailable")
+
+// Message defines a message received by the server
+type Message struct {
+	Type int    // The frame type, gows.TextMessage or gows.BinaryMessage
+	Data []byte // The message body
+}
+
+// responder defines a scripted response, returning the replies to send for a received message
+type responder func(msg []byte) [][]byte
+
+// Server defines an in-memory websocket server
+type Server struct {
+	listener *pipeListener
+	upgrader *websocket.Upgrader
+
+	lock        *sync.Mutex
+	connections map[*websocket.Conn]*sync.Mutex // Open connections, with a lock for writing to each
+	accepted    int                             // The number of connections accepted so far
+	available   bool                            // Whether new connections are accepted
+	latency     time.Duration                   // The delay injected before every write
+	responders  []responder                     // Scripted responses, in registration order
+	transcript  *Transcript                     // The transcript being played, if there is one
+
+	received chan Message
+}
+
+// NewServer constructs and starts a new in-memory server. Received messages are buffered up to the supplied size, after
+// which the oldest are discarded. A size of zero disables recording received messages
+func NewServer(bufferSize int) *Server {
+	s := &Server{
+		upgrader:    &websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		lock:        &sync.Mutex{},
+		connections: make(map[*websocket.Conn]*sync.Mutex),
+		available:   true,
+		responders:  make([]responder, 0),
+		received:    make(chan Message, bufferSize),
+	}
+	s.listener = newPipeListener(s.getLatency)
+
+	go func() {
+		_ = http.Serve(s.listener, http.HandlerFunc(s.serve))
+	}()
+
+	return s
+}
+
+// Configure points a websocket configuration at the server, setting the URL and the network dial function
+func (s *Server) Configure(configuration *gows.Configuration) *gows.Configuration {
+	configuration.URL = URL
+	configuration.NetDial = s.Dial
+	return configuration
+}
+
+// Dial creates a new in-memory connection to the server. It has the signature of the NetDial configuration field
+func (s *Server) Dial(_ string, _ string) (net.Conn, error) {
+	s.lock.Lock()
+	available := s.available
+	s.lock.Unlock()
+
+	if !available {
+		return nil, ErrUnavailable
+	}
+
+	return s.listener.dial()
+}
+
+// Close drops every connection and stops the server
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.Disconnect()
+}
+
+// SetAvailable determines whether the server accepts new connections. Dialing an unavailable server fails with
+// ErrUnavailable, which is useful for testing connection retries
+func (s *Server) SetAvailable(available bool) {
+	s.lock.Lock()
+	s.available = available
+	s.lock.Unlock()
+}
+
+// SetLatency sets the delay injected before every write, in both directions
+func (s *Server) SetLatency(latency time.Duration) {
+	s.lock.Lock()
+	s.latency = latency
+	s.lock.Unlock()
+}
+
+// getLatency gets the delay injected before every write
+func (s *Server) getLatency() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.latency
+}
+
+// Respond scripts the server to send the supplied replies whenever it receives a message that satisfies the matcher.
+// Replies are sent to the connection the message came in on, with the same frame type
+func (s *Server) Respond(match func(msg []byte) bool, replies ...[]byte) {
+	s.RespondWith(func(msg []byte) [][]byte {
+		if !match(msg) {
+			return nil
+		}
+		return replies
+	})
+}
+
+// RespondWith scripts the server to send the replies built by the supplied function for every message it receives.
+// Returning no replies leaves the message unanswered
+func (s *Server) RespondWith(respond func(msg []byte) [][]byte) {
+	s.lock.Lock()
+	s.responders = append(s.responders, respond)
+	s.lock.Unlock()
+}
+
+// Echo scripts the server to send every message it receives straight back
+func (s *Server) Echo() {
+	s.RespondWith(func(msg []byte) [][]byte {
+		return [][]byte{msg}
+	})
+}
+
+// Equals builds a matcher for Respond that matches messages equal to the supplied body
+func Equals(body []byte) func([]byte) bool {
+	return func(msg []byte) bool {
+		return bytes.Equal(msg, body)
+	}
+}
+
+// Send sends a message of the supplied frame type to every open connection
+func (s *Server) Send(messageType int, msg []byte) {
+	for connection, writeLock := range s.snapshot() {
+		s.write(connection, writeLock, messageType, msg)
+	}
+}
+
+// Received gets the channel of messages received by the server, across all connections
+func (s *Server) Received() <-chan Message {
+	return s.received
+}
+
+// Disconnect drops every open connection without a close frame, as if the network failed
+func (s *Server) Disconnect() {
+	for connection := range s.snapshot() {
+		_ = connection.Close()
+	}
+}
+
+// CloseWith closes every open connection with a close frame carrying the supplied code and reason
+func (s *Server) CloseWith(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	for connection, writeLock := range s.snapshot() {
+		writeLock.Lock()
+		_ = connection.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		writeLock.Unlock()
+		_ = connection.Close()
+	}
+}
+
+// Connections gets the number of connections currently open
+func (s *Server) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.connections)
+}
+
+// Accepted gets the number of connections accepted since the server started, which counts reconnects
+func (s *Server) Accepted() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.accepted
+}
+
+// snapshot gets a copy of the open connections
+func (s *Server) snapshot() map[*websocket.Conn]*sync.Mutex {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	connections := make(map[*websocket.Conn]*sync.Mutex, len(s.connections))
+	for connection, writeLock := range s.connections {
+		connections[connection] = writeLock
+	}
+	return connections
+}
+
+// serve upgrades an in-memory connection and reads from it until it's closed, answering scripted responses
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	connection, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	writeLock := &sync.Mutex{}
+	s.lock.Lock()
+	s.connections[connection] = writeLock
+	s.accepted++
+	s.lock.Unlock()
+
+	// Send the transcript's leading frames
+	if transcript := s.getTranscript(); transcript != nil {
+		for _, reply := range transcript.replies() {
+			s.write(connection, writeLock, reply.Type, reply.Data)
+		}
+	}
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.connections, connection)
+		s.lock.Unlock()
+		_ = connection.Close()
+	}()
+
+	for {
+		messageType, msg, err := connection.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		s.record(Message{Type: messageType, Data: msg})
+		for _, reply := range s.replies(msg) {
+			s.write(connection, writeLock, messageType, reply)
+		}
+		if transcript := s.getTranscript(); transcript != nil {
+			for _, reply := range transcript.receive(msg) {
+				s.write(connection, writeLock, reply.Type, reply.Data)
+			}
+		}
+	}
+}
+
+// record adds a received message to the received channel, discarding the oldest message if it's full
+func (s *Server) record(msg Message) {
+	if cap(s.received) == 0 {
+		return
+	}
+
+	for {
+		select {
+		case s.received <- msg:
+			return
+		default:
+		}
+
+		select {
+		case <-s.received:
+		default:
+		}
+	}
+}
+
+// replies gets the scripted replies to a received message, in the order the responses were registered
+func (s *Server) replies(msg []byte) [][]byte {
+	s.lock.Lock()
+	responders := s.responders
+	s.lock.Unlock()
+
+	replies := make([][]byte, 0)
+	for _, respond := range responders {
+		replies = append(replies, respond(msg)...)
+	}
+	return replies
+}
+
+// write writes a message to a connection, holding its write lock
+func (s *Server) write(connection *websocket.Conn, writeLock *sync.Mutex, messageType int, msg []byte) {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	_ = connection.SetWriteDeadline(time.Now().Add(time.Second + s.getLatency()))
+	_ = connection.WriteMessage(messageType, msg)
+}
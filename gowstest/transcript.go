@@ -0,0 +1,161 @@
+package gowstest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// step defines a single frame in a transcript, either one the websocket is expected to send, or one the server sends
+type step struct {
+	expected    bool              // Whether the websocket is expected to send the frame, rather than the server
+	messageType int               // The frame type the server sends
+	data        []byte            // The frame body
+	match       func([]byte) bool // Matches the frame the websocket sent
+	description string            // Describes the expected frame in mismatch errors
+}
+
+// Transcript defines a scripted exchange of frames between a websocket and the server, used to validate that a
+// protocol adapter (a login flow, RPC correlation, subscription handling, and the like) produces and consumes the
+// frames the protocol calls for, entirely in memory. Frames are expected and replied in the order they're added
+type Transcript struct {
+	lock     *sync.Mutex
+	steps    []step
+	position int           // The index of the next step to play
+	err      error         // The first mismatch, if there was one
+	done     chan struct{} // Channel closed when the transcript completes or fails
+}
+
+// NewTranscript constructs a new, empty transcript
+func NewTranscript() *Transcript {
+	return &Transcript{
+		lock:  &sync.Mutex{},
+		steps: make([]step, 0),
+		done:  make(chan struct{}),
+	}
+}
+
+// Expect adds a frame the websocket is expected to send, which must be equal to the supplied body
+func (t *Transcript) Expect(body []byte) *Transcript {
+	return t.ExpectMatching(fmt.Sprintf("%q", body), Equals(body))
+}
+
+// ExpectMatching adds a frame the websocket is expected to send, which must satisfy the matcher. The description is
+// used in the mismatch error
+func (t *Transcript) ExpectMatching(description string, match func([]byte) bool) *Transcript {
+	t.lock.Lock()
+	t.steps = append(t.steps, step{expected: true, match: match, description: description})
+	t.lock.Unlock()
+	return t
+}
+
+// Reply adds a frame the server sends once every frame before it was played
+func (t *Transcript) Reply(messageType int, body []byte) *Transcript {
+	t.lock.Lock()
+	t.steps = append(t.steps, step{messageType: messageType, data: body})
+	t.lock.Unlock()
+	return t
+}
+
+// Wait waits for the transcript to complete, returning the first mismatch, or an error describing the next step if the
+// transcript didn't complete within the timeout
+func (t *Transcript) Wait(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-t.done:
+	case <-timer.C:
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+
+	if t.position < len(t.steps) {
+		return fmt.Errorf("gowstest: transcript timed out at step %d, waiting for %s", t.position+1, t.steps[t.position].describe())
+	}
+
+	return nil
+}
+
+// describe describes a step for error messages
+func (s step) describe() string {
+	if s.expected {
+		return "the websocket to send " + s.description
+	}
+	return fmt.Sprintf("the server to send %q", s.data)
+}
+
+// replies gets the frames the server sends from the current position, up to the next expected frame
+func (t *Transcript) replies() []Message {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.advance()
+}
+
+// receive plays a frame sent by the websocket against the transcript, returning the frames the server sends in reply.
+// Frames received after the transcript completed or failed are ignored
+func (t *Transcript) receive(msg []byte) []Message {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.err != nil || t.position >= len(t.steps) {
+		return nil
+	}
+
+	expected := t.steps[t.position]
+	if !expected.match(msg) {
+		t.err = fmt.Errorf("gowstest: transcript step %d expected %s, got %q", t.position+1, expected.describe(), msg)
+		close(t.done)
+		return nil
+	}
+
+	t.position++
+	return t.advance()
+}
+
+// advance collects the server's frames from the current position, closing the done channel once every step was
+// played. Must be called with the lock held
+func (t *Transcript) advance() []Message {
+	if t.err != nil {
+		return nil
+	}
+
+	replies := make([]Message, 0)
+	for t.position < len(t.steps) && !t.steps[t.position].expected {
+		replies = append(replies, Message{Type: t.steps[t.position].messageType, Data: t.steps[t.position].data})
+		t.position++
+	}
+
+	if t.position == len(t.steps) {
+		select {
+		case <-t.done:
+		default:
+			close(t.done)
+		}
+	}
+
+	return replies
+}
+
+// Play plays the transcript against the websockets connected to the server. The server's leading frames are sent as
+// soon as a websocket connects, and every frame the websocket sends after that must match the next expected frame.
+// Scripted responses are still sent alongside the transcript
+func (s *Server) Play(transcript *Transcript) {
+	s.lock.Lock()
+	s.transcript = transcript
+	s.lock.Unlock()
+}
+
+// getTranscript gets the transcript being played, if there is one
+func (s *Server) getTranscript() *Transcript {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.transcript
+}
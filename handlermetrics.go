@@ -0,0 +1,137 @@
+package gows
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// handlerLatencySamples is the number of recent invocations latency percentiles are computed over, per handler
+const handlerLatencySamples = 1024
+
+// HandlerMetrics defines a snapshot of one handler's execution metrics. Percentiles are computed over the most recent
+// invocations
+type HandlerMetrics struct {
+	Invocations uint64        // The number of times the handler was called
+	Panics      uint64        // The number of invocations that panicked
+	TotalTime   time.Duration // The total time spent in the handler
+	P50         time.Duration // The median latency
+	P90         time.Duration // The 90th percentile latency
+	P99         time.Duration // The 99th percentile latency
+	Max         time.Duration // The slowest invocation
+}
+
+// handlerMetric defines the running measurements of a single handler
+type handlerMetric struct {
+	metrics HandlerMetrics
+	samples []time.Duration // A ring of the most recent latencies
+	next    int             // Where the next latency goes in the ring
+}
+
+// handlerMetrics defines the thread-safe registry of execution metrics for every handler, keyed by handler name
+type handlerMetrics struct {
+	lock     *sync.Mutex
+	enabled  bool
+	handlers map[string]*handlerMetric
+}
+
+// newHandlerMetrics constructs a new handler metrics registry, which does nothing unless it's enabled
+func newHandlerMetrics(enabled bool) *handlerMetrics {
+	return &handlerMetrics{
+		lock:     &sync.Mutex{},
+		enabled:  enabled,
+		handlers: make(map[string]*handlerMetric),
+	}
+}
+
+// record records an invocation of the named handler
+func (m *handlerMetrics) record(name string, latency time.Duration, panicked bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	metric, ok := m.handlers[name]
+	if !ok {
+		metric = &handlerMetric{samples: make([]time.Duration, 0, handlerLatencySamples)}
+		m.handlers[name] = metric
+	}
+
+	metric.metrics.Invocations++
+	metric.metrics.TotalTime += latency
+	if panicked {
+		metric.metrics.Panics++
+	}
+	if latency > metric.metrics.Max {
+		metric.metrics.Max = latency
+	}
+
+	if len(metric.samples) < handlerLatencySamples {
+		metric.samples = append(metric.samples, latency)
+	} else {
+		metric.samples[metric.next] = latency
+	}
+	metric.next = (metric.next + 1) % handlerLatencySamples
+}
+
+// snapshot gets a copy of the metrics of every handler, computing the latency percentiles
+func (m *handlerMetrics) snapshot() map[string]HandlerMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshot := make(map[string]HandlerMetrics, len(m.handlers))
+	for name, metric := range m.handlers {
+		sorted := make([]time.Duration, len(metric.samples))
+		copy(sorted, metric.samples)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+
+		metrics := metric.metrics
+		metrics.P50 = percentile(sorted, 0.5)
+		metrics.P90 = percentile(sorted, 0.9)
+		metrics.P99 = percentile(sorted, 0.99)
+		snapshot[name] = metrics
+	}
+	return snapshot
+}
+
+// percentile gets the supplied percentile of sorted latencies, using the nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// HandlerMetrics gets invocation counts, panic counts, and latency percentiles for every handler that has run, when
+// handler metrics are enabled (also included in Stats()). Handlers are named "message" for the message handler,
+// "delivery" for the delivery handler, "topic:" followed by the pattern for topic handlers, "channel:" followed by the
+// name for channel handlers, and "pubsub:" followed by the pattern for publish/subscribe handlers
+func (ws *Websocket) HandlerMetrics() map[string]HandlerMetrics {
+	return ws.handlerMetrics.snapshot()
+}
+
+// measure calls the named handler, recording how long it took and whether it panicked when handler metrics are
+// enabled. Panics are passed on once they're recorded
+func (ws *Websocket) measure(name string, handler func()) {
+	if !ws.handlerMetrics.enabled {
+		handler()
+		return
+	}
+
+	start := time.Now()
+	panicked := true
+	defer func() {
+		ws.handlerMetrics.record(name, time.Since(start), panicked)
+	}()
+
+	handler()
+	panicked = false
+}
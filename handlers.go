@@ -0,0 +1,100 @@
+package gows
+
+import "sync"
+
+// HandlerOverflowPolicy defines what the consumer does with inbound messages when the handler cap is reached
+type HandlerOverflowPolicy int
+
+const (
+	// HandlerOverflowQueue holds messages until a running handler finishes
+	HandlerOverflowQueue HandlerOverflowPolicy = iota
+
+	// HandlerOverflowDrop discards messages that arrive while the handler cap is reached
+	HandlerOverflowDrop
+)
+
+// HandlerStats defines a snapshot of message handler concurrency
+type HandlerStats struct {
+	Running    int    // The number of handlers currently running
+	Peak       int    // The highest number of handlers that have run at once
+	Queued     int    // The number of messages currently waiting for a handler slot
+	Overflowed uint64 // The number of messages that arrived while the handler cap was reached
+	Dropped    uint64 // The number of messages dropped because the handler cap was reached
+}
+
+// handlerLimiter defines a thread-safe cap on the number of concurrently running message handlers
+type handlerLimiter struct {
+	lock    *sync.Mutex
+	max     int
+	policy  HandlerOverflowPolicy
+	pending []func()
+	stats   HandlerStats
+}
+
+// newHandlerLimiter constructs a new handler limiter. A max of zero disables the cap
+func newHandlerLimiter(max int, policy HandlerOverflowPolicy) *handlerLimiter {
+	return &handlerLimiter{
+		lock:    &sync.Mutex{},
+		max:     max,
+		policy:  policy,
+		pending: make([]func(), 0),
+	}
+}
+
+// dispatch runs the handler in a goroutine if there's a free slot, otherwise queueing or dropping it per the overflow
+// policy. Returns false if the handler was dropped
+func (l *handlerLimiter) dispatch(handler func()) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// There's a free slot (or no cap at all), run the handler right away
+	if l.max <= 0 || l.stats.Running < l.max {
+		l.stats.Running++
+		if l.stats.Running > l.stats.Peak {
+			l.stats.Peak = l.stats.Running
+		}
+		go l.run(handler)
+		return true
+	}
+
+	// No free slot, queue or drop it
+	l.stats.Overflowed++
+	if l.policy == HandlerOverflowDrop {
+		l.stats.Dropped++
+		return false
+	}
+
+	l.pending = append(l.pending, handler)
+	l.stats.Queued = len(l.pending)
+	return true
+}
+
+// run runs a handler, then keeps the slot busy with queued handlers until there are none left
+func (l *handlerLimiter) run(handler func()) {
+	for handler != nil {
+		handler()
+
+		l.lock.Lock()
+		if len(l.pending) == 0 {
+			l.stats.Running--
+			handler = nil
+		} else {
+			handler, l.pending = l.pending[0], l.pending[1:]
+			l.stats.Queued = len(l.pending)
+		}
+		l.lock.Unlock()
+	}
+}
+
+// snapshot gets a copy of the current handler stats
+func (l *handlerLimiter) snapshot() HandlerStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.stats
+}
+
+// HandlerStats gets a snapshot of message handler concurrency
+func (ws *Websocket) HandlerStats() HandlerStats {
+	return ws.handlerLimiter.snapshot()
+}
@@ -0,0 +1,195 @@
+package gows
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxPingPayload is the largest payload a ping control frame can carry
+const maxPingPayload = 125
+
+// errHeartbeatTimeout is reported when the server doesn't reply to a heartbeat in time
+var errHeartbeatTimeout = errors.New("timed out waiting for heartbeat reply")
+
+// Heartbeat defines an application-level heartbeat, for servers or proxies that ignore protocol-level pings. The
+// heartbeat message is sent on the interval, and if the reply doesn't arrive within the timeout, the connection is
+// dropped and the reviver reconnects. Replies refresh the read deadline like pongs do, and aren't passed to the
+// message handler
+type Heartbeat struct {
+	Message     func() ([]byte, error) // Builds the heartbeat message, e.g. {"type":"ping"}
+	Reply       func(msg []byte) bool  // Recognizes the reply to a heartbeat, e.g. {"type":"pong"}
+	Interval    time.Duration          // How often the heartbeat is sent
+	Timeout     time.Duration          // How long to wait for the reply, defaults to the interval
+	MessageType int                    // The frame type of the heartbeat message, defaults to the default message type
+}
+
+// heartbeatState defines the thread-safe state of the application-level heartbeat
+type heartbeatState struct {
+	lock     *sync.Mutex
+	awaiting bool          // Whether a heartbeat reply is expected
+	replied  chan struct{} // Signaled when the reply arrives
+}
+
+// newHeartbeatState constructs a new heartbeat state with no heartbeat outstanding
+func newHeartbeatState() *heartbeatState {
+	return &heartbeatState{
+		lock:    &sync.Mutex{},
+		replied: make(chan struct{}, 1),
+	}
+}
+
+// reset forgets the outstanding heartbeat when a new connection starts, since its reply will never arrive
+func (h *heartbeatState) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.awaiting = false
+	select {
+	case <-h.replied:
+	default:
+	}
+}
+
+// sent starts waiting for a reply, forgetting any reply signaled for an earlier heartbeat
+func (h *heartbeatState) sent() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.awaiting = true
+	select {
+	case <-h.replied:
+	default:
+	}
+}
+
+// reply records a reply, returning false if no heartbeat was waiting for one
+func (h *heartbeatState) reply() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.awaiting {
+		return false
+	}
+
+	h.awaiting = false
+	select {
+	case h.replied <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// heartbeater defines the goroutine responsible for sending application-level heartbeats and dropping the connection
+// when a reply doesn't arrive in time. Heartbeats go to the front of the send queue, and are skipped while the queue is
+// blocked, since they couldn't be sent anyway
+func (ws *Websocket) heartbeater(stopChannel chan struct{}) {
+	heartbeat := ws.configuration.Heartbeat
+	ws.heartbeatState.reset()
+
+	heartbeatTicker := time.NewTicker(heartbeat.Interval)
+	defer heartbeatTicker.Stop()
+
+	var timeout <-chan time.Time
+	var timeoutTimer *time.Timer
+	defer func() {
+		if timeoutTimer != nil {
+			timeoutTimer.Stop()
+		}
+	}()
+
+	for {
+		select {
+
+		// Stopped, kill this goroutine
+		case <-stopChannel:
+			ws.configuration.Logger.Trace("HEARTBEAT: Shutting down")
+			return
+
+		// The reply arrived, stop waiting for it
+		case <-ws.heartbeatState.replied:
+			ws.configuration.Logger.Trace("HEARTBEAT: Received heartbeat reply")
+			if timeoutTimer != nil {
+				timeoutTimer.Stop()
+			}
+			timeout = nil
+
+		// The reply didn't arrive in time, flag the websocket drop and kill this goroutine
+		case <-timeout:
+			ws.configuration.Logger.Debug("HEARTBEAT: Heartbeat reply timed out, flagging the websocket drop...")
+			err := &wrappedError{sentinel: ErrTimeout, err: errHeartbeatTimeout}
+			ws.reportError(err)
+			ws.handleConnectionError(err)
+			return
+
+		// Send a heartbeat, unless the last one is still waiting for its reply or sending is blocked
+		case <-heartbeatTicker.C:
+			if _, blocked := ws.sendQueue.depth(); timeout != nil || blocked {
+				continue
+			}
+
+			data, err := heartbeat.Message()
+			if err != nil {
+				ws.reportError(fmt.Errorf("failed to build heartbeat message: %w", err))
+				continue
+			}
+
+			messageType := heartbeat.MessageType
+			if messageType == 0 {
+				messageType = ws.configuration.getDefaultMessageType()
+			}
+
+			msg, ok := ws.auditMessage(newMessage(messageType, data))
+			if !ok {
+				continue
+			}
+
+			ws.configuration.Logger.Trace("HEARTBEAT: Sending heartbeat")
+			ws.heartbeatState.sent()
+			ws.sendQueue.requeue(msg)
+			timeoutTimer = time.NewTimer(heartbeat.getTimeout())
+			timeout = timeoutTimer.C
+		}
+	}
+}
+
+// checkHeartbeat matches an inbound message against the heartbeat reply, refreshing the read deadline if it is one.
+// Returns true if the message was consumed
+func (ws *Websocket) checkHeartbeat(msg []byte) bool {
+	heartbeat := ws.configuration.Heartbeat
+	if heartbeat == nil || heartbeat.Reply == nil || !heartbeat.Reply(msg) {
+		return false
+	}
+
+	if connection := ws.getConnection(); connection != nil {
+		ws.refreshReadDeadline(connection)
+	}
+	if !ws.heartbeatState.reply() {
+		ws.configuration.Logger.Debug("Received heartbeat reply without an outstanding heartbeat")
+	}
+	return true
+}
+
+// heartbeatEnabled determines if application-level heartbeats are configured
+func (c *Configuration) heartbeatEnabled() bool {
+	return c.Heartbeat != nil && c.Heartbeat.Message != nil && c.Heartbeat.Interval > 0
+}
+
+// getTimeout gets how long to wait for a heartbeat reply
+func (h *Heartbeat) getTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+
+	return h.Interval
+}
+
+// getPingPayload gets the payload of protocol-level pings, leaving it out if it's too big for a control frame
+func (c *Configuration) getPingPayload() []byte {
+	if len(c.PingPayload) > maxPingPayload {
+		return nil
+	}
+
+	return c.PingPayload
+}
@@ -0,0 +1,128 @@
+package gows
+
+import "sync"
+
+// backlog defines the thread-safe holding area for messages queued before a connection was established, which are
+// held back while the connected handler runs
+type backlog struct {
+	lock     *sync.Mutex
+	held     []*message
+	holding  bool // Whether the connected handler is running
+	extended bool // Whether HoldQueue() was called, so the messages stay held once the connected handler returns
+}
+
+// newBacklog constructs a new, empty backlog
+func newBacklog() *backlog {
+	return &backlog{
+		lock: &sync.Mutex{},
+		held: make([]*message, 0),
+	}
+}
+
+// start holds messages while the connected handler runs, behind any still held from an earlier connection
+func (b *backlog) start(msgs []*message) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.held = append(b.held, msgs...)
+	b.holding = true
+	b.extended = false
+}
+
+// extend keeps the messages held once the connected handler returns. Returns false if the handler isn't running
+func (b *backlog) extend() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.holding {
+		return false
+	}
+
+	b.extended = true
+	return true
+}
+
+// end marks the connected handler as returned, determining if the messages should be released
+func (b *backlog) end() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.holding = false
+	return !b.extended
+}
+
+// take removes and returns every held message, in the order they were queued
+func (b *backlog) take() []*message {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	held := b.held
+	b.held = make([]*message, 0)
+	b.extended = false
+	return held
+}
+
+// length gets the number of held messages
+func (b *backlog) length() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.held)
+}
+
+// HoldQueue keeps the messages queued before the current connection held after the connected handler returns, until
+// ReleaseQueue() is called, e.g. while waiting for the reply to an authentication message. Messages sent in the
+// meantime go out ahead of them. Only has an effect when called from the connected handler, and returns false
+// otherwise
+func (ws *Websocket) HoldQueue() bool {
+	return ws.backlog.extend()
+}
+
+// ReleaseQueue releases the messages held by HoldQueue(), queueing them behind everything sent since the connection was
+// established. Returns the number of messages released
+func (ws *Websocket) ReleaseQueue() int {
+	held := ws.backlog.take()
+	for _, msg := range held {
+		ws.sendQueue.push(msg)
+	}
+
+	if len(held) > 0 {
+		ws.configuration.Logger.Debug("Released", len(held), "messages held since the connection was established")
+		ws.checkWatermarks()
+	}
+	return len(held)
+}
+
+// HeldLength gets the number of messages held back while the connected handler runs, or until ReleaseQueue() is called
+func (ws *Websocket) HeldLength() int {
+	return ws.backlog.length()
+}
+
+// holdBacklog moves everything in the send queue into the backlog before the connected handler runs, so messages it
+// sends, e.g. login or subscription messages, go out first
+func (ws *Websocket) holdBacklog() {
+	if ws.configuration.DisableConnectHold {
+		return
+	}
+
+	held := ws.sendQueue.extract(func(*message) bool {
+		return true
+	})
+	ws.backlog.start(held)
+	if len(held) > 0 {
+		ws.configuration.Logger.Trace("Holding", len(held), "queued messages while the connection handler runs")
+	}
+}
+
+// endHold releases the backlog once the connected handler returns, unless the handler asked to keep holding it
+func (ws *Websocket) endHold() {
+	if ws.configuration.DisableConnectHold {
+		return
+	}
+
+	if ws.backlog.end() {
+		ws.ReleaseQueue()
+	} else {
+		ws.configuration.Logger.Debug("Holding", ws.backlog.length(), "queued messages until ReleaseQueue() is called")
+	}
+}
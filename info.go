@@ -0,0 +1,24 @@
+package gows
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConnectionInfo defines the metadata describing a successfully established connection
+type ConnectionInfo struct {
+	Reconnect  bool          // Whether the connection replaced a dropped one, as opposed to being the initial connection
+	Generation uint64        // The connection generation, incremented on every new connection
+	Attempts   int           // The number of attempts it took to connect
+	Downtime   time.Duration // How long the websocket was disconnected before this connection, zero for the initial one
+}
+
+// String formats the connection info as a log line with machine-readable fields
+func (i ConnectionInfo) String() string {
+	if !i.Reconnect {
+		return fmt.Sprintf("Connected websocket [event=connect generation=%d attempts=%d]", i.Generation, i.Attempts)
+	}
+
+	return fmt.Sprintf("Reconnected websocket [event=reconnect generation=%d attempts=%d downtime=%s]",
+		i.Generation, i.Attempts, i.Downtime)
+}
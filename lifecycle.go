@@ -0,0 +1,88 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// Lifecycle event types
+const (
+	EventConnected    = "connected"    // A connection was established
+	EventDisconnected = "disconnected" // A connection was closed or dropped
+	EventGaveUp       = "gave_up"      // The websocket stopped trying to connect
+)
+
+// LifecycleEvent defines a connection lifecycle event, as reported to webhooks
+type LifecycleEvent struct {
+	Type       string        `json:"type"`                 // The event type, e.g. EventConnected
+	Time       time.Time     `json:"time"`                 // When the event happened
+	Generation uint64        `json:"generation,omitempty"` // The generation of the connection the event relates to
+	Attempts   int           `json:"attempts,omitempty"`   // The number of attempts it took to connect
+	Downtime   time.Duration `json:"downtime,omitempty"`   // How long the websocket was disconnected before connecting
+	Code       int           `json:"code,omitempty"`       // The close code of a disconnect
+	Reason     string        `json:"reason,omitempty"`     // The close reason of a disconnect
+	Error      string        `json:"error,omitempty"`      // The error that caused a disconnect, or made the websocket give up
+}
+
+// lifecycleListeners defines a thread-safe registry of functions that observe lifecycle events, in addition to the
+// lifecycle handlers
+type lifecycleListeners struct {
+	lock      *sync.Mutex
+	listeners map[int]func(LifecycleEvent)
+	counter   int
+}
+
+// newLifecycleListeners constructs a new lifecycle listener registry
+func newLifecycleListeners() *lifecycleListeners {
+	return &lifecycleListeners{
+		lock:      &sync.Mutex{},
+		listeners: make(map[int]func(LifecycleEvent)),
+	}
+}
+
+// add registers a listener, returning a function that removes it again
+func (l *lifecycleListeners) add(listener func(LifecycleEvent)) func() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.counter++
+	id := l.counter
+	l.listeners[id] = listener
+
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		delete(l.listeners, id)
+	}
+}
+
+// notify passes an event to every registered listener. The listeners are called without the lock held, so a slow
+// listener doesn't hold up registrations, and a listener can remove itself
+func (l *lifecycleListeners) notify(event LifecycleEvent) {
+	l.lock.Lock()
+	listeners := make([]func(LifecycleEvent), 0, len(l.listeners))
+	for _, listener := range l.listeners {
+		listeners = append(listeners, listener)
+	}
+	l.lock.Unlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// emit stamps a lifecycle event with the current time and passes it to the lifecycle listeners
+func (ws *Websocket) emit(event LifecycleEvent) {
+	event.Time = ws.now()
+	ws.lifecycleListeners.notify(event)
+}
+
+// gaveUp emits the event for a websocket that stopped trying to connect
+func (ws *Websocket) gaveUp(reason error) {
+	event := LifecycleEvent{Type: EventGaveUp}
+	if reason != nil {
+		event.Error = reason.Error()
+	}
+	ws.emit(event)
+}
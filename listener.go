@@ -0,0 +1,46 @@
+package gows
+
+import "sync"
+
+// listeners defines a thread-safe registry of functions that observe every inbound message, in addition to the message
+// handler
+type listeners struct {
+	lock      *sync.Mutex
+	listeners map[int]func([]byte)
+	counter   int
+}
+
+// newListeners constructs a new listener registry
+func newListeners() *listeners {
+	return &listeners{
+		lock:      &sync.Mutex{},
+		listeners: make(map[int]func([]byte)),
+	}
+}
+
+// add registers a listener, returning a function that removes it again
+func (l *listeners) add(listener func([]byte)) func() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.counter++
+	id := l.counter
+	l.listeners[id] = listener
+
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		delete(l.listeners, id)
+	}
+}
+
+// notify passes a message to every registered listener
+func (l *listeners) notify(msg []byte) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, listener := range l.listeners {
+		listener(msg)
+	}
+}
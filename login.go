@@ -0,0 +1,170 @@
+package gows
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errLoginTimeout is reported when the server doesn't reply to the login message in time
+var errLoginTimeout = errors.New("timed out waiting for login reply")
+
+// LoginFlow defines the login sequence performed on every connection. The login message is sent ahead of everything
+// else, and the rest of the send queue is blocked until the server confirms the login. If the login is rejected or
+// times out, the connection is dropped and the reviver tries again
+type LoginFlow struct {
+	Message     func() ([]byte, error)         // Builds the login message, called for every connection
+	Reply       func(msg []byte) (bool, error) // Recognizes the login reply, returning an error if the login was rejected
+	Timeout     time.Duration                  // How long to wait for the reply, zero to wait until the connection drops
+	MessageType int                            // The frame type of the login message, defaults to the default message type
+}
+
+// loginState defines the thread-safe state of the login in progress
+type loginState struct {
+	lock     *sync.Mutex
+	awaiting bool       // Whether a login reply is expected
+	result   chan error // Receives the outcome of the login
+	message  *message   // The most recent login message
+}
+
+// newLoginState constructs a new login state with no login in progress
+func newLoginState() *loginState {
+	return &loginState{lock: &sync.Mutex{}}
+}
+
+// begin starts waiting for a login reply, returning the channel the outcome is delivered on
+func (l *loginState) begin() chan error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.awaiting = true
+	l.result = make(chan error, 1)
+	return l.result
+}
+
+// check matches an inbound message against the login reply matcher, delivering the outcome and returning true if it
+// was the reply
+func (l *loginState) check(reply func([]byte) (bool, error), msg []byte) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.awaiting {
+		return false
+	}
+
+	matched, err := reply(msg)
+	if !matched {
+		return false
+	}
+
+	l.awaiting = false
+	l.result <- err
+	return true
+}
+
+// replaceMessage records a new login message, returning the previous one
+func (l *loginState) replaceMessage(msg *message) *message {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	previous := l.message
+	l.message = msg
+	return previous
+}
+
+// end stops waiting for a login reply
+func (l *loginState) end() {
+	l.lock.Lock()
+	l.awaiting = false
+	l.lock.Unlock()
+}
+
+// OnLoginFailed sets the onLoginFailed handler, called with the reason whenever the login flow is rejected or times out
+func (ws *Websocket) OnLoginFailed(handler func(error)) {
+	ws.loginFailedHandlerLock.Lock()
+	ws.loginFailedHandler = handler
+	ws.loginFailedHandlerLock.Unlock()
+}
+
+// beginLogin gates the send queue so only the login message can be sent, and puts the login message at the front of
+// it, returning the channel the outcome of the login is delivered on. The gate is separate from BlockSend(), so a block
+// set by the application stays in place once the login succeeds. Returns nil if no login flow is configured
+func (ws *Websocket) beginLogin() chan error {
+	flow := ws.configuration.Login
+	if flow == nil {
+		return nil
+	}
+
+	result := ws.login.begin()
+	data, err := flow.Message()
+	if err != nil {
+		ws.login.end()
+		result <- fmt.Errorf("failed to build login message: %w", err)
+		return result
+	}
+
+	messageType := flow.MessageType
+	if messageType == 0 {
+		messageType = ws.configuration.getDefaultMessageType()
+	}
+
+	// If the previous connection dropped before its login message was sent, it's stale now
+	msg, ok := ws.auditMessage(newMessage(messageType, data))
+	if previous := ws.login.replaceMessage(msg); previous != nil {
+		ws.sendQueue.remove(previous)
+	}
+	if !ok {
+		ws.login.end()
+		result <- errors.New("login message was denied by the audit hook")
+		return result
+	}
+
+	ws.configuration.Logger.Debug("Logging in, gating the send queue until the server replies")
+	ws.sendQueue.closeGate(msg)
+	ws.sendQueue.requeue(msg)
+	return result
+}
+
+// awaitLogin waits for the outcome of the login, opening the send queue's gate if it succeeded, or dropping the
+// connection if it failed
+func (ws *Websocket) awaitLogin(result chan error, stopChannel chan struct{}) {
+	var timeout <-chan time.Time
+	if ws.configuration.Login.Timeout > 0 {
+		timer := time.NewTimer(ws.configuration.Login.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-result:
+	case <-timeout:
+		err = errLoginTimeout
+	case <-stopChannel:
+		ws.login.end()
+		return
+	}
+	ws.login.end()
+
+	if err == nil {
+		ws.configuration.Logger.Debug("Logged in, opening the send queue")
+		ws.sendQueue.openGate()
+		return
+	}
+
+	ws.configuration.Logger.Warn("Login failed:", err)
+	ws.loginFailedHandlerLock.Lock()
+	ws.loginFailedHandler(err)
+	ws.loginFailedHandlerLock.Unlock()
+	ws.handleConnectionError(fmt.Errorf("login failed: %w", err))
+}
+
+// checkLogin matches an inbound message against the login reply, returning true if it was the reply
+func (ws *Websocket) checkLogin(msg []byte) bool {
+	if ws.configuration.Login == nil {
+		return false
+	}
+
+	return ws.login.check(ws.configuration.Login.Reply, msg)
+}
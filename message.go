@@ -0,0 +1,52 @@
+package gows
+
+import (
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// Message types supported by the send and receive paths
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+// message defines a message along with its frame type, either sitting in the send queue or on its way to the dispatcher
+type message struct {
+	messageType int    // The websocket frame type of the message
+	data        []byte // The message payload
+
+	progress func(int64, int64) // Called with the bytes written so far while the message is being sent, if set
+	retry    *RetryPolicy       // How to retry the message if writing it fails for reasons unrelated to the connection
+	attempts int                // The number of failed write attempts so far
+
+	uncompressed bool     // Whether to skip compression for the message
+	priority     Priority // The priority class of an outbound message
+
+	stream   *messageStream             // The stream the payload is written through, if the message is streamed
+	prepared *websocket.PreparedMessage // The frame written instead of the payload, if the message was prepared
+
+	receivedAt time.Time // When an inbound message was read from the connection
+	epoch      uint64    // The connection epoch an outbound message was queued in
+	queuedAt   time.Time // When an outbound message was queued
+	expiresAt  time.Time // When an outbound message expires, zero if it doesn't
+	key        string    // Identifies an outbound message, e.g. the delivery ID of a reliable message
+	persisted  uint64    // The ID an outbound message is stored under in the persistent queue, zero if it isn't
+}
+
+// newMessage constructs a new message
+func newMessage(messageType int, data []byte) *message {
+	return &message{
+		messageType: messageType,
+		data:        data,
+	}
+}
+
+// size gets the number of payload bytes in the message, or the number written so far if it's streamed
+func (m *message) size() int {
+	if m.stream != nil {
+		return int(m.stream.written)
+	}
+
+	return len(m.data)
+}
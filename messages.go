@@ -0,0 +1,91 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMessageChannelSize is the size of the channel returned by Messages() when none is configured
+const defaultMessageChannelSize = 256
+
+// MessageChannelPolicy defines what the dispatcher does with inbound messages when the channel returned by Messages()
+// is full
+type MessageChannelPolicy int
+
+const (
+	// MessageChannelBlock waits for the application to receive from the channel. While it waits, nothing else is
+	// dispatched, and once the inbound buffer fills up, the read loop stops reading as well
+	MessageChannelBlock MessageChannelPolicy = iota
+
+	// MessageChannelDrop discards messages that arrive while the channel is full
+	MessageChannelDrop
+)
+
+// Message defines an inbound message delivered on the channel returned by Messages()
+type Message struct {
+	Type       int       // The frame type, TextMessage or BinaryMessage
+	Data       []byte    // The message payload
+	ReceivedAt time.Time // When the message was read from the connection
+}
+
+// messageChannel defines the lazily created channel inbound messages are delivered on
+type messageChannel struct {
+	lock    *sync.Mutex
+	channel chan Message // The channel, nil until Messages() is called
+}
+
+// newMessageChannel constructs a new message channel that doesn't deliver anything until it's requested
+func newMessageChannel() *messageChannel {
+	return &messageChannel{lock: &sync.Mutex{}}
+}
+
+// Messages gets a channel that receives every message that would be passed to the message handler, as an alternative
+// to OnMessage that composes with select loops. The channel is buffered to the configured size, and what happens when
+// it's full depends on the configured MessageChannelPolicy. It's never closed, since the websocket may be connected
+// again, and every call returns the same channel
+func (ws *Websocket) Messages() <-chan Message {
+	ws.messageChannel.lock.Lock()
+	defer ws.messageChannel.lock.Unlock()
+
+	if ws.messageChannel.channel == nil {
+		ws.messageChannel.channel = make(chan Message, ws.configuration.getMessageChannelSize())
+	}
+	return ws.messageChannel.channel
+}
+
+// getMessageChannel gets the channel messages are delivered on, or nil if Messages() was never called
+func (ws *Websocket) getMessageChannel() chan Message {
+	ws.messageChannel.lock.Lock()
+	defer ws.messageChannel.lock.Unlock()
+
+	return ws.messageChannel.channel
+}
+
+// deliverMessage delivers a message on the message channel, if there is one, applying the channel policy if it's full
+func (ws *Websocket) deliverMessage(msg Message) {
+	channel := ws.getMessageChannel()
+	if channel == nil {
+		return
+	}
+
+	if ws.configuration.MessageChannelPolicy == MessageChannelBlock {
+		ws.configuration.Logger.Trace("DISPATCHER: Delivering message on the message channel...")
+		channel <- msg
+		return
+	}
+
+	select {
+	case channel <- msg:
+	default:
+		ws.configuration.Logger.Debug("DISPATCHER: Message channel is full, dropped inbound message")
+	}
+}
+
+// getMessageChannelSize gets the size of the channel returned by Messages()
+func (c *Configuration) getMessageChannelSize() int {
+	if c.MessageChannelSize > 0 {
+		return c.MessageChannelSize
+	}
+
+	return defaultMessageChannelSize
+}
@@ -0,0 +1,99 @@
+package gows
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Middleware defines a transformation applied to every inbound or outbound payload. Returning an error drops the
+// message
+type Middleware func([]byte) ([]byte, error)
+
+// middlewareChain defines a thread-safe, ordered chain of middleware
+type middlewareChain struct {
+	lock       *sync.Mutex
+	middleware []Middleware
+}
+
+// newMiddlewareChain constructs a new, empty middleware chain
+func newMiddlewareChain() *middlewareChain {
+	return &middlewareChain{
+		lock:       &sync.Mutex{},
+		middleware: make([]Middleware, 0),
+	}
+}
+
+// add appends middleware to the end of the chain
+func (c *middlewareChain) add(middleware ...Middleware) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// list gets the middleware in the chain, in order
+func (c *middlewareChain) list() []Middleware {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]Middleware{}, c.middleware...)
+}
+
+// apply runs a payload through every middleware in the chain, in the order they were added
+func (c *middlewareChain) apply(data []byte) ([]byte, error) {
+	c.lock.Lock()
+	middleware := c.middleware
+	c.lock.Unlock()
+
+	var err error
+	for _, m := range middleware {
+		data, err = m(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// UseInbound adds middleware that every inbound message passes through before anything else sees it, in the order
+// it's added. If a middleware returns an error, the message is dropped and the error reported to the error handler
+func (ws *Websocket) UseInbound(middleware ...Middleware) {
+	ws.inboundMiddleware.add(middleware...)
+}
+
+// UseOutbound adds middleware that every outbound message passes through right before it's written, in the order it's
+// added. Retried messages pass through it again. If a middleware returns an error, the message is dropped and the error
+// reported to the message dropped handler
+func (ws *Websocket) UseOutbound(middleware ...Middleware) {
+	ws.outboundMiddleware.add(middleware...)
+}
+
+// applyInbound runs an inbound message through the inbound middleware, returning false if it was dropped
+func (ws *Websocket) applyInbound(data []byte) ([]byte, bool) {
+	data, err := ws.inboundMiddleware.apply(data)
+	if err != nil {
+		ws.reportError(fmt.Errorf("inbound middleware dropped message: %w", err))
+		return nil, false
+	}
+
+	return data, true
+}
+
+// applyOutbound runs an outbound message through the outbound middleware, returning the message to write. The original
+// message is left untouched, so it can be retried. Streamed messages have no payload to transform, and prepared
+// messages are already framed, so they're passed through as is
+func (ws *Websocket) applyOutbound(msg *message) (*message, error) {
+	if msg.stream != nil || msg.prepared != nil {
+		return msg, nil
+	}
+
+	data, err := ws.outboundMiddleware.apply(msg.data)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed := *msg
+	transformed.data = data
+	return &transformed, nil
+}
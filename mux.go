@@ -0,0 +1,148 @@
+package gows
+
+import (
+	"fmt"
+	"sync"
+)
+
+// channelMarker is the first byte of every channel frame. It's followed by the length of the channel name, the name
+// itself, and the payload
+const channelMarker = 0xC7
+
+// maxChannelNameLength is the longest channel name that fits the framing header
+const maxChannelNameLength = 255
+
+// Channel defines a logical channel multiplexed over the websocket with Channel(). Every channel has its own message
+// handler, so independent subsystems can share one managed connection
+type Channel struct {
+	ws   *Websocket
+	name string
+
+	handlerLock *sync.Mutex
+	handler     func([]byte)
+
+	pubSub *PubSub // The publish/subscribe layer running on the channel, protected by the registry lock
+}
+
+// channels defines a thread-safe registry of the open channels, by name
+type channels struct {
+	lock     *sync.Mutex
+	channels map[string]*Channel
+}
+
+// newChannels constructs a new, empty channel registry
+func newChannels() *channels {
+	return &channels{
+		lock:     &sync.Mutex{},
+		channels: make(map[string]*Channel),
+	}
+}
+
+// Channel opens the logical channel with the supplied name, or gets it if it's already open. Messages sent on a
+// channel are framed with a small header carrying the channel name, and inbound frames for an open channel are passed
+// to its handler instead of the message handler. Both ends must use channels, and names are limited to 255 bytes
+func (ws *Websocket) Channel(name string) *Channel {
+	ws.channels.lock.Lock()
+	defer ws.channels.lock.Unlock()
+
+	channel, ok := ws.channels.channels[name]
+	if !ok {
+		channel = &Channel{
+			ws:          ws,
+			name:        name,
+			handlerLock: &sync.Mutex{},
+			handler:     func([]byte) {},
+		}
+		ws.channels.channels[name] = channel
+	}
+	return channel
+}
+
+// Name gets the name of the channel
+func (c *Channel) Name() string {
+	return c.name
+}
+
+// OnMessage sets the channel's message handler, called with the payload of every message received on it
+func (c *Channel) OnMessage(handler func(msg []byte)) {
+	c.handlerLock.Lock()
+	c.handler = handler
+	c.handlerLock.Unlock()
+}
+
+// Send sends a binary message on the channel, returning an error if it can't be queued
+func (c *Channel) Send(msg []byte) error {
+	frame, err := c.frame(msg)
+	if err != nil {
+		return err
+	}
+
+	return c.ws.send(BinaryMessage, frame)
+}
+
+// frame wraps a message in the channel's framing header
+func (c *Channel) frame(msg []byte) ([]byte, error) {
+	if len(c.name) > maxChannelNameLength {
+		return nil, fmt.Errorf("channel name %q is longer than %d bytes", c.name, maxChannelNameLength)
+	}
+
+	frame := make([]byte, 0, 2+len(c.name)+len(msg))
+	frame = append(frame, channelMarker, byte(len(c.name)))
+	frame = append(frame, c.name...)
+	return append(frame, msg...), nil
+}
+
+// Close closes the channel. Frames that arrive for it afterwards go to the message handler like any other message
+func (c *Channel) Close() {
+	c.ws.channels.lock.Lock()
+	defer c.ws.channels.lock.Unlock()
+
+	if c.ws.channels.channels[c.name] == c {
+		delete(c.ws.channels.channels, c.name)
+	}
+}
+
+// get gets the open channel with the supplied name
+func (c *channels) get(name []byte) (*Channel, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	channel, ok := c.channels[string(name)]
+	return channel, ok
+}
+
+// parseChannelFrame splits a channel frame into the channel name and the payload, returning false if the message isn't
+// framed for a channel
+func parseChannelFrame(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 2 || data[0] != channelMarker || len(data) < 2+int(data[1]) {
+		return nil, nil, false
+	}
+
+	end := 2 + int(data[1])
+	return data[2:end], data[end:], true
+}
+
+// routeChannel passes a channel frame to the handler of its channel using the supplied handle function, returning false
+// if the message isn't a channel frame or its channel isn't open
+func (ws *Websocket) routeChannel(messageType int, data []byte, handle func(func())) bool {
+	name, payload, ok := parseChannelFrame(data)
+	if messageType != BinaryMessage || !ok {
+		return false
+	}
+
+	channel, ok := ws.channels.get(name)
+	if !ok {
+		return false
+	}
+
+	handle(func() {
+		ws.configuration.Logger.Trace("DISPATCHER: Calling handler for channel", channel.name)
+		channel.handlerLock.Lock()
+		ws.measure("channel:"+channel.name, func() {
+			channel.handler(payload)
+		})
+		channel.handlerLock.Unlock()
+		ws.configuration.Logger.Trace("DISPATCHER: Successfully called handler for channel", channel.name)
+	})
+	return true
+}
@@ -0,0 +1,124 @@
+package gows
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// websocketAddr defines the address reported by a NetConn() while the websocket isn't connected
+type websocketAddr string
+
+// Network gets the name of the network
+func (a websocketAddr) Network() string {
+	return "websocket"
+}
+
+// String gets the address
+func (a websocketAddr) String() string {
+	return string(a)
+}
+
+// netConn defines a net.Conn over a stream with no delimiter, which reads the payloads of inbound messages as one
+// continuous byte stream, and writes every call to Write as a binary message
+type netConn struct {
+	ws     *Websocket
+	reader *streamReader
+	writer *streamWriter
+
+	lock          *sync.Mutex
+	writeDeadline time.Time // When writes time out, zero for never
+	closed        bool      // Whether the adapter was closed
+}
+
+// NetConn adapts the websocket to a net.Conn, so stream protocols like SSH tunnels, RPC stacks, or yamux can run over
+// it without knowing about frames or reconnects. Reads return the payloads of inbound messages back to back, and every
+// write is sent as a binary message through the send queue, so writes made while the websocket is reconnecting go out
+// once it's back. Bytes in flight when the connection drops are lost unless reliable delivery is enabled, so protocols
+// that can't tolerate gaps should be restarted on reconnect. Unread bytes are capped by StreamBufferSize, like Stream().
+// Closing the adapter detaches it without disconnecting the websocket, and every call returns a new adapter that sees
+// every inbound message from then on
+func (ws *Websocket) NetConn() net.Conn {
+	reader, writer := ws.newStream(nil, BinaryMessage, false)
+
+	return &netConn{
+		ws:     ws,
+		reader: reader,
+		writer: writer,
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Read reads inbound bytes, waiting for a message to arrive if there are none. Returns io.EOF once the adapter is
+// closed
+func (c *netConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Write sends the bytes as a binary message. Fails if the adapter is closed, the write deadline has passed, or the
+// message can't be queued
+func (c *netConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	closed := c.closed
+	deadline := c.writeDeadline
+	c.lock.Unlock()
+
+	if closed {
+		return 0, &net.OpError{Op: "write", Net: "websocket", Err: net.ErrClosed}
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return c.writer.Write(b)
+}
+
+// Close detaches the adapter from the websocket, failing any pending reads. The websocket stays connected
+func (c *netConn) Close() error {
+	c.lock.Lock()
+	c.closed = true
+	c.lock.Unlock()
+
+	_ = c.writer.Close()
+	return c.reader.Close()
+}
+
+// LocalAddr gets the local address of the current connection
+func (c *netConn) LocalAddr() net.Addr {
+	connection := c.ws.getConnection()
+	if connection == nil {
+		return websocketAddr("")
+	}
+	return connection.LocalAddr()
+}
+
+// RemoteAddr gets the remote address of the current connection, or the configured URL while disconnected
+func (c *netConn) RemoteAddr() net.Addr {
+	connection := c.ws.getConnection()
+	if connection == nil {
+		return websocketAddr(c.ws.configuration.URL)
+	}
+	return connection.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines
+func (c *netConn) SetDeadline(t time.Time) error {
+	_ = c.SetWriteDeadline(t)
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline, zero for none
+func (c *netConn) SetReadDeadline(t time.Time) error {
+	c.reader.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline, zero for none. Since writes only queue the message, it only fails writes
+// made after the deadline
+func (c *netConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.writeDeadline = t
+	c.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,41 @@
+package gows
+
+import "runtime/debug"
+
+// OnPanic sets the onPanic handler, called with the recovered value and the stack trace when a message, topic,
+// delivery, connected, or disconnected handler panics. The panic is recovered either way, so a misbehaving handler
+// can't take the whole process down from inside a goroutine gows started
+func (ws *Websocket) OnPanic(handler func(recovered interface{}, stack []byte)) {
+	ws.panicHandlerLock.Lock()
+	ws.panicHandler = handler
+	ws.panicHandlerLock.Unlock()
+}
+
+// safely calls a user handler, recovering from any panic and reporting it to the panic handler
+func (ws *Websocket) safely(name string, handler func()) {
+	defer ws.recoverPanic(name)
+	handler()
+}
+
+// recoverPanic recovers from a panic in the named user handler and reports it to the panic handler. Must be deferred
+func (ws *Websocket) recoverPanic(name string) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	ws.configuration.Logger.Error("Recovered from panic in", name, "handler:", recovered)
+	ws.panicHandlerLock.Lock()
+	ws.panicHandler(recovered, stack)
+	ws.panicHandlerLock.Unlock()
+}
+
+// recoverHandlers wraps a handle function so every handler invocation recovers from panics
+func (ws *Websocket) recoverHandlers(handle func(func())) func(func()) {
+	return func(handler func()) {
+		handle(func() {
+			ws.safely("message", handler)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package gows
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Queue defines durable storage for the send queue, so queued messages survive a process restart. Records are stored
+// under increasing IDs, and removed once their message is sent or discarded. NewFileQueue() provides a file-backed
+// implementation
+type Queue interface {
+	Append(id uint64, record []byte) error // Stores an encoded message under the ID
+	Remove(id uint64) error                // Removes the message stored under the ID
+	Records() ([]StoredRecord, error)      // Gets every stored message
+}
+
+// StoredRecord defines an encoded message kept in a persistent queue
+type StoredRecord struct {
+	ID   uint64 // The ID the message was stored under
+	Data []byte // The encoded, and possibly encrypted, message
+}
+
+// persistence defines the link between the send queue and its durable storage. Messages are encoded with the queue
+// codec and encrypted with the spool cipher, if there is one, before they're handed to the storage
+type persistence struct {
+	lock   *sync.Mutex
+	store  Queue
+	codec  QueueCodec
+	cipher *spoolCipher
+	nextID uint64
+}
+
+// newPersistence constructs the persistence for the configured queue storage, or nil if there isn't one
+func newPersistence(configuration *Configuration) (*persistence, error) {
+	if configuration.Queue == nil {
+		return nil, nil
+	}
+
+	cipher, err := newSpoolCipher(configuration.SpoolEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persistence{
+		lock:   &sync.Mutex{},
+		store:  configuration.Queue,
+		codec:  configuration.getQueueCodec(),
+		cipher: cipher,
+		nextID: 1,
+	}, nil
+}
+
+// save stores a message, tagging it with the ID it's stored under
+func (p *persistence) save(msg *message) error {
+	record, err := p.codec.Encode(newQueueRecord(msg))
+	if err != nil {
+		return fmt.Errorf("failed to encode queued message: %w", err)
+	}
+
+	p.lock.Lock()
+	id := p.nextID
+	p.nextID++
+	p.lock.Unlock()
+
+	if p.cipher != nil {
+		record, err = p.cipher.seal(record, persistedID(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.store.Append(id, record)
+	if err != nil {
+		return fmt.Errorf("failed to persist queued message: %w", err)
+	}
+
+	msg.persisted = id
+	return nil
+}
+
+// remove removes a stored message. Messages that weren't stored are ignored
+func (p *persistence) remove(msg *message) error {
+	if msg.persisted == 0 {
+		return nil
+	}
+
+	id := msg.persisted
+	msg.persisted = 0
+
+	err := p.store.Remove(id)
+	if err != nil {
+		return fmt.Errorf("failed to remove persisted message: %w", err)
+	}
+	return nil
+}
+
+// load gets the stored messages in the order they were stored, continuing the IDs after the last of them. Records
+// that can't be decoded are removed from the storage and returned as errors, so one bad record doesn't hold up the rest
+func (p *persistence) load() ([]*message, []error) {
+	records, err := p.store.Records()
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to load persisted messages: %w", err)}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+
+	messages := make([]*message, 0, len(records))
+	errs := make([]error, 0)
+	for _, stored := range records {
+		p.lock.Lock()
+		if stored.ID >= p.nextID {
+			p.nextID = stored.ID + 1
+		}
+		p.lock.Unlock()
+
+		msg, err := p.decode(stored)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dropping persisted message %d: %w", stored.ID, err))
+			_ = p.store.Remove(stored.ID)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, errs
+}
+
+// decode decrypts and decodes a stored message
+func (p *persistence) decode(stored StoredRecord) (*message, error) {
+	data := stored.Data
+	if p.cipher != nil {
+		var err error
+		data, err = p.cipher.open(data, persistedID(stored.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := p.codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := record.message()
+	msg.persisted = stored.ID
+	return msg, nil
+}
+
+// persistedID encodes a record ID as the additional data it's encrypted with, so records can't be swapped around
+func persistedID(id uint64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, id)
+	return encoded
+}
+
+// persist stores a message that's about to be queued, if the send queue is persistent. Streamed messages have no
+// payload to store, so they're never persisted. If the message can't be stored, it's still queued in memory
+func (ws *Websocket) persist(msg *message) {
+	if ws.persistence == nil || msg.stream != nil {
+		return
+	}
+
+	err := ws.persistence.save(msg)
+	if err != nil {
+		ws.reportError(err)
+	}
+}
+
+// unpersist removes a message that was sent or discarded from the persistent queue
+func (ws *Websocket) unpersist(msg *message) {
+	if ws.persistence == nil {
+		return
+	}
+
+	err := ws.persistence.remove(msg)
+	if err != nil {
+		ws.reportError(err)
+	}
+}
+
+// restoreQueue sets up the persistent queue and queues every message that was still stored when the process last
+// stopped. It's called before the websocket is returned from New(), so there are no handlers yet and problems are
+// logged instead
+func (ws *Websocket) restoreQueue() {
+	p, err := newPersistence(ws.configuration)
+	if err != nil {
+		ws.configuration.Logger.Error("Not persisting the send queue:", err)
+		return
+	}
+	if p == nil {
+		return
+	}
+	ws.persistence = p
+
+	messages, errs := p.load()
+	for _, err := range errs {
+		ws.configuration.Logger.Error(err)
+	}
+	for _, msg := range messages {
+		ws.sendQueue.push(msg)
+	}
+
+	if len(messages) > 0 {
+		ws.configuration.Logger.Debug("Restored", len(messages), "persisted messages to the send queue")
+	}
+}
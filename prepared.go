@@ -0,0 +1,53 @@
+package gows
+
+import (
+	"bytes"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// PreparedMessage defines a message that is framed, and compressed if the connection negotiated compression, once no
+// matter how many websockets it's sent on. Useful for a hub broadcasting the same payload to many connections
+type PreparedMessage struct {
+	messageType int
+	data        []byte
+	prepared    *websocket.PreparedMessage
+}
+
+// NewPreparedMessage prepares a binary message with the provided body for SendPrepared()
+func NewPreparedMessage(msg []byte) (*PreparedMessage, error) {
+	return NewPreparedMessageType(BinaryMessage, msg)
+}
+
+// NewPreparedMessageType prepares a message with the provided frame type (TextMessage or BinaryMessage) and body for
+// SendPrepared()
+func NewPreparedMessageType(messageType int, msg []byte) (*PreparedMessage, error) {
+	prepared, err := websocket.NewPreparedMessage(messageType, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedMessage{
+		messageType: messageType,
+		data:        msg,
+		prepared:    prepared,
+	}, nil
+}
+
+// SendPrepared sends a prepared message, reusing its frame instead of encoding and compressing the payload again for
+// this websocket. The message goes through the audit hook and the send queue like any other, but skips the outbound
+// middleware, which would change the prepared payload. If the audit hook rewrites the message, the rewritten message is
+// sent as a regular one. Returns an error if the message can't be queued, like SendErr()
+func (ws *Websocket) SendPrepared(msg *PreparedMessage) error {
+	return ws.sendMessage(msg.messageType, msg.data, func(queued *message) {
+		if bytes.Equal(queued.data, msg.data) {
+			queued.prepared = msg.prepared
+		}
+	})
+}
+
+// writePrepared writes a prepared message to the connection with a write deadline
+func (ws *Websocket) writePrepared(connection *websocket.Conn, msg *message) error {
+	_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
+	return connection.WritePreparedMessage(msg.prepared)
+}
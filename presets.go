@@ -0,0 +1,78 @@
+package gows
+
+import "time"
+
+// ProfileLowLatency gets a configuration tuned for interactive traffic, e.g. trading or gaming feeds. Messages are
+// sent as soon as they're queued, dead connections are detected within seconds, reconnects start almost immediately,
+// and small messages aren't compressed. The URL and logger still need to be set
+func ProfileLowLatency() *Configuration {
+	return &Configuration{
+		ConnectionRetryFactor:     1.5,
+		ConnectionRetryTimeoutMin: 100 * time.Millisecond,
+		ConnectionRetryTimeoutMax: 2 * time.Second,
+		ConnectionRetryRandomize:  true,
+		PingInterval:              5 * time.Second,
+		WriteTimeout:              2 * time.Second,
+		ControlWriteTimeout:       500 * time.Millisecond,
+		ReadTimeout:               7 * time.Second,
+		RetryInitialConnection:    true,
+		BackoffResetAfter:         10 * time.Second,
+		RequestTimeout:            2 * time.Second,
+		InboundBufferSize:         1024,
+		MaxQueueSize:              1000,
+		CompressionThreshold:      4096,
+	}
+}
+
+// ProfileIoT gets a configuration tuned for constrained devices on flaky, metered links. Pings are infrequent to save
+// data and battery, reconnects back off slowly up to several minutes, small batches are flushed together, and the
+// queue is bounded so an outage can't exhaust the device's memory. The URL and logger still need to be set
+func ProfileIoT() *Configuration {
+	return &Configuration{
+		ConnectionRetryFactor:     2,
+		ConnectionRetryTimeoutMin: 2 * time.Second,
+		ConnectionRetryTimeoutMax: 5 * time.Minute,
+		ConnectionRetryRandomize:  true,
+		PingInterval:              2 * time.Minute,
+		WriteTimeout:              30 * time.Second,
+		ControlWriteTimeout:       10 * time.Second,
+		ReadTimeout:               150 * time.Second,
+		RetryInitialConnection:    true,
+		BackoffResetAfter:         5 * time.Minute,
+		RequestTimeout:            30 * time.Second,
+		InboundBufferSize:         32,
+		MaxQueueSize:              500,
+		MaxMessageSize:            64 * 1024,
+		FlushInterval:             1 * time.Second,
+		EnableCompression:         true,
+		CompressionThreshold:      256,
+	}
+}
+
+// ProfileBulkTransfer gets a configuration tuned for moving large volumes of data, e.g. backfills or file sync. Write
+// timeouts are generous enough for big messages, messages are compressed and written in large frames, and the queue
+// is deep enough to absorb bursts while reporting pressure through its watermarks. The URL and logger still need to
+// be set
+func ProfileBulkTransfer() *Configuration {
+	return &Configuration{
+		ConnectionRetryFactor:     2,
+		ConnectionRetryTimeoutMin: 1 * time.Second,
+		ConnectionRetryTimeoutMax: 30 * time.Second,
+		ConnectionRetryRandomize:  true,
+		PingInterval:              30 * time.Second,
+		WriteTimeout:              2 * time.Minute,
+		ControlWriteTimeout:       5 * time.Second,
+		ReadTimeout:               2 * time.Minute,
+		RetryInitialConnection:    true,
+		BackoffResetAfter:         1 * time.Minute,
+		RequestTimeout:            1 * time.Minute,
+		InboundBufferSize:         4096,
+		MaxQueueSize:              100000,
+		QueueHighWatermark:        50000,
+		QueueLowWatermark:         10000,
+		ProgressChunkSize:         256 * 1024,
+		TargetFrameSize:           64 * 1024,
+		EnableCompression:         true,
+		CompressionThreshold:      1024,
+	}
+}
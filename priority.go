@@ -0,0 +1,26 @@
+package gows
+
+// Priority defines the priority class of an outbound message. Queued messages are sent in priority order, and in the
+// order they were queued within a class
+type Priority int
+
+const (
+	// PriorityLow is for bulk data that can wait for everything else
+	PriorityLow Priority = -1
+
+	// PriorityNormal is the priority of every message sent without one
+	PriorityNormal Priority = 0
+
+	// PriorityHigh is for control messages, such as authentication, acknowledgements, and heartbeats, that shouldn't
+	// wait behind a backlog
+	PriorityHigh Priority = 1
+)
+
+// SendPriority sends a message with the provided body and priority class. Higher priority messages jump ahead
+// of lower priority ones that are still queued, e.g. so control messages aren't stuck behind bulk data while a large
+// backlog is flushed after a reconnect
+func (ws *Websocket) SendPriority(msg []byte, priority Priority) error {
+	return ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		queued.priority = priority
+	})
+}
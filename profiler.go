@@ -0,0 +1,137 @@
+package gows
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// defaultProfileInterval is how often allocations are sampled when no profile interval is configured
+const defaultProfileInterval = 10 * time.Second
+
+// Profile defines a snapshot of the self-profiler's measurements. Times are measured on the sender and dispatcher, and
+// don't include time spent waiting on the network or running message handlers. Allocations are sampled for the whole
+// process, so they're only a useful guide when the websocket is what keeps the process busy
+type Profile struct {
+	Enabled bool // Whether self-profiling is enabled
+
+	// Sender
+	MessagesSent    uint64        // The number of messages written
+	SendTime        time.Duration // The total time spent writing messages
+	AverageSendTime time.Duration // The average time spent writing a message
+
+	// Dispatcher
+	MessagesDispatched  uint64        // The number of inbound messages dispatched
+	DispatchTime        time.Duration // The total time spent dispatching messages
+	AverageDispatchTime time.Duration // The average time spent dispatching a message
+
+	// Allocations over the last sampling interval
+	AllocsPerMessage float64   // Heap allocations per message sent or dispatched
+	BytesPerMessage  float64   // Heap bytes allocated per message sent or dispatched
+	SampledAt        time.Time // When allocations were last sampled
+}
+
+// profiler defines a thread-safe, opt-in profiler for the sender and dispatcher
+type profiler struct {
+	lock     *sync.Mutex
+	enabled  bool
+	interval time.Duration
+	profile  Profile
+
+	// The process allocation counters and message count when allocations were last sampled
+	mallocs  uint64
+	bytes    uint64
+	messages uint64
+}
+
+// newProfiler constructs a new profiler, which does nothing unless it's enabled
+func newProfiler(enabled bool, interval time.Duration) *profiler {
+	if interval <= 0 {
+		interval = defaultProfileInterval
+	}
+
+	return &profiler{
+		lock:     &sync.Mutex{},
+		enabled:  enabled,
+		interval: interval,
+		profile:  Profile{Enabled: enabled},
+	}
+}
+
+// start gets the time a measurement starts, or the zero time if profiling is disabled
+func (p *profiler) start() time.Time {
+	if !p.enabled {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+// sent records the time spent writing a message that started at the supplied time
+func (p *profiler) sent(start time.Time) {
+	if !p.enabled {
+		return
+	}
+
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.profile.MessagesSent++
+	p.profile.SendTime += now.Sub(start)
+	p.sample(now)
+}
+
+// dispatched records the time spent dispatching a message that started at the supplied time
+func (p *profiler) dispatched(start time.Time) {
+	if !p.enabled {
+		return
+	}
+
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.profile.MessagesDispatched++
+	p.profile.DispatchTime += now.Sub(start)
+	p.sample(now)
+}
+
+// sample samples the process allocation counters if the sampling interval has passed, working out the allocations per
+// message since the last sample. Must be called with the lock held
+func (p *profiler) sample(now time.Time) {
+	if now.Sub(p.profile.SampledAt) < p.interval {
+		return
+	}
+
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	messages := p.profile.MessagesSent + p.profile.MessagesDispatched
+
+	// The first sample only sets the baseline
+	if !p.profile.SampledAt.IsZero() && messages > p.messages {
+		count := float64(messages - p.messages)
+		p.profile.AllocsPerMessage = float64(stats.Mallocs-p.mallocs) / count
+		p.profile.BytesPerMessage = float64(stats.TotalAlloc-p.bytes) / count
+	}
+
+	p.mallocs = stats.Mallocs
+	p.bytes = stats.TotalAlloc
+	p.messages = messages
+	p.profile.SampledAt = now
+}
+
+// snapshot gets a copy of the current measurements
+func (p *profiler) snapshot() Profile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	profile := p.profile
+	if profile.MessagesSent > 0 {
+		profile.AverageSendTime = profile.SendTime / time.Duration(profile.MessagesSent)
+	}
+	if profile.MessagesDispatched > 0 {
+		profile.AverageDispatchTime = profile.DispatchTime / time.Duration(profile.MessagesDispatched)
+	}
+	return profile
+}
@@ -0,0 +1,62 @@
+package gows
+
+import (
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// defaultProgressChunkSize is the number of bytes written between progress reports when none is configured
+const defaultProgressChunkSize = 32 * 1024
+
+// SendWithProgress sends a message, reporting how many of its bytes have been written as the sender writes it in
+// chunks. The progress function is called from the sender goroutine, so it should return quickly. If the connection
+// drops part way through, the message is sent again from the start after reconnecting
+func (ws *Websocket) SendWithProgress(msg []byte, progress func(bytesSent int64, total int64)) error {
+	return ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		queued.progress = progress
+	})
+}
+
+// getProgressChunkSize gets the number of bytes written between progress reports, falling back to the target frame size
+// and then the default
+func (c *Configuration) getProgressChunkSize() int {
+	if c.ProgressChunkSize > 0 {
+		return c.ProgressChunkSize
+	}
+
+	if c.TargetFrameSize > 0 {
+		return c.TargetFrameSize
+	}
+
+	return defaultProgressChunkSize
+}
+
+// writeWithProgress writes a message in chunks, refreshing the write deadline and reporting progress after every chunk
+func (ws *Websocket) writeWithProgress(connection *websocket.Conn, msg *message) error {
+	chunkSize := ws.configuration.getProgressChunkSize()
+
+	_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
+	writer, err := connection.NextWriter(msg.messageType)
+	if err != nil {
+		return err
+	}
+
+	total := int64(len(msg.data))
+	for sent := 0; sent < len(msg.data); {
+		end := sent + chunkSize
+		if end > len(msg.data) {
+			end = len(msg.data)
+		}
+
+		_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
+		written, err := writer.Write(msg.data[sent:end])
+		sent += written
+		if err != nil {
+			return err
+		}
+
+		msg.progress(int64(sent), total)
+	}
+
+	return writer.Close()
+}
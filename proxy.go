@@ -0,0 +1,30 @@
+package gows
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// HTTPProxy builds a proxy function that tunnels connections through the HTTP proxy at the supplied host:port with
+// CONNECT. When a username is supplied, the credentials are sent to the proxy with basic authentication
+func HTTPProxy(address string, username string, password string) func(*http.Request) (*url.URL, error) {
+	return fixedProxy("http", address, username, password)
+}
+
+// SOCKS5Proxy builds a proxy function that connects through the SOCKS5 proxy at the supplied host:port. When a
+// username is supplied, the proxy's username/password authentication is used
+func SOCKS5Proxy(address string, username string, password string) func(*http.Request) (*url.URL, error) {
+	return fixedProxy("socks5", address, username, password)
+}
+
+// fixedProxy builds a proxy function that returns the same proxy URL for every request
+func fixedProxy(scheme string, address string, username string, password string) func(*http.Request) (*url.URL, error) {
+	proxyURL := &url.URL{Scheme: scheme, Host: address}
+	if username != "" {
+		proxyURL.User = url.UserPassword(username, password)
+	}
+
+	return func(*http.Request) (*url.URL, error) {
+		return proxyURL, nil
+	}
+}
@@ -0,0 +1,104 @@
+package gows
+
+import (
+	"fmt"
+	"time"
+)
+
+// ForTopic links the subscription to the topic pattern it delivers data for, making it eligible for pruning once no
+// topic handler matches the pattern anymore, or no matching message has been received for the configured idle timeout
+func (s *Subscription) ForTopic(pattern string) {
+	s.subscriptions.lock.Lock()
+	s.topic = pattern
+	s.subscriptions.lock.Unlock()
+}
+
+// touch records activity on every subscription whose topic pattern matches the supplied topic
+func (s *subscriptions) touch(topic string, separator string, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, subscription := range s.subscriptions {
+		if subscription.topic != "" && matchTopic(subscription.topic, topic, separator) {
+			subscription.lastActivity = now
+		}
+	}
+}
+
+// prunable removes and returns the topic subscriptions that are idle, or no longer have a handler according to the
+// supplied function
+func (s *subscriptions) prunable(idleTimeout time.Duration, handled func(string) bool, now time.Time) []*Subscription {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pruned := make([]*Subscription, 0)
+	kept := make([]*Subscription, 0, len(s.subscriptions))
+	for _, subscription := range s.subscriptions {
+		idle := idleTimeout > 0 && now.Sub(subscription.lastActivity) >= idleTimeout
+		if subscription.topic != "" && (idle || !handled(subscription.topic)) {
+			pruned = append(pruned, subscription)
+		} else {
+			kept = append(kept, subscription)
+		}
+	}
+
+	s.subscriptions = kept
+	return pruned
+}
+
+// handles determines if any topic handler would receive messages for the supplied topic pattern
+func (r *router) handles(pattern string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, topicHandler := range r.handlers {
+		if topicHandler.pattern == pattern || matchTopic(topicHandler.pattern, pattern, r.separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruner defines the goroutine responsible for unsubscribing from topics that are no longer handled or have gone idle
+func (ws *Websocket) pruner(stopChannel chan struct{}) {
+	pruneTicker := time.NewTicker(ws.configuration.getPruneInterval())
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+
+		case <-stopChannel:
+			ws.configuration.Logger.Trace("PRUNER: Shutting down")
+			return
+
+		case <-pruneTicker.C:
+			ws.prune()
+		}
+	}
+}
+
+// prune removes dead topic subscriptions, sending an unsubscribe message for each of them
+func (ws *Websocket) prune() {
+	pruned := ws.subscriptions.prunable(ws.configuration.SubscriptionIdleTimeout, ws.router.handles, ws.now())
+	for _, subscription := range pruned {
+		ws.configuration.Logger.Debug("PRUNER: Unsubscribing from", subscription.topic)
+
+		unsubscribe, err := ws.configuration.Unsubscriber(subscription.message.data)
+		if err != nil {
+			ws.reportError(fmt.Errorf("failed to build unsubscribe message for %s: %w", subscription.topic, err))
+			continue
+		}
+
+		_ = ws.send(subscription.message.messageType, unsubscribe)
+	}
+}
+
+// getPruneInterval gets how often the pruner checks for dead subscriptions, which is half the idle timeout or, without
+// one, once a minute
+func (c *Configuration) getPruneInterval() time.Duration {
+	if c.SubscriptionIdleTimeout > 0 {
+		return c.SubscriptionIdleTimeout / 2
+	}
+
+	return time.Minute
+}
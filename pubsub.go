@@ -0,0 +1,192 @@
+package gows
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// Operations of the publish/subscribe protocol. Every frame on the channel is the operation, the length of the topic,
+// the topic itself, and for publishes, the payload
+const (
+	pubSubPublish     = 'P'
+	pubSubSubscribe   = 'S'
+	pubSubUnsubscribe = 'U'
+)
+
+// PubSub defines a topic-based publish/subscribe layer running on a channel, created with PubSub()
+type PubSub struct {
+	ws      *Websocket
+	channel *Channel
+	router  *router // Handlers registered for topic patterns
+
+	lock   *sync.Mutex
+	topics map[string]*pubSubTopic // The topic patterns subscribed to on the server
+}
+
+// pubSubTopic defines a topic pattern subscribed to on the server, along with the number of local handlers for it
+type pubSubTopic struct {
+	handlers     int
+	subscription *Subscription // Replays the subscribe frame after every reconnect
+}
+
+// PubSubHandler defines a handler registered with (*PubSub).Subscribe
+type PubSubHandler struct {
+	pubSub  *PubSub
+	handler *TopicHandler
+	once    *sync.Once
+}
+
+// PubSub gets the publish/subscribe layer running on the channel with the supplied name, creating it if needed. Topics
+// are subscribed to on the server with a subscribe frame that's automatically replayed after every reconnect, and
+// publishes are delivered to every handler whose pattern matches the topic. Patterns support the same MQTT-style
+// wildcards as Subscribe()
+func (ws *Websocket) PubSub(channel string) *PubSub {
+	c := ws.Channel(channel)
+
+	ws.channels.lock.Lock()
+	defer ws.channels.lock.Unlock()
+
+	if c.pubSub == nil {
+		c.pubSub = &PubSub{
+			ws:      ws,
+			channel: c,
+			router:  newRouter(ws.configuration.TopicSeparator),
+			lock:    &sync.Mutex{},
+			topics:  make(map[string]*pubSubTopic),
+		}
+		c.OnMessage(c.pubSub.receive)
+	}
+	return c.pubSub
+}
+
+// Publish publishes a payload to a topic, returning an error if it can't be queued
+func (p *PubSub) Publish(topic string, payload []byte) error {
+	return p.channel.Send(encodePubSubFrame(pubSubPublish, topic, payload))
+}
+
+// Subscribe registers a handler for publishes to topics matching the pattern. The first handler for a pattern
+// subscribes to it on the server
+func (p *PubSub) Subscribe(pattern string, handler func(topic string, payload []byte)) *PubSubHandler {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	topic, ok := p.topics[pattern]
+	if !ok {
+		topic = &pubSubTopic{}
+		p.topics[pattern] = topic
+
+		frame, err := p.channel.frame(encodePubSubFrame(pubSubSubscribe, pattern, nil))
+		if err == nil {
+			topic.subscription = p.ws.AddResubscribeMessage(frame)
+			err = p.ws.send(BinaryMessage, frame)
+		}
+		if err != nil {
+			p.ws.reportError(err)
+		}
+	}
+	topic.handlers++
+
+	return &PubSubHandler{
+		pubSub:  p,
+		handler: p.router.add(pattern, handler),
+		once:    &sync.Once{},
+	}
+}
+
+// Unsubscribe removes every handler for the pattern and unsubscribes from it on the server
+func (p *PubSub) Unsubscribe(pattern string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.router.removePattern(pattern)
+	p.unsubscribe(pattern)
+}
+
+// Unsubscribe removes the handler. Once the last handler for its pattern is removed, the pattern is unsubscribed from
+// on the server
+func (h *PubSubHandler) Unsubscribe() {
+	h.once.Do(func() {
+		h.pubSub.lock.Lock()
+		defer h.pubSub.lock.Unlock()
+
+		h.handler.Remove()
+		topic, ok := h.pubSub.topics[h.handler.pattern]
+		if !ok {
+			return
+		}
+
+		topic.handlers--
+		if topic.handlers == 0 {
+			h.pubSub.unsubscribe(h.handler.pattern)
+		}
+	})
+}
+
+// Pattern gets the topic pattern the handler was registered for
+func (h *PubSubHandler) Pattern() string {
+	return h.handler.pattern
+}
+
+// unsubscribe stops replaying the subscribe frame for a pattern and sends the unsubscribe frame. Must be called with
+// the lock held
+func (p *PubSub) unsubscribe(pattern string) {
+	topic, ok := p.topics[pattern]
+	if !ok {
+		return
+	}
+
+	delete(p.topics, pattern)
+	if topic.subscription != nil {
+		topic.subscription.Remove()
+	}
+
+	err := p.channel.Send(encodePubSubFrame(pubSubUnsubscribe, pattern, nil))
+	if err != nil {
+		p.ws.reportError(err)
+	}
+}
+
+// receive passes a publish received on the channel to every handler whose pattern matches its topic
+func (p *PubSub) receive(frame []byte) {
+	operation, topic, payload, err := decodePubSubFrame(frame)
+	if err != nil {
+		p.ws.reportError(err)
+		return
+	}
+	if operation != pubSubPublish {
+		p.ws.configuration.Logger.Debug("DISPATCHER: Ignoring unexpected pub/sub operation", string(rune(operation)))
+		return
+	}
+
+	for _, handler := range p.router.match(topic) {
+		p.ws.measure("pubsub:"+handler.pattern, func() {
+			handler.handler(topic, payload)
+		})
+	}
+}
+
+// encodePubSubFrame encodes a publish/subscribe frame
+func encodePubSubFrame(operation byte, topic string, payload []byte) []byte {
+	frame := make([]byte, 0, 1+binary.MaxVarintLen64+len(topic)+len(payload))
+	frame = append(frame, operation)
+	frame = appendUvarint(frame, uint64(len(topic)))
+	frame = append(frame, topic...)
+	return append(frame, payload...)
+}
+
+// decodePubSubFrame decodes a publish/subscribe frame into the operation, topic, and payload
+func decodePubSubFrame(frame []byte) (byte, string, []byte, error) {
+	if len(frame) == 0 {
+		return 0, "", nil, errors.New("received an empty pub/sub frame")
+	}
+
+	length, n := binary.Uvarint(frame[1:])
+	if n <= 0 || uint64(len(frame)-1-n) < length {
+		return 0, "", nil, errors.New("received a truncated pub/sub frame")
+	}
+
+	start := 1 + n
+	end := start + int(length)
+	return frame[0], string(frame[start:end]), frame[end:], nil
+}
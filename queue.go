@@ -2,37 +2,97 @@ package gows
 
 import "sync"
 
-// queue defines a basic thread-safe queue structure that can be paused
+// queue defines a basic thread-safe queue structure that can be paused. Whenever messages become available to pop, the
+// queue signals on its signal channel, so the sender doesn't have to poll it
 type queue struct {
 	lock     *sync.Mutex
-	messages [][]byte
+	messages []*message
 	paused   bool
+	allow    func([]byte) bool // Messages that may still be popped while the queue is paused, nil for none
+	gated    bool              // Whether only the gate message may be popped, regardless of the pause
+	gate     *message          // The only message that may be popped while the queue is gated, e.g. the login message
+	inFlight int               // The number of popped messages that haven't finished sending yet
+	signal   chan struct{}
 }
 
 // newQueue constructs a new queue
 func newQueue() *queue {
 	return &queue{
 		lock:     &sync.Mutex{},
-		messages: make([][]byte, 0),
+		messages: make([]*message, 0),
+		signal:   make(chan struct{}, 1),
 	}
 }
 
-// push pushes a message onto the the back of the queue
-func (q *queue) push(msg []byte) {
+// notify signals that messages are available, without blocking if a signal is already pending. Must be called with the
+// lock held
+func (q *queue) notify() {
+	if (q.paused && q.allow == nil && !q.gated) || len(q.messages) == 0 {
+		return
+	}
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// push pushes a message onto the the back of its priority class in the queue
+func (q *queue) push(msg *message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.insert(msg)
+	q.notify()
+}
+
+// insert adds a message behind every queued message of the same or a higher priority. The search starts from the back,
+// so queueing messages of a single priority stays cheap. Must be called with the lock held
+func (q *queue) insert(msg *message) {
+	i := len(q.messages)
+	for i > 0 && q.messages[i-1].priority < msg.priority {
+		i--
+	}
+
+	if i == len(q.messages) {
+		q.messages = append(q.messages, msg)
+		return
+	}
+
+	q.messages = append(q.messages, nil)
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = msg
+}
+
+// offer pushes a message onto the back of its priority class in the queue, unless the queue already holds the supplied limit of messages. A
+// limit of zero means there's no limit
+func (q *queue) offer(msg *message, limit int) bool {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	q.messages = append(q.messages, msg)
+	if limit > 0 && len(q.messages) >= limit {
+		return false
+	}
+
+	q.insert(msg)
+	q.notify()
+	return true
 }
 
-// pop pops a message from the queue, unless it's paused
-func (q *queue) pop() ([]byte, int) {
+// pop pops a message from the queue. While it's paused, only the first message the allow function lets through can be
+// popped, and the rest stay where they are
+func (q *queue) pop() (*message, int) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	// If the queue is paused, return nothing
+	// If the queue is gated, return the gate message if it's queued
+	if q.gated {
+		return q.popGate()
+	}
+
+	// If the queue is paused, return the first allowed message, if any
 	if q.paused {
-		return nil, 0
+		return q.popAllowed()
 	}
 
 	// If there are no messages, return nothing
@@ -43,15 +103,146 @@ func (q *queue) pop() ([]byte, int) {
 	// Pop the first element and return that and the remaining length
 	msg, remaining := q.messages[0], q.messages[1:]
 	q.messages = remaining
+	q.inFlight++
 	return msg, len(q.messages)
 }
 
+// finish marks a popped message as finished, whether it was sent, dropped, or put back
+func (q *queue) finish() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.inFlight--
+}
+
+// pending gets the number of messages that are either in the queue or still being sent
+func (q *queue) pending() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.messages) + q.inFlight
+}
+
+// popGate pops the gate message if it's in the queue. Must be called with the lock held
+func (q *queue) popGate() (*message, int) {
+	for i, msg := range q.messages {
+		if msg == q.gate {
+			q.messages = append(q.messages[:i:i], q.messages[i+1:]...)
+			q.inFlight++
+			return msg, len(q.messages)
+		}
+	}
+
+	return nil, 0
+}
+
+// popAllowed pops the first message the allow function lets through. Must be called with the lock held
+func (q *queue) popAllowed() (*message, int) {
+	if q.allow == nil {
+		return nil, 0
+	}
+
+	for i, msg := range q.messages {
+		if q.allow(msg.data) {
+			q.messages = append(q.messages[:i:i], q.messages[i+1:]...)
+			q.inFlight++
+			return msg, len(q.messages)
+		}
+	}
+
+	return nil, 0
+}
+
 // requeue adds a message back to the front of the queue
-func (q *queue) requeue(msg []byte) {
+func (q *queue) requeue(msg *message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.messages = append([]*message{msg}, q.messages...)
+	q.notify()
+}
+
+// requeueAll adds several messages back to the front of the queue, keeping their order
+func (q *queue) requeueAll(msgs []*message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	messages := make([]*message, 0, len(msgs)+len(q.messages))
+	messages = append(messages, msgs...)
+	q.messages = append(messages, q.messages...)
+	q.notify()
+}
+
+// requeueMissing adds the supplied messages back to the front of the queue, keeping their order, except for those that
+// are already in the queue. Returns the number of messages that were added
+func (q *queue) requeueMissing(msgs []*message) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	queued := make(map[*message]bool, len(q.messages))
+	for _, msg := range q.messages {
+		queued[msg] = true
+	}
+
+	messages := make([]*message, 0, len(msgs)+len(q.messages))
+	for _, msg := range msgs {
+		if !queued[msg] {
+			messages = append(messages, msg)
+		}
+	}
+	added := len(messages)
+
+	q.messages = append(messages, q.messages...)
+	q.notify()
+	return added
+}
+
+// extract removes and returns the messages the supplied function selects, keeping their order
+func (q *queue) extract(selected func(*message) bool) []*message {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	extracted := make([]*message, 0)
+	remaining := make([]*message, 0, len(q.messages))
+	for _, msg := range q.messages {
+		if selected(msg) {
+			extracted = append(extracted, msg)
+		} else {
+			remaining = append(remaining, msg)
+		}
+	}
+
+	q.messages = remaining
+	return extracted
+}
+
+// remove removes a message from the queue if it's still waiting to be sent
+func (q *queue) remove(msg *message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, existing := range q.messages {
+		if existing == msg {
+			q.messages = append(q.messages[:i:i], q.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// length gets the number of messages currently in the queue
+func (q *queue) length() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.messages)
+}
+
+// depth gets the number of messages currently in the queue, and whether it's paused or gated
+func (q *queue) depth() (int, bool) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	q.messages = append([][]byte{msg}, q.messages...)
+	return len(q.messages), q.paused || q.gated
 }
 
 // pause temporarily blocks sending
@@ -60,6 +251,17 @@ func (q *queue) pause() {
 	defer q.lock.Unlock()
 
 	q.paused = true
+	q.allow = nil
+}
+
+// pauseExcept temporarily blocks sending, except for messages the allow function lets through
+func (q *queue) pauseExcept(allow func([]byte) bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.paused = true
+	q.allow = allow
+	q.notify()
 }
 
 // resume unblocks sending
@@ -68,4 +270,27 @@ func (q *queue) resume() {
 	defer q.lock.Unlock()
 
 	q.paused = false
+	q.allow = nil
+	q.notify()
+}
+
+// closeGate blocks sending of everything but the supplied message, independently of any pause. The pause is left as it
+// is, and applies again once the gate is opened
+func (q *queue) closeGate(msg *message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.gated = true
+	q.gate = msg
+	q.notify()
+}
+
+// openGate stops gating the queue, leaving any pause in place
+func (q *queue) openGate() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.gated = false
+	q.gate = nil
+	q.notify()
 }
@@ -0,0 +1,234 @@
+package gows
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// queueRecordVersion is the version of the record format written by BinaryQueueCodec and JSONQueueCodec. It's only
+// bumped for changes older readers can't work with, since new fields are skipped by readers that don't know them
+const queueRecordVersion = 1
+
+// Field tags of the binary queue record format
+const (
+	queueFieldType      = 1
+	queueFieldData      = 2
+	queueFieldPriority  = 3
+	queueFieldQueuedAt  = 4
+	queueFieldExpiresAt = 5
+	queueFieldKey       = 6
+)
+
+// QueueRecord defines a queued outbound message along with its metadata, as it's stored when the queue is persisted
+type QueueRecord struct {
+	Type      int       // The frame type, TextMessage or BinaryMessage
+	Data      []byte    // The message payload
+	Priority  Priority  // The priority class the message was sent with
+	QueuedAt  time.Time // When the message was queued
+	ExpiresAt time.Time // When the message expires, zero if it was sent without a TTL
+	Key       string    // Identifies the message, e.g. the delivery ID of a reliable message, empty if there isn't one
+}
+
+// QueueCodec defines how queue records are serialized when the queue is persisted. Decoding must accept records written
+// by older versions of the codec, so upgrading doesn't corrupt an existing queue
+type QueueCodec interface {
+	Encode(record QueueRecord) ([]byte, error) // Encodes a record
+	Decode(data []byte) (QueueRecord, error)   // Decodes a record
+}
+
+// newQueueRecord constructs the record for a queued message
+func newQueueRecord(msg *message) QueueRecord {
+	return QueueRecord{
+		Type:      msg.messageType,
+		Data:      msg.data,
+		Priority:  msg.priority,
+		QueuedAt:  msg.queuedAt,
+		ExpiresAt: msg.expiresAt,
+		Key:       msg.key,
+	}
+}
+
+// message constructs the queued message a record was made from
+func (r QueueRecord) message() *message {
+	msg := newMessage(r.Type, r.Data)
+	msg.priority = r.Priority
+	msg.queuedAt = r.QueuedAt
+	msg.expiresAt = r.ExpiresAt
+	msg.key = r.Key
+	return msg
+}
+
+// BinaryQueueCodec defines a compact queue codec. A record is the format version followed by tagged fields, each
+// prefixed with its tag and length, so fields added later are skipped by older readers. It is the default queue codec
+type BinaryQueueCodec struct{}
+
+// Encode encodes a record as the version followed by its fields. Empty fields are left out
+func (BinaryQueueCodec) Encode(record QueueRecord) ([]byte, error) {
+	encoded := make([]byte, 0, len(record.Data)+len(record.Key)+32)
+	encoded = appendUvarint(encoded, queueRecordVersion)
+
+	field := func(tag uint64, value []byte) {
+		encoded = appendUvarint(encoded, tag)
+		encoded = appendUvarint(encoded, uint64(len(value)))
+		encoded = append(encoded, value...)
+	}
+	number := func(tag uint64, value int64) {
+		field(tag, appendVarint(nil, value))
+	}
+
+	number(queueFieldType, int64(record.Type))
+	field(queueFieldData, record.Data)
+	if record.Priority != PriorityNormal {
+		number(queueFieldPriority, int64(record.Priority))
+	}
+	if !record.QueuedAt.IsZero() {
+		number(queueFieldQueuedAt, record.QueuedAt.UnixNano())
+	}
+	if !record.ExpiresAt.IsZero() {
+		number(queueFieldExpiresAt, record.ExpiresAt.UnixNano())
+	}
+	if record.Key != "" {
+		field(queueFieldKey, []byte(record.Key))
+	}
+
+	return encoded, nil
+}
+
+// Decode decodes a record, skipping fields it doesn't know. Fails if the record is truncated or was written with an
+// incompatible format version
+func (BinaryQueueCodec) Decode(data []byte) (QueueRecord, error) {
+	record := QueueRecord{}
+
+	version, n := binary.Uvarint(data)
+	if n <= 0 {
+		return record, fmt.Errorf("%w: missing version", ErrQueueRecord)
+	}
+	if version != queueRecordVersion {
+		return record, fmt.Errorf("%w: unsupported version %d", ErrQueueRecord, version)
+	}
+	data = data[n:]
+
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return record, fmt.Errorf("%w: truncated field tag", ErrQueueRecord)
+		}
+		data = data[n:]
+
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return record, fmt.Errorf("%w: truncated field %d", ErrQueueRecord, tag)
+		}
+		value := data[n : n+int(length)]
+		data = data[n+int(length):]
+
+		var number int64
+		if tag == queueFieldType || tag == queueFieldPriority || tag == queueFieldQueuedAt || tag == queueFieldExpiresAt {
+			number, n = binary.Varint(value)
+			if n <= 0 {
+				return record, fmt.Errorf("%w: malformed field %d", ErrQueueRecord, tag)
+			}
+		}
+
+		switch tag {
+		case queueFieldType:
+			record.Type = int(number)
+		case queueFieldData:
+			record.Data = value
+		case queueFieldPriority:
+			record.Priority = Priority(number)
+		case queueFieldQueuedAt:
+			record.QueuedAt = time.Unix(0, number)
+		case queueFieldExpiresAt:
+			record.ExpiresAt = time.Unix(0, number)
+		case queueFieldKey:
+			record.Key = string(value)
+		}
+	}
+
+	return record, nil
+}
+
+// jsonQueueRecord defines the JSON form of a queue record
+type jsonQueueRecord struct {
+	Version   int        `json:"v"`
+	Type      int        `json:"type"`
+	Data      []byte     `json:"data"`
+	Priority  Priority   `json:"priority,omitempty"`
+	QueuedAt  *time.Time `json:"queuedAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Key       string     `json:"key,omitempty"`
+}
+
+// JSONQueueCodec defines a queue codec that stores records as JSON objects, which is larger than the binary codec but
+// easy to inspect. Unknown fields are ignored, so fields added later are skipped by older readers
+type JSONQueueCodec struct{}
+
+// Encode encodes a record as a JSON object
+func (JSONQueueCodec) Encode(record QueueRecord) ([]byte, error) {
+	encoded := jsonQueueRecord{
+		Version:  queueRecordVersion,
+		Type:     record.Type,
+		Data:     record.Data,
+		Priority: record.Priority,
+		Key:      record.Key,
+	}
+	if !record.QueuedAt.IsZero() {
+		encoded.QueuedAt = &record.QueuedAt
+	}
+	if !record.ExpiresAt.IsZero() {
+		encoded.ExpiresAt = &record.ExpiresAt
+	}
+
+	return json.Marshal(encoded)
+}
+
+// Decode decodes a record from a JSON object. Fails if it isn't valid or was written with an incompatible format
+// version
+func (JSONQueueCodec) Decode(data []byte) (QueueRecord, error) {
+	decoded := jsonQueueRecord{}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return QueueRecord{}, fmt.Errorf("%w: %v", ErrQueueRecord, err)
+	}
+	if decoded.Version != queueRecordVersion {
+		return QueueRecord{}, fmt.Errorf("%w: unsupported version %d", ErrQueueRecord, decoded.Version)
+	}
+
+	record := QueueRecord{
+		Type:     decoded.Type,
+		Data:     decoded.Data,
+		Priority: decoded.Priority,
+		Key:      decoded.Key,
+	}
+	if decoded.QueuedAt != nil {
+		record.QueuedAt = *decoded.QueuedAt
+	}
+	if decoded.ExpiresAt != nil {
+		record.ExpiresAt = *decoded.ExpiresAt
+	}
+	return record, nil
+}
+
+// appendUvarint appends an unsigned varint to the buffer
+func appendUvarint(buffer []byte, value uint64) []byte {
+	encoded := make([]byte, binary.MaxVarintLen64)
+	return append(buffer, encoded[:binary.PutUvarint(encoded, value)]...)
+}
+
+// appendVarint appends a signed varint to the buffer
+func appendVarint(buffer []byte, value int64) []byte {
+	encoded := make([]byte, binary.MaxVarintLen64)
+	return append(buffer, encoded[:binary.PutVarint(encoded, value)]...)
+}
+
+// getQueueCodec gets the configured queue codec, falling back to the binary codec
+func (c *Configuration) getQueueCodec() QueueCodec {
+	if c.QueueCodec != nil {
+		return c.QueueCodec
+	}
+
+	return BinaryQueueCodec{}
+}
@@ -0,0 +1,123 @@
+package gows
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter defines a limiter on outbound messages. Reserve takes a token and returns how long the caller has to wait
+// before using it. A single limiter can be shared by several websockets, e.g. a pool of connections to one provider,
+// so their aggregate rate honors an account-level limit
+type RateLimiter interface {
+	Reserve() time.Duration
+}
+
+// TokenBucket defines a thread-safe token bucket rate limiter
+type TokenBucket struct {
+	lock   *sync.Mutex
+	rate   float64   // Tokens added per second
+	burst  float64   // Maximum number of tokens in the bucket
+	tokens float64   // Tokens currently in the bucket, negative when reservations are outstanding
+	last   time.Time // When the bucket was last refilled
+}
+
+// NewTokenBucket constructs a new token bucket that allows the supplied number of messages per second on average, and
+// bursts of up to the supplied size
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		lock:   &sync.Mutex{},
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Reserve takes a token, returning how long to wait before it becomes available
+func (b *TokenBucket) Reserve() time.Duration {
+	return b.ReserveN(1)
+}
+
+// ReserveN takes the supplied number of tokens, returning how long to wait before they become available. Reservations
+// bigger than the burst size are allowed, and leave the bucket in debt for longer
+func (b *TokenBucket) ReserveN(n int) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+
+	// Take the tokens. If that leaves the bucket in debt, wait for the debt to be paid off
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Allow takes a token if one is available right away, returning false without waiting if the bucket is empty
+func (b *TokenBucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// refill adds the tokens for the time that has passed since the last refill. Must be called with the lock held
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// waitForRateLimit waits for the configured rate limiter to allow another message, returning false if the sender was
+// stopped while waiting
+func (ws *Websocket) waitForRateLimit(stopChannel chan struct{}) bool {
+	if ws.configuration.RateLimiter == nil {
+		return true
+	}
+
+	delay := ws.configuration.RateLimiter.Reserve()
+	if delay <= 0 {
+		return true
+	}
+
+	ws.configuration.Logger.Trace("SENDER: Rate limited, waiting", delay)
+	return sleep(stopChannel, delay)
+}
+
+// newBandwidthLimiter constructs the byte bucket that shapes outbound traffic, or nil if there's no bandwidth cap. The
+// burst defaults to one second's worth of bytes
+func newBandwidthLimiter(bytesPerSecond int, burst int) *TokenBucket {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+
+	return NewTokenBucket(float64(bytesPerSecond), burst)
+}
+
+// waitForBandwidth waits for the bandwidth cap to allow the supplied number of payload bytes, returning false if the
+// sender was stopped while waiting
+func (ws *Websocket) waitForBandwidth(stopChannel chan struct{}, size int) bool {
+	if ws.bandwidth == nil || size == 0 {
+		return true
+	}
+
+	delay := ws.bandwidth.ReserveN(size)
+	if delay <= 0 {
+		return true
+	}
+
+	ws.configuration.Logger.Trace("SENDER: Bandwidth limited, waiting", delay)
+	return sleep(stopChannel, delay)
+}
@@ -0,0 +1,152 @@
+package gows
+
+import "sync"
+
+// unacked defines a thread-safe, ordered registry of reliable messages that the peer hasn't acknowledged yet, keyed by
+// delivery ID
+type unacked struct {
+	lock     *sync.Mutex
+	order    []string
+	messages map[string]*message
+	generate func() string
+}
+
+// newUnacked constructs a new unacknowledged message registry, using the supplied ID generator or sequential IDs if
+// it's nil
+func newUnacked(generate func() string) *unacked {
+	if generate == nil {
+		generate = SequentialIDs()
+	}
+
+	return &unacked{
+		lock:     &sync.Mutex{},
+		order:    make([]string, 0),
+		messages: make(map[string]*message),
+		generate: generate,
+	}
+}
+
+// next generates the delivery ID for a new reliable message
+func (u *unacked) next() string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return u.generate()
+}
+
+// add registers a message as awaiting an acknowledgement
+func (u *unacked) add(id string, msg *message) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.order = append(u.order, id)
+	u.messages[id] = msg
+}
+
+// ack removes the message with the supplied delivery ID, returning false if there's no such message waiting
+func (u *unacked) ack(id string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if _, ok := u.messages[id]; !ok {
+		return false
+	}
+
+	delete(u.messages, id)
+	for i, existing := range u.order {
+		if existing == id {
+			u.order = append(u.order[:i], u.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// pending gets the unacknowledged messages in the order they were sent
+func (u *unacked) pending() []*message {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	messages := make([]*message, 0, len(u.order))
+	for _, id := range u.order {
+		messages = append(messages, u.messages[id])
+	}
+	return messages
+}
+
+// length gets the number of unacknowledged messages
+func (u *unacked) length() int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return len(u.order)
+}
+
+// SendReliable sends a message with at-least-once delivery, returning its delivery ID. The message is kept until
+// the peer acknowledges it, and is sent again after every reconnect until then. If an AckInjector is configured, it
+// attaches the ID to the message, and acknowledgements are recognized by the AckExtractor. Otherwise, the application
+// acknowledges messages itself with Ack()
+func (ws *Websocket) SendReliable(msg []byte) (string, error) {
+	id := ws.unacked.next()
+
+	// Attach the delivery ID to the message if there's an ack protocol
+	if ws.configuration.AckInjector != nil {
+		var err error
+		msg, err = ws.configuration.AckInjector(id, msg)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Register the message before it's queued, so a fast acknowledgement can't beat us to the registry
+	err := ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		queued.key = id
+		ws.unacked.add(id, queued)
+	})
+	if err != nil {
+		ws.unacked.ack(id)
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Ack acknowledges the reliable message with the supplied delivery ID, so it's no longer sent again after a reconnect.
+// Returns false if there's no such message waiting for an acknowledgement
+func (ws *Websocket) Ack(id string) bool {
+	return ws.unacked.ack(id)
+}
+
+// UnackedLength gets the number of reliable messages waiting for an acknowledgement
+func (ws *Websocket) UnackedLength() int {
+	return ws.unacked.length()
+}
+
+// checkAck attempts to match an inbound message to an unacknowledged message, returning true if it was an
+// acknowledgement
+func (ws *Websocket) checkAck(msg []byte) bool {
+	if ws.configuration.AckExtractor == nil {
+		return false
+	}
+
+	id, ok := ws.configuration.AckExtractor(msg)
+	if !ok {
+		return false
+	}
+
+	if !ws.unacked.ack(id) {
+		ws.configuration.Logger.Debug("Received acknowledgement for unknown message", id)
+	}
+	return true
+}
+
+// redeliver puts every unacknowledged message that was already sent back at the front of the send queue, in the order
+// they were originally sent. Messages still waiting in the queue keep their place
+func (ws *Websocket) redeliver() {
+	messages := ws.sendQueue.requeueMissing(ws.unacked.pending())
+	if messages == 0 {
+		return
+	}
+
+	ws.configuration.Logger.Debug("Redelivering", messages, "unacknowledged messages")
+}
@@ -0,0 +1,69 @@
+package gows
+
+import "sync"
+
+// ReplayPolicy defines what the consumer does with inbound messages that fail sequence validation
+type ReplayPolicy int
+
+const (
+	// ReplayFlag reports out-of-order or replayed messages to the replay handler, but still delivers them
+	ReplayFlag ReplayPolicy = iota
+
+	// ReplayDrop reports out-of-order or replayed messages to the replay handler and discards them
+	ReplayDrop
+)
+
+// replayGuard tracks the highest sequence number seen on inbound messages
+type replayGuard struct {
+	lock *sync.Mutex
+	last int64
+	seen bool
+}
+
+// newReplayGuard constructs a new replay guard
+func newReplayGuard() *replayGuard {
+	return &replayGuard{
+		lock: &sync.Mutex{},
+	}
+}
+
+// check validates a sequence number against the highest one seen so far, returning the previous highest sequence and
+// true if the supplied sequence is strictly greater. Accepted sequences become the new high water mark
+func (g *replayGuard) check(sequence int64) (int64, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	last := g.last
+	if g.seen && sequence <= last {
+		return last, false
+	}
+
+	g.last = sequence
+	g.seen = true
+	return last, true
+}
+
+// checkReplay validates an inbound message against the replay guard, returning true if the message should be delivered
+func (ws *Websocket) checkReplay(message []byte) bool {
+	if ws.configuration.InboundSequence == nil {
+		return true
+	}
+
+	// Messages without a sequence can't be validated, let them through
+	sequence, ok := ws.configuration.InboundSequence(message)
+	if !ok {
+		return true
+	}
+
+	last, fresh := ws.replayGuard.check(sequence)
+	if fresh {
+		return true
+	}
+
+	ws.configuration.Logger.Debug("Inbound message with sequence", sequence, "is not newer than", last)
+	ws.replayHandlerLock.Lock()
+	ws.replayHandler(message, sequence, last)
+	ws.replayHandlerLock.Unlock()
+
+	return ws.configuration.ReplayPolicy != ReplayDrop
+}
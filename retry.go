@@ -0,0 +1,114 @@
+package gows
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetryPolicy defines how a message is retried when writing it fails for reasons unrelated to the connection, such as
+// an invalid frame. Connection failures are always handled by requeueing the message and reconnecting instead
+type RetryPolicy struct {
+	MaxAttempts int             // The maximum number of write attempts, including the first one
+	Backoff     BackoffStrategy // The delay between attempts, or nil to retry immediately
+}
+
+// SendWithRetry sends a message with the provided body and retry policy
+func (ws *Websocket) SendWithRetry(msg []byte, policy *RetryPolicy) error {
+	return ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		queued.retry = policy
+	})
+}
+
+// retryMessage handles a message with a retry policy that failed to write for reasons unrelated to the connection,
+// putting it back on the queue after the policy's backoff if it has attempts left, or dropping it otherwise
+func (ws *Websocket) retryMessage(msg *message, err error) {
+	msg.attempts++
+
+	if msg.attempts >= msg.retry.MaxAttempts {
+		ws.dropMessage(msg.data, err)
+		ws.unpersist(msg)
+		return
+	}
+
+	delay := time.Duration(0)
+	if msg.retry.Backoff != nil {
+		delay = msg.retry.Backoff.Next(msg.attempts - 1)
+	}
+
+	ws.configuration.Logger.Debug("Retrying message after failed write attempt", msg.attempts, "in", delay)
+	ws.retries.schedule(msg, delay, ws.sendQueue.requeue)
+}
+
+// retries defines the thread-safe set of messages waiting out their retry backoff before going back on the queue
+type retries struct {
+	lock   *sync.Mutex
+	timers map[*message]*time.Timer
+}
+
+// newRetries constructs a new, empty set of waiting retries
+func newRetries() *retries {
+	return &retries{
+		lock:   &sync.Mutex{},
+		timers: make(map[*message]*time.Timer),
+	}
+}
+
+// schedule calls requeue with the message once the delay is up, unless the retry is flushed first
+func (r *retries) schedule(msg *message, delay time.Duration, requeue func(*message)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.timers[msg] = time.AfterFunc(delay, func() {
+		if r.take(msg) {
+			requeue(msg)
+		}
+	})
+}
+
+// take removes a waiting retry, returning false if it was already flushed
+func (r *retries) take(msg *message) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.timers[msg]
+	delete(r.timers, msg)
+	return ok
+}
+
+// pending gets the number of messages waiting out their retry backoff
+func (r *retries) pending() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.timers)
+}
+
+// flush cancels every waiting retry, returning the messages in no particular order
+func (r *retries) flush() []*message {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	msgs := make([]*message, 0, len(r.timers))
+	for msg, timer := range r.timers {
+		timer.Stop()
+		msgs = append(msgs, msg)
+	}
+	r.timers = make(map[*message]*time.Timer)
+	return msgs
+}
+
+// flushRetries puts every message waiting out its retry backoff back on the queue right away. Called when the websocket
+// stops, so retries don't trickle into the queue of a stopped websocket afterwards. The messages stay queued like any
+// other, and are sent if the websocket is connected again
+func (ws *Websocket) flushRetries() {
+	msgs := ws.retries.flush()
+	if len(msgs) == 0 {
+		return
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].queuedAt.Before(msgs[j].queuedAt)
+	})
+	ws.sendQueue.requeueAll(msgs)
+}
@@ -0,0 +1,148 @@
+package gows
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultTopicSeparator is the separator between topic levels when none is configured
+const defaultTopicSeparator = "/"
+
+// TopicHandler defines a handler registered for a topic pattern with Subscribe
+type TopicHandler struct {
+	router  *router
+	pattern string
+	handler func(topic string, msg []byte)
+}
+
+// Remove stops the handler from receiving messages
+func (h *TopicHandler) Remove() {
+	h.router.remove(h)
+}
+
+// Pattern gets the topic pattern the handler was registered for
+func (h *TopicHandler) Pattern() string {
+	return h.pattern
+}
+
+// router defines a thread-safe registry of topic handlers, matching inbound topics against their patterns
+type router struct {
+	lock      *sync.Mutex
+	separator string
+	handlers  []*TopicHandler
+}
+
+// newRouter constructs a new topic router using the supplied level separator
+func newRouter(separator string) *router {
+	if separator == "" {
+		separator = defaultTopicSeparator
+	}
+
+	return &router{
+		lock:      &sync.Mutex{},
+		separator: separator,
+		handlers:  make([]*TopicHandler, 0),
+	}
+}
+
+// add registers a handler for a topic pattern
+func (r *router) add(pattern string, handler func(string, []byte)) *TopicHandler {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	topicHandler := &TopicHandler{router: r, pattern: pattern, handler: handler}
+	r.handlers = append(r.handlers, topicHandler)
+	return topicHandler
+}
+
+// remove unregisters a handler
+func (r *router) remove(topicHandler *TopicHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, existing := range r.handlers {
+		if existing == topicHandler {
+			r.handlers = append(r.handlers[:i], r.handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// removePattern unregisters every handler for a topic pattern
+func (r *router) removePattern(pattern string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	kept := make([]*TopicHandler, 0, len(r.handlers))
+	for _, existing := range r.handlers {
+		if existing.pattern != pattern {
+			kept = append(kept, existing)
+		}
+	}
+	r.handlers = kept
+}
+
+// match gets the handlers whose patterns match the supplied topic, in registration order
+func (r *router) match(topic string) []*TopicHandler {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	matched := make([]*TopicHandler, 0)
+	for _, topicHandler := range r.handlers {
+		if matchTopic(topicHandler.pattern, topic, r.separator) {
+			matched = append(matched, topicHandler)
+		}
+	}
+	return matched
+}
+
+// matchTopic determines if a topic matches an MQTT-style pattern. A "+" level matches exactly one level, and a "#"
+// level at the end of the pattern matches any number of remaining levels, including none
+func matchTopic(pattern string, topic string, separator string) bool {
+	patternLevels := strings.Split(pattern, separator)
+	topicLevels := strings.Split(topic, separator)
+
+	for i, level := range patternLevels {
+		if level == "#" {
+			return i == len(patternLevels)-1
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(patternLevels) == len(topicLevels)
+}
+
+// Subscribe registers a handler for inbound messages whose topic, as determined by the configured topic extractor,
+// matches the supplied pattern. Patterns support MQTT-style wildcards: "+" matches a single topic level and a trailing
+// "#" matches any number of levels, so "prices/+/usd" matches "prices/btc/usd" and "prices/#" matches every price
+// topic. Messages matched by at least one topic handler aren't passed to the message handler
+func (ws *Websocket) Subscribe(pattern string, handler func(topic string, msg []byte)) *TopicHandler {
+	return ws.router.add(pattern, handler)
+}
+
+// route passes a message to every topic handler matching its topic using the supplied handle function, returning false
+// if no handlers matched
+func (ws *Websocket) route(topic string, data []byte, handle func(func())) bool {
+	matched := ws.router.match(topic)
+	if len(matched) == 0 {
+		return false
+	}
+
+	handle(func() {
+		ws.configuration.Logger.Trace("DISPATCHER: Calling", len(matched), "topic handlers for", topic)
+		for _, topicHandler := range matched {
+			ws.measure("topic:"+topicHandler.pattern, func() {
+				topicHandler.handler(topic, data)
+			})
+		}
+		ws.configuration.Logger.Trace("DISPATCHER: Successfully called topic handlers")
+	})
+	return true
+}
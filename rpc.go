@@ -0,0 +1,118 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// requests defines a thread-safe registry of in-flight requests, keyed by correlation ID
+type requests struct {
+	lock     *sync.Mutex
+	pending  map[string]chan []byte
+	generate func() string
+}
+
+// newRequests constructs a new request registry, using the supplied ID generator or sequential IDs if it's nil
+func newRequests(generate func() string) *requests {
+	if generate == nil {
+		generate = SequentialIDs()
+	}
+
+	return &requests{
+		lock:     &sync.Mutex{},
+		pending:  make(map[string]chan []byte),
+		generate: generate,
+	}
+}
+
+// register generates a new correlation ID and registers a response channel for it
+func (r *requests) register() (string, chan []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	id := r.generate()
+	responseChannel := make(chan []byte, 1)
+	r.pending[id] = responseChannel
+
+	return id, responseChannel
+}
+
+// unregister removes the response channel for the supplied correlation ID
+func (r *requests) unregister(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.pending, id)
+}
+
+// resolve delivers a response to the request with the supplied correlation ID, returning false if there is no such
+// request waiting
+func (r *requests) resolve(id string, response []byte) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	responseChannel, ok := r.pending[id]
+	if !ok {
+		return false
+	}
+
+	delete(r.pending, id)
+	responseChannel <- response
+	return true
+}
+
+// Request sends a message with a correlation ID attached and waits for the matching response. The request is abandoned
+// when the context is cancelled or the configured request timeout expires, whichever comes first
+func (ws *Websocket) Request(ctx context.Context, payload []byte) ([]byte, error) {
+	if ws.configuration.CorrelationInjector == nil || ws.configuration.CorrelationExtractor == nil {
+		return nil, errors.New("request correlation is not configured")
+	}
+
+	// Apply the default timeout if one is configured
+	if ws.configuration.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.configuration.RequestTimeout)
+		defer cancel()
+	}
+
+	// Register the request before sending, so a fast response can't beat us to the registry
+	id, responseChannel := ws.requests.register()
+	message, err := ws.configuration.CorrelationInjector(id, payload)
+	if err != nil {
+		ws.requests.unregister(id)
+		return nil, err
+	}
+
+	ws.configuration.Logger.Trace("Sending request", id)
+	err = ws.SendErr(message)
+	if err != nil {
+		ws.requests.unregister(id)
+		return nil, err
+	}
+
+	select {
+	case response := <-responseChannel:
+		ws.configuration.Logger.Trace("Received response for request", id)
+		return response, nil
+
+	case <-ctx.Done():
+		ws.configuration.Logger.Trace("Request", id, "abandoned:", ctx.Err())
+		ws.requests.unregister(id)
+		return nil, ctx.Err()
+	}
+}
+
+// resolveResponse attempts to match an inbound message to an in-flight request, returning true if it was consumed
+func (ws *Websocket) resolveResponse(message []byte) bool {
+	if ws.configuration.CorrelationExtractor == nil {
+		return false
+	}
+
+	id, ok := ws.configuration.CorrelationExtractor(message)
+	if !ok {
+		return false
+	}
+
+	return ws.requests.resolve(id, message)
+}
@@ -0,0 +1,167 @@
+package gows
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// SamplingPolicy defines how many inbound messages are delivered from a high-volume stream
+type SamplingPolicy struct {
+	EveryN       int     // Deliver one in every N messages, zero or one delivers every message
+	MaxPerSecond float64 // Deliver at most this many messages per second, zero for no limit
+}
+
+// samplingKey defines the sampling state for a single key, the topic for topic rules or everything for the global rule
+type samplingKey struct {
+	key    string
+	seen   uint64       // The number of messages seen
+	bucket *TokenBucket // Limits the delivery rate, nil without a rate limit
+}
+
+// samplingRule defines a sampling policy applied to every topic matching a pattern, with independent state per topic.
+// State is kept for up to the limit of topics, evicting the one that received a message least recently, which starts
+// over with fresh state if it's seen again
+type samplingRule struct {
+	pattern string
+	policy  SamplingPolicy
+	limit   int
+	keys    map[string]*list.Element // The list element holding every key's state
+	recency *list.List               // Every key's state, the one that received a message most recently first
+}
+
+// sampler defines a thread-safe registry of sampling rules
+type sampler struct {
+	lock      *sync.Mutex
+	separator string
+	limit     int // The number of topics each rule keeps state for
+	global    *samplingRule
+	rules     []*samplingRule
+}
+
+// newSampler constructs a new sampler without any rules, keeping state for up to the supplied number of topics per rule
+func newSampler(separator string, limit int) *sampler {
+	if separator == "" {
+		separator = defaultTopicSeparator
+	}
+
+	return &sampler{
+		lock:      &sync.Mutex{},
+		separator: separator,
+		limit:     limit,
+		rules:     make([]*samplingRule, 0),
+	}
+}
+
+// newSamplingRule constructs a new sampling rule
+func (s *sampler) newSamplingRule(pattern string, policy SamplingPolicy) *samplingRule {
+	return &samplingRule{
+		pattern: pattern,
+		policy:  policy,
+		limit:   s.limit,
+		keys:    make(map[string]*list.Element),
+		recency: list.New(),
+	}
+}
+
+// set sets the policy for a topic pattern, or the global policy for an empty pattern, replacing any existing one
+func (s *sampler) set(pattern string, policy SamplingPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if pattern == "" {
+		s.global = s.newSamplingRule(pattern, policy)
+		return
+	}
+
+	for i, rule := range s.rules {
+		if rule.pattern == pattern {
+			s.rules[i] = s.newSamplingRule(pattern, policy)
+			return
+		}
+	}
+	s.rules = append(s.rules, s.newSamplingRule(pattern, policy))
+}
+
+// clear removes the policy for a topic pattern, or the global policy for an empty pattern
+func (s *sampler) clear(pattern string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if pattern == "" {
+		s.global = nil
+		return
+	}
+
+	for i, rule := range s.rules {
+		if rule.pattern == pattern {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return
+		}
+	}
+}
+
+// sample determines if a message should be delivered. The global policy applies to every message, and the first topic
+// rule matching the message's topic applies on top of it
+func (s *sampler) sample(topic string, hasTopic bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.global != nil && !s.global.sample("") {
+		return false
+	}
+
+	if !hasTopic {
+		return true
+	}
+
+	for _, rule := range s.rules {
+		if matchTopic(rule.pattern, topic, s.separator) {
+			return rule.sample(topic)
+		}
+	}
+	return true
+}
+
+// sample determines if a message with the supplied key should be delivered under the rule
+func (r *samplingRule) sample(key string) bool {
+	element, ok := r.keys[key]
+	if ok {
+		r.recency.MoveToFront(element)
+	} else {
+		if len(r.keys) >= r.limit {
+			oldest := r.recency.Back()
+			delete(r.keys, oldest.Value.(*samplingKey).key)
+			r.recency.Remove(oldest)
+		}
+
+		state := &samplingKey{key: key}
+		if r.policy.MaxPerSecond > 0 {
+			state.bucket = NewTokenBucket(r.policy.MaxPerSecond, int(math.Max(1, r.policy.MaxPerSecond)))
+		}
+		element = r.recency.PushFront(state)
+		r.keys[key] = element
+	}
+	state := element.Value.(*samplingKey)
+
+	// Deliver the first of every N messages
+	state.seen++
+	if r.policy.EveryN > 1 && (state.seen-1)%uint64(r.policy.EveryN) != 0 {
+		return false
+	}
+
+	return state.bucket == nil || state.bucket.Allow()
+}
+
+// SetSampling samples inbound messages on topics matching the supplied pattern, so only some of them are delivered.
+// Every matching topic is sampled independently, keeping state for up to MaxTrackedTopics topics per pattern. An empty
+// pattern sets the global policy, which applies to every inbound message, including those without a topic. Policies can
+// be changed at any time, and replace any existing policy for the same pattern
+func (ws *Websocket) SetSampling(pattern string, policy SamplingPolicy) {
+	ws.sampler.set(pattern, policy)
+}
+
+// ClearSampling stops sampling topics matching the supplied pattern, or clears the global policy for an empty pattern
+func (ws *Websocket) ClearSampling(pattern string) {
+	ws.sampler.clear(pattern)
+}
@@ -5,32 +5,99 @@ import (
 	"time"
 )
 
-// sender defines A simple goroutine that ensures all message are sent sequentially
-func (ws *Websocket) sender() {
+// sendWindowPollInterval is how often the sender checks if a closed send window has opened again
+const sendWindowPollInterval = 50 * time.Millisecond
 
-	// Set up a ping interval and shut it down when we exit this goroutine
-	pingTicker := time.NewTicker(ws.configuration.PingInterval)
-	defer pingTicker.Stop()
+// sender defines A simple goroutine that ensures all message are sent sequentially. Pings are written separately by
+// the pinger, so they go out even while a large message is being written. By default, the queue wakes the sender up as
+// soon as there's something to send. With a flush interval, the sender ignores the queue and flushes on every tick
+// instead, batching messages that arrive in between. With adaptive batching, it only does so while the queue is deep
+func (ws *Websocket) sender(stopChannel chan struct{}) {
 
-	// Set up an interval for flushing messages
-	flushTicker := time.NewTicker(50 * time.Millisecond)
-	defer flushTicker.Stop()
+	// Listen for queue signals, unless we're batching on a flush interval
+	queueSignal := ws.sendQueue.signal
+	if ws.configuration.FlushInterval > 0 {
+		queueSignal = nil
+	}
+
+	// Set up an interval for flushing messages if we're batching, or for checking a closed send window
+	var flushTick <-chan time.Time
+	if interval := ws.configuration.getFlushInterval(); interval > 0 {
+		flushTicker := time.NewTicker(interval)
+		defer flushTicker.Stop()
+		flushTick = flushTicker.C
+	}
+
+	// Set up the interval for flushing messages while adaptive batching is batching
+	var batchTick <-chan time.Time
+	if ws.configuration.adaptiveBatching() {
+		batchTicker := time.NewTicker(ws.configuration.getBatchingFlushInterval())
+		defer batchTicker.Stop()
+		batchTick = batchTicker.C
+	}
 
 	// Set up a channel to do another pop
 	continueChannel := make(chan struct{}, 1)
 
+	// Set up the function that schedules another pop if there are messages remaining in the queue
+	continueFlush := func(remaining int) {
+
+		// If there are no more messages to send, we're done here for now
+		if remaining == 0 {
+			ws.configuration.Logger.Trace("SENDER: No more messages to send, waiting for more")
+			return
+		}
+
+		// There are more messages to send, write onto the repeat channel
+		ws.configuration.Logger.Trace("SENDER: More messages remaining, continuing the flush")
+		select {
+		case continueChannel <- struct{}{}:
+		default:
+		}
+	}
+
 	// Set up the function that sends the message. This function is responsible for popping the message out of the queue,
 	// sending it with a write deadline, requeueing it if there's a send failure, and writing to the continueChannel if
 	// there are more messages to send. It returns true if an error is encountered and the goroutine should be stopped.
-	// Writing this function here allows us to call it from two different select cases, which ensures that we send pings
-	// even when the queue contains messages.
+	// Writing this function here allows us to call it from two different select cases.
 	sendMessage := func() bool {
 
+		// If the send window is closed and we're supposed to wait, leave everything in the queue
+		windowOpen := ws.configuration.sendWindowOpen(ws.now())
+		if !windowOpen && ws.configuration.SendWindowPolicy == SendWindowWait {
+			return false
+		}
+
 		// Pop a message from the queue. If there aren't any, we're done here
 		msg, remaining := ws.sendQueue.pop()
 		if msg == nil {
 			return false
 		}
+		defer ws.sendQueue.finish()
+		ws.checkWatermarks()
+
+		// The send window is closed and we're supposed to drop, discard the message and keep flushing
+		if !windowOpen {
+			ws.configuration.Logger.Trace("SENDER: Send window is closed, dropping message")
+			ws.dropMessage(msg.data, errSendWindowClosed)
+			ws.unpersist(msg)
+			continueFlush(remaining)
+			return false
+		}
+
+		// The message outlived its TTL while it was queued, discard it and keep flushing
+		if ws.expired(msg, ws.now()) {
+			ws.configuration.Logger.Trace("SENDER: Message expired, dropping it")
+			ws.unpersist(msg)
+			continueFlush(remaining)
+			return false
+		}
+
+		// Wait for the rate limiter. If we're stopped while waiting, requeue the message and kill this goroutine
+		if !ws.waitForRateLimit(stopChannel) {
+			ws.sendQueue.requeue(msg)
+			return true
+		}
 
 		// Get the connection. If it's nil, we're about to be restarted. Requeue the message and kill this goroutine,
 		// the reviver will restart us when a new connection is established
@@ -42,109 +109,186 @@ func (ws *Websocket) sender() {
 			return true
 		}
 
+		// Run the message through the outbound middleware, dropping it if that fails
+		wire, err := ws.applyOutbound(msg)
+		if err != nil {
+			ws.configuration.Logger.Trace("SENDER: Outbound middleware failed, dropping message")
+			ws.dropMessage(msg.data, err)
+			ws.unpersist(msg)
+			continueFlush(remaining)
+			return false
+		}
+
+		// Wait for the bandwidth cap to allow the payload. If we're stopped while waiting, requeue the message and kill
+		// this goroutine
+		if !ws.waitForBandwidth(stopChannel, wire.size()) {
+			ws.sendQueue.requeue(msg)
+			return true
+		}
+
 		// Write the message, returning true if there are more messages to send
 		ws.configuration.Logger.Trace("SENDER: Writing message...")
-		_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
-		err := connection.WriteMessage(websocket.BinaryMessage, msg)
+		start := ws.profiler.start()
+		span := ws.startSendSpan(wire)
+		err = wrapError(ws.write(connection, wire))
+		endSpan(span, err)
+
+		// The message itself couldn't be written, but the connection is fine. If it has a retry policy, retry it per the
+		// policy and carry on. Messages without a policy are requeued and the connection is dropped, like any failed write
+		if err != nil && msg.retry != nil && !isConnectionError(err) {
+			ws.configuration.Logger.Trace("SENDER: Failed to write message, applying its retry policy...")
+			ws.retryMessage(msg, err)
+			continueFlush(remaining)
+			return false
+		}
+
+		// A streamed message failed part way through, and its payload is gone. Drop it and flag the websocket drop
+		if err != nil && msg.stream != nil {
+			ws.configuration.Logger.Trace("SENDER: Streamed message failed, dropping it and flagging the websocket drop...")
+			ws.dropMessage(nil, err)
+			ws.reportError(err)
+			ws.handleConnectionError(err)
+			return true
+		}
 
 		// There was a write timeout, re-queue the message and kill this goroutine. It will be revived and the message
 		// will be sent when the connection is re-established
 		if err != nil {
 			ws.configuration.Logger.Trace("SENDER: Encountered write timeout, requeing message and flagging the websocket drop...")
 			ws.sendQueue.requeue(msg)
+			ws.reportError(err)
 			ws.handleConnectionError(err)
 			ws.configuration.Logger.Trace("SENDER: Successfully requeued message and flagged websocket drop")
 			return true
 		}
 
 		ws.configuration.Logger.Trace("SENDER: Successfully wrote message")
+		ws.profiler.sent(start)
+		ws.unpersist(msg)
+		ws.sentInSession(msg)
+		ws.throughput.sent(wire.size(), ws.now())
+		ws.sentTraffic(msg, wire.size())
 
-		// If there are no more messages to send, we're done here for now
-		if remaining == 0 {
-			ws.configuration.Logger.Trace("SENDER: No more messages to send, sleeping for 50ms")
-			return false
-		}
-
-		// There are more messages to send, write onto the repeat channel
-		ws.configuration.Logger.Trace("SENDER: More messages remaining, continuing the flush")
-		select {
-		case continueChannel <- struct{}{}:
-		default:
-		}
-
+		continueFlush(remaining)
 		return false
 	}
 
-	// For consistency with the above function, set up another function responsible for sending ping messages. Like the
-	// function above, this function returns true when the goroutine should be stopped.
-	sendPing := func() bool {
-
-		// Get the connection. If it's nil, we're about to restarted. Ignore the ping and kill this goroutine, the
-		// reviver will restart us when a new connection comes in
-		connection := ws.getConnection()
-		if connection == nil {
-			ws.configuration.Logger.Trace("SENDER: No connection for ping, shutting down")
-			return true
-		}
-
-		// Write the ping message. If there's a timeout, clean up the stop channel, write the error, and kill this goroutine
-		ws.configuration.Logger.Trace("SENDER: Writing ping message")
-		_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
-		err := connection.WriteMessage(websocket.PingMessage, nil)
-		if err == nil {
-			ws.configuration.Logger.Trace("SENDER: Successfully wrote ping")
-			return false
-		}
-
-		// There was a write timeout, clean up the stop channel, write the error, and kill this goroutine
-		ws.configuration.Logger.Trace("SENDER: Encountered ping timeout, flagging the websocket drop...")
-		ws.handleConnectionError(err)
-		ws.configuration.Logger.Trace("SENDER: Successfully flagged websocket drop")
-		return true
+	// Flush whatever was queued while we weren't running
+	if sendMessage() {
+		return
 	}
 
 	// Run the main goroutine loop
 	for {
+
+		// While adaptive batching is batching, wait for the next batch tick instead of sending as messages are queued
+		signal, batch := queueSignal, (<-chan time.Time)(nil)
+		if batchTick != nil && ws.updateBatching() {
+			signal, batch = nil, batchTick
+		}
+
 		select {
 
 		// Stopped, kill this goroutine
-		case <-ws.senderStopChannel:
+		case <-stopChannel:
 			ws.configuration.Logger.Trace("SENDER: Shutting down")
 			return
 
-		// Check the message queue every 50ms
-		case <-flushTicker.C:
+		// Messages were queued, send them right away
+		case <-signal:
 			if sendMessage() {
 				return
 			}
 
-		// If we finished a send and there are still more queued messages, do the send again. Since this is part of the
-		// select, it allows us to gracefully pause to send a ping or react to a shut down.
-		case <-continueChannel:
+		// Flush the batched messages
+		case <-batch:
 			if sendMessage() {
 				return
 			}
 
-		// Send a ping
-		case <-pingTicker.C:
-			if sendPing() {
+		// Flush the message queue on every tick
+		case <-flushTick:
+			if sendMessage() {
 				return
 			}
+
+		// If we finished a send and there are still more queued messages, do the send again. Since this is part of the
+		// select, it allows us to gracefully react to a shut down.
+		case <-continueChannel:
+			if sendMessage() {
+				return
+			}
+
 		}
 	}
 }
 
-// startSender starts the sender goroutine
+// getFlushInterval gets the interval the sender flushes the queue on. That's the configured flush interval when
+// batching, or the send window poll interval when a send window is configured. Zero means the sender only flushes when
+// the queue signals it
+func (c *Configuration) getFlushInterval() time.Duration {
+	if c.FlushInterval > 0 {
+		return c.FlushInterval
+	}
+
+	if c.SendWindow != nil {
+		return sendWindowPollInterval
+	}
+
+	return 0
+}
+
+// write writes a message to the connection with a write deadline, in chunks if the message reports its progress, or as
+// its prepared frame if it has one
+func (ws *Websocket) write(connection *websocket.Conn, msg *message) error {
+	ws.setWriteCompression(connection, msg)
+	if msg.stream != nil {
+		return ws.writeStream(connection, msg)
+	}
+	if msg.prepared != nil {
+		return ws.writePrepared(connection, msg)
+	}
+	if msg.progress != nil {
+		return ws.writeWithProgress(connection, msg)
+	}
+
+	_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
+	return connection.WriteMessage(msg.messageType, msg.data)
+}
+
+// dropMessage reports an outbound message that was discarded instead of being sent
+func (ws *Websocket) dropMessage(msg []byte, reason error) {
+	ws.configuration.Logger.Debug("Dropping outbound message:", reason)
+	ws.messageDroppedHandlerLock.Lock()
+	ws.messageDroppedHandler(msg, reason)
+	ws.messageDroppedHandlerLock.Unlock()
+}
+
+// startSender starts the sender goroutine, along with the pinger if a ping interval is set, the pruner if subscription
+// pruning is enabled, the suspend watcher if suspend detection is enabled, and the heartbeater if application-level
+// heartbeats are configured. Without a ping interval, the pinger's timer would fire continuously and flood pings
 func (ws *Websocket) startSender() {
-	ws.configuration.Logger.Trace("Starting sender goroutine...")
+	ws.configuration.Logger.Trace("Starting sender goroutines...")
 	ws.senderStopChannel = make(chan struct{})
-	go ws.sender()
-	ws.configuration.Logger.Trace("Successfully started sender goroutine...")
+	go ws.sender(ws.senderStopChannel)
+	if ws.configuration.PingInterval > 0 {
+		go ws.pinger(ws.senderStopChannel)
+	}
+	if ws.configuration.Unsubscriber != nil {
+		go ws.pruner(ws.senderStopChannel)
+	}
+	if ws.configuration.SuspendThreshold > 0 {
+		go ws.suspendWatcher(ws.senderStopChannel)
+	}
+	if ws.configuration.heartbeatEnabled() {
+		go ws.heartbeater(ws.senderStopChannel)
+	}
+	ws.configuration.Logger.Trace("Successfully started sender goroutines...")
 }
 
-// stopSender stops the sender goroutine
+// stopSender stops the sender, pinger, pruner, suspend watcher, and heartbeater goroutines
 func (ws *Websocket) stopSender() {
-	ws.configuration.Logger.Trace("Stopping sender goroutine...")
+	ws.configuration.Logger.Trace("Stopping sender goroutines...")
 	close(ws.senderStopChannel)
-	ws.configuration.Logger.Trace("Successfully stopped sender goroutine")
+	ws.configuration.Logger.Trace("Successfully stopped sender goroutines")
 }
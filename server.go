@@ -0,0 +1,42 @@
+package gows
+
+import (
+	"net/http"
+)
+
+// Upgrade upgrades an HTTP request into a server-side websocket that shares the client's send queue, ping loop, and
+// handlers. The returned websocket is not started yet, so handlers can be attached before calling Connect(), which
+// starts processing messages on the upgraded connection. Server-side websockets can't reconnect, so the websocket is
+// stopped for good when the connection drops
+func Upgrade(w http.ResponseWriter, r *http.Request, configuration *Configuration) (*Websocket, error) {
+	connection, err := configuration.getUpgrader().Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := New(configuration)
+	ws.upgradedConnection = connection
+	return ws, nil
+}
+
+// server is a goroutine responsible for running an upgraded connection until it drops or the websocket is stopped. It
+// is the server-side counterpart of the reviver
+func (ws *Websocket) server(stopChannel chan struct{}, doneChannel chan struct{}) {
+	defer close(doneChannel)
+
+	ws.setConnection(ws.upgradedConnection)
+	ws.upgradedConnection = nil
+	ws.setState(Connected)
+	ws.connectionEstablished(false, 1, 0)
+
+	var reason error
+	select {
+	case <-stopChannel:
+	case reason = <-ws.connectionDroppedChannel:
+		ws.configuration.Logger.Info("Server-side websocket connection lost:", reason)
+		ws.setState(Closing)
+	}
+
+	ws.clearConnection(reason)
+	ws.setState(Closed)
+}
@@ -0,0 +1,237 @@
+package gows
+
+import (
+	"fmt"
+	"sync"
+)
+
+// defaultSessionBufferSize is the number of sequence numbers kept in each direction when none is configured
+const defaultSessionBufferSize = 1024
+
+// SessionResume defines a resumable session. The last received and sent sequence numbers are tracked, and after a
+// reconnect, a resume token built from the last received sequence is sent ahead of everything else. If the server
+// resumes the session, it replays the messages that were missed, and the client replays buffered messages the server
+// didn't get. Replayed inbound messages that were already received are dropped. If the server resets the session
+// instead, the buffers start over
+type SessionResume struct {
+	Token            func(lastReceived int64) ([]byte, error)                      // Builds the resume token sent after a reconnect
+	Reply            func(msg []byte) (matched bool, resumed bool, lastSent int64) // Recognizes the server's reply, including the last sequence it received from us
+	InboundSequence  func(msg []byte) (int64, bool)                                // Extracts the sequence number from an inbound message
+	OutboundSequence func(msg []byte) (int64, bool)                                // Extracts the sequence number from an outbound message
+	BufferSize       int                                                           // The number of sequence numbers kept in each direction, defaults to 1024
+	MessageType      int                                                           // The frame type of the resume token, defaults to the default message type
+}
+
+// getSessionBufferSize gets the number of sequence numbers kept by a resumable session, zero for the default
+func (c *Configuration) getSessionBufferSize() int {
+	if c.Session == nil {
+		return 0
+	}
+
+	return c.Session.BufferSize
+}
+
+// sessionState defines the thread-safe state of a resumable session
+type sessionState struct {
+	lock         *sync.Mutex
+	size         int
+	lastReceived int64              // The highest sequence number received
+	received     []int64            // The most recently received sequence numbers, oldest first
+	seen         map[int64]bool     // Set of the sequence numbers in the received buffer
+	sent         []*message         // The most recently sent messages with a sequence number, oldest first
+	sentSequence map[*message]int64 // The sequence numbers of the sent messages
+	awaiting     bool               // Whether a resume reply is expected
+}
+
+// newSessionState constructs a new, empty session state that keeps the supplied number of sequence numbers
+func newSessionState(size int) *sessionState {
+	if size <= 0 {
+		size = defaultSessionBufferSize
+	}
+
+	s := &sessionState{lock: &sync.Mutex{}, size: size}
+	s.reset()
+	return s
+}
+
+// reset starts the session over. Must be called with the lock held, or before the state is shared
+func (s *sessionState) reset() {
+	s.lastReceived = 0
+	s.received = make([]int64, 0, s.size)
+	s.seen = make(map[int64]bool, s.size)
+	s.sent = make([]*message, 0, s.size)
+	s.sentSequence = make(map[*message]int64, s.size)
+}
+
+// receive records an inbound sequence number, returning false if it was already received
+func (s *sessionState) receive(sequence int64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.seen[sequence] {
+		return false
+	}
+
+	if len(s.received) == s.size {
+		delete(s.seen, s.received[0])
+		s.received = s.received[1:]
+	}
+	s.received = append(s.received, sequence)
+	s.seen[sequence] = true
+
+	if sequence > s.lastReceived {
+		s.lastReceived = sequence
+	}
+	return true
+}
+
+// send records an outbound message that was written, along with its sequence number
+func (s *sessionState) send(msg *message, sequence int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.sentSequence[msg]; ok {
+		return
+	}
+
+	if len(s.sent) == s.size {
+		delete(s.sentSequence, s.sent[0])
+		s.sent = s.sent[1:]
+	}
+	s.sent = append(s.sent, msg)
+	s.sentSequence[msg] = sequence
+}
+
+// resuming starts waiting for a resume reply, returning the last received sequence number for the token
+func (s *sessionState) resuming() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.awaiting = true
+	return s.lastReceived
+}
+
+// check matches an inbound message against the resume reply matcher. If it was the reply, returns true along with
+// whether the session was resumed and the buffered messages the server didn't receive. A reset session starts over
+func (s *sessionState) check(reply func([]byte) (bool, bool, int64), msg []byte) (bool, bool, []*message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.awaiting {
+		return false, false, nil
+	}
+
+	matched, resumed, lastSent := reply(msg)
+	if !matched {
+		return false, false, nil
+	}
+	s.awaiting = false
+
+	if !resumed {
+		s.reset()
+		return true, false, nil
+	}
+
+	missed := make([]*message, 0)
+	for _, sent := range s.sent {
+		if s.sentSequence[sent] > lastSent {
+			missed = append(missed, sent)
+		}
+	}
+	return true, true, missed
+}
+
+// OnSessionResumed sets the onSessionResumed handler, called with the number of messages replayed to the server when
+// it resumes the session after a reconnect
+func (ws *Websocket) OnSessionResumed(handler func(replayed int)) {
+	ws.sessionResumedHandlerLock.Lock()
+	ws.sessionResumedHandler = handler
+	ws.sessionResumedHandlerLock.Unlock()
+}
+
+// OnSessionReset sets the onSessionReset handler, called when the server can't resume the session after a reconnect,
+// meaning messages may have been lost in between
+func (ws *Websocket) OnSessionReset(handler func()) {
+	ws.sessionResetHandlerLock.Lock()
+	ws.sessionResetHandler = handler
+	ws.sessionResetHandlerLock.Unlock()
+}
+
+// resumeSession puts the resume token at the front of the send queue. Does nothing if sessions aren't resumable
+func (ws *Websocket) resumeSession() {
+	resume := ws.configuration.Session
+	if resume == nil {
+		return
+	}
+
+	lastReceived := ws.session.resuming()
+	data, err := resume.Token(lastReceived)
+	if err != nil {
+		ws.reportError(fmt.Errorf("failed to build session resume token: %w", err))
+		return
+	}
+
+	messageType := resume.MessageType
+	if messageType == 0 {
+		messageType = ws.configuration.getDefaultMessageType()
+	}
+
+	msg, ok := ws.auditMessage(newMessage(messageType, data))
+	if !ok {
+		return
+	}
+
+	ws.configuration.Logger.Debug("Resuming session from sequence", lastReceived)
+	ws.sendQueue.requeue(msg)
+}
+
+// checkSession matches an inbound message against the resume reply, and drops replayed messages that were already
+// received. Returns true if the message was consumed
+func (ws *Websocket) checkSession(msg []byte) bool {
+	resume := ws.configuration.Session
+	if resume == nil {
+		return false
+	}
+
+	matched, resumed, missed := ws.session.check(resume.Reply, msg)
+	if matched && resumed {
+		replayed := ws.sendQueue.requeueMissing(missed)
+		ws.configuration.Logger.Debug("Session resumed, replaying", replayed, "messages")
+		ws.sessionResumedHandlerLock.Lock()
+		ws.sessionResumedHandler(replayed)
+		ws.sessionResumedHandlerLock.Unlock()
+		return true
+	}
+
+	if matched {
+		ws.configuration.Logger.Debug("Session was reset")
+		ws.sessionResetHandlerLock.Lock()
+		ws.sessionResetHandler()
+		ws.sessionResetHandlerLock.Unlock()
+		return true
+	}
+
+	if resume.InboundSequence == nil {
+		return false
+	}
+
+	sequence, ok := resume.InboundSequence(msg)
+	if ok && !ws.session.receive(sequence) {
+		ws.configuration.Logger.Trace("DISPATCHER: Dropped message that was already received in this session")
+		return true
+	}
+	return false
+}
+
+// sentInSession records a written message in the session's replay buffer, if it has a sequence number
+func (ws *Websocket) sentInSession(msg *message) {
+	resume := ws.configuration.Session
+	if resume == nil || resume.OutboundSequence == nil || msg.stream != nil {
+		return
+	}
+
+	sequence, ok := resume.OutboundSequence(msg.data)
+	if ok {
+		ws.session.send(msg, sequence)
+	}
+}
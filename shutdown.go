@@ -0,0 +1,72 @@
+package gows
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval is how often Shutdown checks if the send queue has been drained
+const drainPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully shuts the websocket down. New messages are refused with ErrShuttingDown, the sender is given
+// until the context expires to flush everything already queued, and then the websocket is disconnected with a close
+// handshake. Returns the context's error if the queue couldn't be drained in time, in which case the remaining messages
+// stay queued and are sent if the websocket is connected again. Sending must not be blocked, or the queue can't drain
+func (ws *Websocket) Shutdown(ctx context.Context) error {
+	ws.setShuttingDown(true)
+	ws.lifecycleLock.Lock()
+	doneChannel := ws.doneChannel
+	ws.lifecycleLock.Unlock()
+
+	// Wait for the queue to drain
+	err := ws.drain(ctx)
+	if err != nil {
+		ws.configuration.Logger.Warn("Shutting down websocket with", ws.sendQueue.pending(), "messages unsent:", err)
+	}
+
+	// Disconnect, and wait for the close handshake to finish
+	ws.Disconnect()
+	if doneChannel != nil {
+		select {
+		case <-doneChannel:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+		}
+	}
+
+	return err
+}
+
+// drain waits until every queued message has been sent, including those waiting out a retry backoff, or the context
+// expires
+func (ws *Websocket) drain(ctx context.Context) error {
+	drainTicker := time.NewTicker(drainPollInterval)
+	defer drainTicker.Stop()
+
+	for ws.sendQueue.pending()+ws.retries.pending() > 0 {
+		select {
+		case <-drainTicker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// isShuttingDown determines if the websocket is refusing new messages because it's shutting down
+func (ws *Websocket) isShuttingDown() bool {
+	ws.shuttingDownLock.Lock()
+	defer ws.shuttingDownLock.Unlock()
+
+	return ws.shuttingDown
+}
+
+// setShuttingDown sets whether the websocket is refusing new messages because it's shutting down
+func (ws *Websocket) setShuttingDown(shuttingDown bool) {
+	ws.shuttingDownLock.Lock()
+	ws.shuttingDown = shuttingDown
+	ws.shuttingDownLock.Unlock()
+}
@@ -0,0 +1,68 @@
+package gows
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownSignals are the signals that trigger a shutdown when none are supplied. On Windows, Go delivers console
+// close, logoff, and shutdown events as SIGTERM
+var defaultShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// defaultDrainTimeout is how long the send queue gets to drain after a signal when no drain timeout is supplied. The
+// queue can't drain while the websocket is disconnected, so the wait is always bounded
+const defaultDrainTimeout = 10 * time.Second
+
+// ShutdownOnSignal gracefully shuts the websocket down when one of the supplied signals is received, giving the send
+// queue up to the drain timeout (10 seconds if it isn't positive) to empty before disconnecting. SIGINT and SIGTERM are
+// used when no signals are supplied, which covers orchestrated shutdowns of containers. Signals are only caught once,
+// so a second signal during the drain gets its default behavior and kills the process. The returned channel receives
+// the result of Shutdown() once a signal was handled, and the returned function stops listening for signals without
+// shutting down
+func (ws *Websocket) ShutdownOnSignal(drainTimeout time.Duration, signals ...os.Signal) (<-chan error, func()) {
+	if len(signals) == 0 {
+		signals = defaultShutdownSignals
+	}
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, signals...)
+
+	stopChannel := make(chan struct{})
+	resultChannel := make(chan error, 1)
+	go func() {
+		select {
+		case <-stopChannel:
+			signal.Stop(signalChannel)
+			return
+		case received := <-signalChannel:
+			signal.Stop(signalChannel)
+			ws.configuration.Logger.Info("Received", received, "signal, shutting down websocket")
+		}
+
+		if drainTimeout <= 0 {
+			drainTimeout = defaultDrainTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+
+		resultChannel <- ws.Shutdown(ctx)
+	}()
+
+	stopOnce := &sync.Once{}
+	return resultChannel, func() {
+		stopOnce.Do(func() {
+			close(stopChannel)
+		})
+	}
+}
+
+// RunUntilSignal blocks until one of the supplied signals is received, then gracefully shuts the websocket down with
+// the drain timeout and returns the result. It's meant to be the last call in a service's main function
+func (ws *Websocket) RunUntilSignal(drainTimeout time.Duration, signals ...os.Signal) error {
+	result, _ := ws.ShutdownOnSignal(drainTimeout, signals...)
+	return <-result
+}
@@ -0,0 +1,57 @@
+package gows
+
+import "sync"
+
+// sizeBounds are the upper bounds of the inbound message size buckets, in bytes. Messages bigger than the last bound
+// are counted in a final bucket with no limit
+var sizeBounds = []int{64, 256, 1024, 4 * 1024, 16 * 1024, 64 * 1024, 256 * 1024, 1024 * 1024}
+
+// SizeBucket defines a bucket of the inbound message size histogram
+type SizeBucket struct {
+	Max      int    // The largest message size counted in the bucket in bytes, zero for the unbounded last bucket
+	Messages uint64 // The number of messages received with a size in the bucket
+	Bytes    uint64 // The number of payload bytes received in messages in the bucket
+}
+
+// sizeHistogram defines a thread-safe histogram of inbound message sizes
+type sizeHistogram struct {
+	lock    *sync.Mutex
+	buckets []SizeBucket
+}
+
+// newSizeHistogram constructs a new, empty size histogram
+func newSizeHistogram() *sizeHistogram {
+	buckets := make([]SizeBucket, len(sizeBounds)+1)
+	for i, bound := range sizeBounds {
+		buckets[i].Max = bound
+	}
+
+	return &sizeHistogram{
+		lock:    &sync.Mutex{},
+		buckets: buckets,
+	}
+}
+
+// record records a message of the supplied size
+func (h *sizeHistogram) record(size int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	i := 0
+	for i < len(sizeBounds) && size > sizeBounds[i] {
+		i++
+	}
+
+	h.buckets[i].Messages++
+	h.buckets[i].Bytes += uint64(size)
+}
+
+// snapshot gets a copy of every bucket, smallest first
+func (h *sizeHistogram) snapshot() []SizeBucket {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	snapshot := make([]SizeBucket, len(h.buckets))
+	copy(snapshot, h.buckets)
+	return snapshot
+}
@@ -0,0 +1,48 @@
+package gows
+
+import (
+	"context"
+	"time"
+)
+
+// SendFrom pumps messages from the supplied channel into the send queue until the channel is closed or the context is
+// cancelled. When the queue holds more than the configured backpressure threshold, it stops reading from the channel
+// until the sender catches up, pushing the backpressure onto the producer. Returns nil when the channel is closed
+func (ws *Websocket) SendFrom(ctx context.Context, source <-chan []byte) error {
+	for {
+
+		// Wait for the queue to drain below the threshold before taking anything else off the channel
+		err := ws.waitForQueueCapacity(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case msg, ok := <-source:
+			if !ok {
+				return nil
+			}
+			ws.Send(msg)
+		}
+	}
+}
+
+// waitForQueueCapacity blocks while the send queue is over the backpressure threshold
+func (ws *Websocket) waitForQueueCapacity(ctx context.Context) error {
+	if ws.configuration.BackpressureThreshold <= 0 {
+		return nil
+	}
+
+	for ws.sendQueue.length() > ws.configuration.BackpressureThreshold {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package gows
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// spillHeaderSize is the size of a spill record header: the payload length, the frame type, and the receive time
+const spillHeaderSize = 4 + 1 + 8
+
+// spillChecksumSize is the size of the checksum that follows every spill record
+const spillChecksumSize = 4
+
+// errSpillCorrupted is the reason reported when a spill file can't be read back
+var errSpillCorrupted = errors.New("inbound spill file is corrupted")
+
+// SpillStats defines a snapshot of the inbound spill statistics
+type SpillStats struct {
+	Spilled   uint64 // The number of inbound messages written to disk because the dispatcher was behind
+	Pending   int    // The number of spilled messages waiting to be replayed
+	Corrupted uint64 // The number of spilled messages lost because the spill file couldn't be read back
+}
+
+// spillStats defines the thread-safe inbound spill statistics, shared by every spill queue of a websocket
+type spillStats struct {
+	lock  *sync.Mutex
+	stats SpillStats
+}
+
+// newSpillStats constructs new, empty spill statistics
+func newSpillStats() *spillStats {
+	return &spillStats{lock: &sync.Mutex{}}
+}
+
+// update applies a change to the statistics
+func (s *spillStats) update(change func(*SpillStats)) {
+	s.lock.Lock()
+	change(&s.stats)
+	s.lock.Unlock()
+}
+
+// snapshot gets a copy of the statistics
+func (s *spillStats) snapshot() SpillStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stats
+}
+
+// spillQueue defines an unbounded, thread-safe inbound queue that keeps up to the threshold of messages in memory and
+// spills the rest to a file, replaying them in order. Once anything was spilled, new messages go to the file as well
+// until it's drained, so they can't overtake the spilled ones. Every record carries a CRC32 checksum, and a record that
+// fails it discards the rest of the file rather than dispatching garbage
+type spillQueue struct {
+	lock      *sync.Mutex
+	dir       string
+	threshold int
+	memory    []*message
+	overflow  []*message // Messages that couldn't be spilled, kept in memory behind the spill file
+	file      *os.File   // The spill file, nil while nothing is spilled
+	written   int64      // The offset the next record is written at
+	read      int64      // The offset the next record is read from
+	pending   int        // The number of records in the file that weren't read yet
+	closed    bool       // Whether the producer is done, so the queue ends once it's drained
+	signal    chan struct{}
+	stats     *spillStats
+	cipher    *spoolCipher // Encrypts spilled payloads, nil to spill them as they are
+}
+
+// newSpillQueue constructs a new spill queue that spills to files in the supplied directory, encrypting the payloads
+// with the cipher if there is one
+func newSpillQueue(dir string, threshold int, stats *spillStats, cipher *spoolCipher) *spillQueue {
+	return &spillQueue{
+		lock:      &sync.Mutex{},
+		dir:       dir,
+		threshold: threshold,
+		memory:    make([]*message, 0, threshold),
+		signal:    make(chan struct{}, 1),
+		stats:     stats,
+		cipher:    cipher,
+	}
+}
+
+// push adds a message to the queue, spilling it to disk if the memory buffer is full or messages are already spilled.
+// If spilling fails, the message is kept in memory behind the spilled ones instead of being dropped, and the failure
+// is returned
+func (q *spillQueue) push(msg *message) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.notify()
+
+	if len(q.overflow) > 0 {
+		q.overflow = append(q.overflow, msg)
+		return nil
+	}
+
+	if q.file == nil && len(q.memory) < q.threshold {
+		q.memory = append(q.memory, msg)
+		return nil
+	}
+
+	if q.file == nil {
+		file, err := os.CreateTemp(q.dir, "gows-spill-*")
+		if err != nil {
+			q.overflow = append(q.overflow, msg)
+			return fmt.Errorf("failed to create inbound spill file: %w", err)
+		}
+		q.file = file
+	}
+
+	record, err := encodeSpillRecord(msg, q.cipher)
+	if err != nil {
+		q.overflow = append(q.overflow, msg)
+		return fmt.Errorf("failed to spill inbound message: %w", err)
+	}
+
+	_, err = q.file.WriteAt(record, q.written)
+	if err != nil {
+		q.overflow = append(q.overflow, msg)
+		return fmt.Errorf("failed to spill inbound message: %w", err)
+	}
+
+	q.written += int64(len(record))
+	q.pending++
+	q.stats.update(func(stats *SpillStats) {
+		stats.Spilled++
+		stats.Pending++
+	})
+	return nil
+}
+
+// pop removes the oldest message from the queue, waiting for one if it's empty. Returns false once the queue was closed
+// and drained
+func (q *spillQueue) pop() (*message, bool, error) {
+	for {
+		q.lock.Lock()
+
+		if len(q.memory) > 0 {
+			msg := q.memory[0]
+			q.memory[0] = nil
+			q.memory = q.memory[1:]
+			q.lock.Unlock()
+			return msg, true, nil
+		}
+
+		if q.pending > 0 {
+			msg, err := q.readRecord()
+			q.lock.Unlock()
+			if err != nil {
+				return nil, true, err
+			}
+			return msg, true, nil
+		}
+
+		// The spill file is drained, so the messages that couldn't be spilled are next
+		if len(q.overflow) > 0 {
+			q.memory = append(q.memory, q.overflow...)
+			q.overflow = nil
+			q.lock.Unlock()
+			continue
+		}
+
+		if q.closed {
+			q.lock.Unlock()
+			return nil, false, nil
+		}
+
+		q.lock.Unlock()
+		<-q.signal
+	}
+}
+
+// close marks the producer as done. The queue ends once everything in it was popped
+func (q *spillQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.notify()
+	q.lock.Unlock()
+}
+
+// notify wakes up a waiting pop
+func (q *spillQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// readRecord reads the next record from the spill file, removing the file once it's drained. A corrupted record
+// discards everything left in the file. Must be called with the lock held
+func (q *spillQueue) readRecord() (*message, error) {
+	header := make([]byte, spillHeaderSize)
+	_, err := q.file.ReadAt(header, q.read)
+	if err != nil {
+		return nil, q.discard(err)
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	if q.read+spillHeaderSize+size+spillChecksumSize > q.written {
+		return nil, q.discard(io.ErrUnexpectedEOF)
+	}
+
+	record := make([]byte, spillHeaderSize+size+spillChecksumSize)
+	_, err = q.file.ReadAt(record, q.read)
+	if err != nil {
+		return nil, q.discard(err)
+	}
+
+	msg, err := decodeSpillRecord(record, q.cipher)
+	if err != nil {
+		return nil, q.discard(fmt.Errorf("%w at offset %d", err, q.read))
+	}
+
+	q.read += int64(len(record))
+	q.pending--
+	q.stats.update(func(stats *SpillStats) {
+		stats.Pending--
+	})
+
+	if q.pending == 0 {
+		q.remove()
+	}
+	return msg, nil
+}
+
+// discard drops everything left in the spill file after it failed to read, returning the reason. Must be called with
+// the lock held
+func (q *spillQueue) discard(reason error) error {
+	lost := q.pending
+	q.pending = 0
+	q.stats.update(func(stats *SpillStats) {
+		stats.Pending -= lost
+		stats.Corrupted += uint64(lost)
+	})
+	q.remove()
+	return fmt.Errorf("%w, discarded %d messages: %v", errSpillCorrupted, lost, reason)
+}
+
+// remove closes and deletes the spill file, so new messages are buffered in memory again. Must be called with the lock
+// held
+func (q *spillQueue) remove() {
+	if q.file == nil {
+		return
+	}
+
+	_ = q.file.Close()
+	_ = os.Remove(q.file.Name())
+	q.file = nil
+	q.written = 0
+	q.read = 0
+}
+
+// encodeSpillRecord encodes a message as a spill record: a header with the payload length, the frame type, and the
+// receive time, followed by the payload and a CRC32 checksum of everything before it. With a cipher, the payload is
+// encrypted, authenticating the frame type and receive time along with it
+func encodeSpillRecord(msg *message, cipher *spoolCipher) ([]byte, error) {
+	header := make([]byte, spillHeaderSize)
+	header[4] = byte(msg.messageType)
+	binary.BigEndian.PutUint64(header[5:13], uint64(msg.receivedAt.UnixNano()))
+
+	payload, err := cipher.seal(msg.data, header[4:])
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+
+	record := make([]byte, 0, spillHeaderSize+len(payload)+spillChecksumSize)
+	record = append(record, header...)
+	record = append(record, payload...)
+	record = append(record, make([]byte, spillChecksumSize)...)
+
+	checksum := len(record) - spillChecksumSize
+	binary.BigEndian.PutUint32(record[checksum:], crc32.ChecksumIEEE(record[:checksum]))
+	return record, nil
+}
+
+// decodeSpillRecord decodes a spill record, failing if its checksum doesn't match or its payload can't be decrypted
+func decodeSpillRecord(record []byte, cipher *spoolCipher) (*message, error) {
+	checksum := len(record) - spillChecksumSize
+	if crc32.ChecksumIEEE(record[:checksum]) != binary.BigEndian.Uint32(record[checksum:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	payload, err := cipher.open(record[spillHeaderSize:checksum], record[4:spillHeaderSize])
+	if err != nil {
+		return nil, err
+	}
+
+	msg := newMessage(int(record[4]), payload)
+	msg.receivedAt = time.Unix(0, int64(binary.BigEndian.Uint64(record[5:13])))
+	return msg, nil
+}
+
+// spiller defines the goroutine that feeds spilled messages to the dispatcher in order. Once the consumer closes the
+// spill queue, it feeds whatever is left, then closes the dispatcher's channel
+func (ws *Websocket) spiller(queue *spillQueue, dispatch chan<- *message) {
+	defer close(dispatch)
+
+	for {
+		msg, ok, err := queue.pop()
+		if !ok {
+			ws.configuration.Logger.Trace("SPILLER: Shutting down")
+			return
+		}
+		if err != nil {
+			ws.reportError(err)
+			continue
+		}
+		dispatch <- msg
+	}
+}
+
+// newInboundSpill constructs the spill queue for a connection. If the encryption key is invalid, the error is reported
+// and nothing is spilled, rather than writing messages to disk in plaintext
+func (ws *Websocket) newInboundSpill() *spillQueue {
+	cipher, err := newSpoolCipher(ws.configuration.SpoolEncryptionKey)
+	if err != nil {
+		ws.reportError(err)
+		return nil
+	}
+
+	return newSpillQueue(ws.configuration.InboundSpillDir, ws.configuration.getInboundSpillThreshold(), ws.spillStats, cipher)
+}
+
+// getInboundSpillThreshold gets the number of inbound messages kept in memory before spilling to disk
+func (c *Configuration) getInboundSpillThreshold() int {
+	if c.InboundSpillThreshold > 0 {
+		return c.InboundSpillThreshold
+	}
+
+	return c.getInboundBufferSize()
+}
@@ -0,0 +1,147 @@
+package gows
+
+import "context"
+
+// closedChannel is a channel that's always closed
+var closedChannel = func() chan struct{} {
+	channel := make(chan struct{})
+	close(channel)
+	return channel
+}()
+
+// State defines the lifecycle state of the websocket
+type State int
+
+const (
+	// Disconnected means the websocket has not been connected yet, or the initial connection failed
+	Disconnected State = iota
+
+	// Connecting means the initial connection is being established
+	Connecting
+
+	// Connected means the websocket has a live connection
+	Connected
+
+	// Reconnecting means the connection dropped and the reviver is trying to establish a new one
+	Reconnecting
+
+	// Closing means the websocket is being shut down
+	Closing
+
+	// Closed means the websocket is stopped and will not reconnect until Connect() is called again
+	Closed
+)
+
+// String gets the name of the state
+func (s State) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Connecting:
+		return "Connecting"
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	case Closing:
+		return "Closing"
+	case Closed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
+
+// State gets the current lifecycle state of the websocket
+func (ws *Websocket) State() State {
+	ws.stateLock.Lock()
+	defer ws.stateLock.Unlock()
+
+	return ws.state
+}
+
+// OnStateChange sets the onStateChange handler, called with the old and new state on every state transition
+func (ws *Websocket) OnStateChange(handler func(old State, new State)) {
+	ws.stateChangeHandlerLock.Lock()
+	ws.stateChangeHandler = handler
+	ws.stateChangeHandlerLock.Unlock()
+}
+
+// setState transitions the websocket to a new state, notifying the state change handler if the state changed
+func (ws *Websocket) setState(state State) {
+	ws.stateLock.Lock()
+	old := ws.state
+	ws.state = state
+	if state == Connected && old != Connected {
+		close(ws.connected)
+	} else if old == Connected && state != Connected {
+		ws.connected = make(chan struct{})
+	}
+	ws.stateLock.Unlock()
+
+	if old == state {
+		return
+	}
+
+	// Keep track of time spent connected. Connecting starts the clock, and closing stops it
+	now := ws.now()
+	switch state {
+	case Connected:
+		ws.availability.mark(true, now)
+	case Connecting, Reconnecting:
+		ws.availability.mark(false, now)
+	case Closed, Disconnected:
+		ws.availability.stop(now)
+	}
+
+	ws.configuration.Logger.Debug("Websocket state changed from", old, "to", state)
+	ws.stateChangeHandlerLock.Lock()
+	ws.stateChangeHandler(old, state)
+	ws.stateChangeHandlerLock.Unlock()
+}
+
+// connectedSignal gets a channel that's closed while the websocket is connected
+func (ws *Websocket) connectedSignal() <-chan struct{} {
+	ws.stateLock.Lock()
+	defer ws.stateLock.Unlock()
+
+	return ws.connected
+}
+
+// WaitForConnected blocks until the websocket is connected, returning right away if it already is. Returns the
+// context's error if it expires first, or ErrDisconnected if the websocket was running and stops for good while
+// waiting, e.g. because it was disconnected or gave up reconnecting. If the websocket isn't running, it waits for it
+// to be connected with Connect()
+func (ws *Websocket) WaitForConnected(ctx context.Context) error {
+	ws.lifecycleLock.Lock()
+	var done chan struct{}
+	if ws.doneChannel != nil && !isClosed(ws.doneChannel) {
+		done = ws.doneChannel
+	}
+	ws.lifecycleLock.Unlock()
+
+	select {
+	case <-ws.connectedSignal():
+		return nil
+	case <-done:
+		if ws.IsConnected() {
+			return nil
+		}
+		return ErrDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done gets a channel that's closed once the websocket stops for good, after Disconnect() or Shutdown(), or once it
+// gives up reconnecting. If the websocket isn't running, the channel is already closed. Connecting it again starts a
+// new run with a new channel, so Done() should be called after Connect()
+func (ws *Websocket) Done() <-chan struct{} {
+	ws.lifecycleLock.Lock()
+	defer ws.lifecycleLock.Unlock()
+
+	if ws.doneChannel == nil {
+		return closedChannel
+	}
+	return ws.doneChannel
+}
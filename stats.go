@@ -0,0 +1,164 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats defines a snapshot of the websocket's statistics
+type Stats struct {
+
+	// Connection
+	Reconnects       uint64        // The number of times the websocket reconnected after a dropped connection
+	LastConnected    time.Time     // When the most recent connection was established, zero if it never connected
+	LastDisconnected time.Time     // When the most recent connection was closed, zero if it never disconnected
+	Uptime           time.Duration // How long the current connection has been up, zero while disconnected
+	LastError        error         // The most recent error reported to the error handler, nil if there wasn't one
+	LastErrorTime    time.Time     // When the most recent error was reported
+
+	// Traffic
+	MessagesSent     uint64 // The number of messages written to the connection
+	BytesSent        uint64 // The number of payload bytes written to the connection
+	MessagesReceived uint64 // The number of messages read from the connection
+	BytesReceived    uint64 // The number of payload bytes read from the connection
+	QueueLength      int    // The number of messages waiting in the send queue
+	Batching         bool   // Whether adaptive batching is currently batching writes
+
+	// Keepalives
+	PingInterval time.Duration // The current ping interval, which adapts to missed pongs when PingIntervalMin is set
+	MissedPongs  uint64        // The number of pings that were never answered
+
+	// Availability
+	ConnectedTime      time.Duration // Total time spent connected since the websocket was started
+	DisconnectedTime   time.Duration // Total time spent disconnected since the websocket was started
+	Availability       float64       // Fraction of time spent connected since the websocket was started
+	WindowAvailability float64       // Fraction of time spent connected over the configured availability window
+
+	// Throughput
+	Throughput Throughput // 1, 5, and 15 minute moving averages of the message and byte rates in both directions
+
+	// Inbound messages
+	InboundExpired uint64       // The number of inbound messages dropped because they were older than the inbound TTL
+	InboundSampled uint64       // The number of inbound messages skipped by sampling
+	InboundSpill   SpillStats   // Inbound messages spilled to disk, when an inbound spill directory is configured
+	InboundSizes   []SizeBucket // The distribution of inbound message sizes, smallest bucket first
+
+	// Topics and categories
+	Topics     map[string]TopicStats   // Traffic received on every tracked topic, when a topic extractor is configured
+	TopTalkers []TopicVolume           // The busiest topics right now, when a topic extractor is configured
+	Traffic    map[string]TrafficStats // Traffic in both directions per category, when a traffic classifier is configured
+
+	// Profiling
+	Profile  Profile                   // Send and dispatch times, and allocations per message, when self-profiling
+	Handlers map[string]HandlerMetrics // Invocations, panics, and latencies per handler, when handler metrics are enabled
+}
+
+// Stats gets a snapshot of the websocket's statistics
+func (ws *Websocket) Stats() Stats {
+	now := ws.now()
+	stats := Stats{}
+	ws.connectionStats.snapshot(&stats, now)
+	ws.throughput.totals(&stats)
+	stats.QueueLength = ws.sendQueue.length()
+	stats.Batching = ws.batching.reached()
+	stats.PingInterval, stats.MissedPongs = ws.pingState.snapshot()
+	ws.availability.snapshot(&stats, now)
+	stats.Throughput = ws.throughput.snapshot(now)
+	stats.InboundExpired = ws.inboundExpired.get()
+	stats.InboundSampled = ws.inboundSampled.get()
+	stats.InboundSpill = ws.spillStats.snapshot()
+	stats.InboundSizes = ws.inboundSizes.snapshot()
+	stats.Topics = ws.topicStats.snapshot()
+	stats.TopTalkers = ws.TopTalkers()
+	stats.Traffic = ws.trafficStats.snapshot()
+	stats.Profile = ws.profiler.snapshot()
+	stats.Handlers = ws.handlerMetrics.snapshot()
+	return stats
+}
+
+// counter defines a thread-safe counter
+type counter struct {
+	lock  *sync.Mutex
+	value uint64
+}
+
+// newCounter constructs a new counter starting at zero
+func newCounter() *counter {
+	return &counter{lock: &sync.Mutex{}}
+}
+
+// increment adds one to the counter
+func (c *counter) increment() {
+	c.lock.Lock()
+	c.value++
+	c.lock.Unlock()
+}
+
+// get gets the current value of the counter
+func (c *counter) get() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.value
+}
+
+// connectionStats defines the thread-safe connection history of the websocket
+type connectionStats struct {
+	lock             *sync.Mutex
+	reconnects       uint64
+	connected        bool
+	lastConnected    time.Time
+	lastDisconnected time.Time
+	lastError        error
+	lastErrorTime    time.Time
+}
+
+// newConnectionStats constructs a new, empty connection history
+func newConnectionStats() *connectionStats {
+	return &connectionStats{lock: &sync.Mutex{}}
+}
+
+// established records a new connection
+func (c *connectionStats) established(reconnect bool, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if reconnect {
+		c.reconnects++
+	}
+	c.connected = true
+	c.lastConnected = now
+}
+
+// closed records a closed connection
+func (c *connectionStats) closed(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.connected = false
+	c.lastDisconnected = now
+}
+
+// failed records a reported error
+func (c *connectionStats) failed(err error, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lastError = err
+	c.lastErrorTime = now
+}
+
+// snapshot fills in the connection figures of a stats snapshot
+func (c *connectionStats) snapshot(stats *Stats, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats.Reconnects = c.reconnects
+	stats.LastConnected = c.lastConnected
+	stats.LastDisconnected = c.lastDisconnected
+	stats.LastError = c.lastError
+	stats.LastErrorTime = c.lastErrorTime
+	if c.connected {
+		stats.Uptime = now.Sub(c.lastConnected)
+	}
+}
@@ -0,0 +1,273 @@
+package gows
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultStreamBufferSize is the number of unread inbound bytes a stream reader buffers when no limit is configured
+const defaultStreamBufferSize = 4 * 1024 * 1024
+
+// ErrStreamReset is returned by reconnect-aware stream readers after the connection was re-established, signalling
+// that any partially read data was discarded and messages may have been lost in between
+var ErrStreamReset = errors.New("stream reset by reconnect")
+
+// streamReader defines the read side of a stream, exposing inbound messages as a continuous byte stream
+type streamReader struct {
+	ws        *Websocket
+	delimiter []byte
+
+	lock   *sync.Mutex
+	cond   *sync.Cond
+	buffer *bytes.Buffer
+	limit  int // The maximum number of unread bytes in the buffer
+	closed bool
+	detach func()
+
+	// Read deadline
+	deadline time.Time   // When reads time out, zero for never
+	timer    *time.Timer // Wakes up blocked readers at the deadline
+
+	// Reconnect awareness
+	resetOnReconnect bool   // Whether to discard buffered data and return ErrStreamReset after a reconnect
+	generation       uint64 // The connection generation the buffered data belongs to
+	reset            bool   // Whether a reset is pending delivery to the next Read
+}
+
+// streamWriter defines the write side of a stream, turning written bytes into outbound messages
+type streamWriter struct {
+	ws          *Websocket
+	delimiter   []byte
+	messageType int
+
+	lock   *sync.Mutex
+	buffer *bytes.Buffer
+	closed bool
+}
+
+// Stream returns a duplex byte stream view of the websocket. Without a configured stream delimiter, every Write becomes
+// one outbound message and inbound messages are concatenated on the read side. With a delimiter, writes are buffered
+// and split into one message per delimited segment, and the delimiter is appended after every inbound message, so
+// message boundaries survive the round trip. Closing the reader stops it observing inbound messages, and closing the
+// writer flushes any partial segment. Writes fail with the reason a message couldn't be queued, like SendErr()
+func (ws *Websocket) Stream() (io.ReadCloser, io.WriteCloser) {
+	return ws.newStream(ws.configuration.StreamDelimiter, ws.configuration.getDefaultMessageType(), false)
+}
+
+// newStream constructs the reader and writer for a stream with the supplied delimiter and outbound frame type,
+// optionally making the reader reconnect-aware
+func (ws *Websocket) newStream(delimiter []byte, messageType int, resetOnReconnect bool) (*streamReader, *streamWriter) {
+	readerLock := &sync.Mutex{}
+	reader := &streamReader{
+		ws:               ws,
+		delimiter:        delimiter,
+		lock:             readerLock,
+		cond:             sync.NewCond(readerLock),
+		buffer:           &bytes.Buffer{},
+		limit:            ws.configuration.getStreamBufferSize(),
+		resetOnReconnect: resetOnReconnect,
+		generation:       ws.getGeneration(),
+	}
+	reader.detach = ws.listeners.add(reader.append)
+
+	writer := &streamWriter{
+		ws:          ws,
+		delimiter:   delimiter,
+		messageType: messageType,
+		lock:        &sync.Mutex{},
+		buffer:      &bytes.Buffer{},
+	}
+
+	return reader, writer
+}
+
+// getStreamBufferSize gets the maximum number of unread inbound bytes a stream reader buffers
+func (c *Configuration) getStreamBufferSize() int {
+	if c.StreamBufferSize > 0 {
+		return c.StreamBufferSize
+	}
+
+	return defaultStreamBufferSize
+}
+
+// append adds an inbound message to the read buffer, waking up any blocked readers. Messages that would take the
+// buffer past its limit are dropped and reported to the error handler
+func (r *streamReader) append(msg []byte) {
+	if !r.buffered(msg) {
+		r.ws.reportError(fmt.Errorf("stream buffer is full, dropping %d byte inbound message", len(msg)))
+	}
+}
+
+// buffered adds an inbound message to the read buffer, returning false if there was no room for it
+func (r *streamReader) buffered(msg []byte) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return true
+	}
+
+	// If this message came in on a new connection, whatever is left in the buffer belongs to the old session
+	if r.resetOnReconnect {
+		generation := r.ws.getGeneration()
+		if generation != r.generation {
+			r.generation = generation
+			r.buffer.Reset()
+			r.reset = true
+		}
+	}
+
+	if r.buffer.Len()+len(msg)+len(r.delimiter) > r.limit {
+		return false
+	}
+
+	r.buffer.Write(msg)
+	r.buffer.Write(r.delimiter)
+	r.cond.Broadcast()
+	return true
+}
+
+// Read reads from the inbound byte stream, blocking until data is available or the read deadline passes
+func (r *streamReader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for r.buffer.Len() == 0 && !r.closed && !r.expired() {
+		r.cond.Wait()
+	}
+
+	if r.closed {
+		return 0, io.EOF
+	}
+
+	if r.reset {
+		r.reset = false
+		return 0, ErrStreamReset
+	}
+
+	if r.buffer.Len() == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return r.buffer.Read(p)
+}
+
+// setDeadline sets the read deadline, zero for none, waking up blocked readers so they pick it up
+func (r *streamReader) setDeadline(deadline time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.deadline = deadline
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if !deadline.IsZero() {
+		r.timer = time.AfterFunc(time.Until(deadline), r.wake)
+	}
+	r.cond.Broadcast()
+}
+
+// expired determines if the read deadline has passed. Must be called with the reader lock held
+func (r *streamReader) expired() bool {
+	return !r.deadline.IsZero() && !time.Now().Before(r.deadline)
+}
+
+// wake wakes up blocked readers, so they check the read deadline
+func (r *streamReader) wake() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cond.Broadcast()
+}
+
+// Close stops the reader from observing inbound messages and unblocks any pending reads
+func (r *streamReader) Close() error {
+
+	// Detach before taking the reader lock, since the listener registry holds its own lock while appending
+	r.detach()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	r.buffer.Reset()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.cond.Broadcast()
+	return nil
+}
+
+// Write writes to the outbound byte stream. If a segment can't be queued, the error is returned along with the number
+// of bytes of p consumed by the segments sent before it, and the rest of p is left unwritten
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	// Without a delimiter, every write is a message. Copy it, since the caller is free to reuse the slice
+	if len(w.delimiter) == 0 {
+		err := w.ws.send(w.messageType, append([]byte(nil), p...))
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	// Send every complete segment, leaving any trailing partial segment in the buffer
+	buffered := w.buffer.Len()
+	sent := 0
+	w.buffer.Write(p)
+	for {
+		index := bytes.Index(w.buffer.Bytes(), w.delimiter)
+		if index < 0 {
+			break
+		}
+
+		segment := append([]byte(nil), w.buffer.Bytes()[:index]...)
+		err := w.ws.send(w.messageType, segment)
+		if err != nil {
+
+			// Keep whatever was buffered before this write, handing the rest back to the caller as unwritten
+			if sent < buffered {
+				w.buffer.Truncate(buffered - sent)
+				return 0, err
+			}
+			w.buffer.Reset()
+			return sent - buffered, err
+		}
+
+		w.buffer.Next(index + len(w.delimiter))
+		sent += index + len(w.delimiter)
+	}
+
+	return len(p), nil
+}
+
+// Close flushes any partial segment and stops accepting writes, returning the error if the segment couldn't be queued
+func (w *streamWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+
+	segment := append([]byte(nil), w.buffer.Bytes()...)
+	w.buffer.Reset()
+	return w.ws.send(w.messageType, segment)
+}
@@ -0,0 +1,113 @@
+package gows
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Encoder defines a stream encoder, such as a *gob.Encoder or *json.Encoder
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder defines a stream decoder, such as a *gob.Decoder or *json.Decoder
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// EncoderDecoder defines a reconnect-aware encoder and decoder pair running over a stream view of the websocket.
+// Stateful stream formats like gob only send type information once per stream, so the encoder is rebuilt on the first
+// Encode after a reconnect and the decoder is rebuilt when the read side is reset. A Decode that spans a reconnect
+// returns ErrStreamReset, after which decoding continues with data from the new connection
+type EncoderDecoder struct {
+	ws     *Websocket
+	reader *streamReader
+	writer *streamWriter
+
+	newEncoder func(io.Writer) Encoder
+	newDecoder func(io.Reader) Decoder
+
+	encoder           Encoder
+	encoderGeneration uint64
+	encoderLock       *sync.Mutex
+
+	decoder     Decoder
+	decoderLock *sync.Mutex
+}
+
+// NewEncoderDecoder constructs an encoder and decoder pair over a new stream view of the websocket, using the supplied
+// constructors to build the encoder and decoder
+func NewEncoderDecoder(ws *Websocket, newEncoder func(io.Writer) Encoder, newDecoder func(io.Reader) Decoder) *EncoderDecoder {
+	reader, writer := ws.newStream(ws.configuration.StreamDelimiter, ws.configuration.getDefaultMessageType(), true)
+
+	return &EncoderDecoder{
+		ws:                ws,
+		reader:            reader,
+		writer:            writer,
+		newEncoder:        newEncoder,
+		newDecoder:        newDecoder,
+		encoder:           newEncoder(writer),
+		encoderGeneration: ws.getGeneration(),
+		encoderLock:       &sync.Mutex{},
+		decoder:           newDecoder(reader),
+		decoderLock:       &sync.Mutex{},
+	}
+}
+
+// NewGobEncoderDecoder constructs an encoder and decoder pair using encoding/gob
+func NewGobEncoderDecoder(ws *Websocket) *EncoderDecoder {
+	return NewEncoderDecoder(ws,
+		func(w io.Writer) Encoder { return gob.NewEncoder(w) },
+		func(r io.Reader) Decoder { return gob.NewDecoder(r) },
+	)
+}
+
+// NewJSONEncoderDecoder constructs an encoder and decoder pair using encoding/json
+func NewJSONEncoderDecoder(ws *Websocket) *EncoderDecoder {
+	return NewEncoderDecoder(ws,
+		func(w io.Writer) Encoder { return json.NewEncoder(w) },
+		func(r io.Reader) Decoder { return json.NewDecoder(r) },
+	)
+}
+
+// Encode encodes a value onto the stream
+func (e *EncoderDecoder) Encode(v interface{}) error {
+	e.encoderLock.Lock()
+	defer e.encoderLock.Unlock()
+
+	// The peer on a new connection hasn't seen anything we encoded before, so start a fresh encoder
+	generation := e.ws.getGeneration()
+	if generation != e.encoderGeneration {
+		e.ws.configuration.Logger.Debug("Connection changed, rebuilding stream encoder")
+		e.encoder = e.newEncoder(e.writer)
+		e.encoderGeneration = generation
+	}
+
+	return e.encoder.Encode(v)
+}
+
+// Decode decodes the next value from the stream, returning ErrStreamReset if the connection was re-established
+func (e *EncoderDecoder) Decode(v interface{}) error {
+	e.decoderLock.Lock()
+	defer e.decoderLock.Unlock()
+
+	err := e.decoder.Decode(v)
+
+	// The decoder may have buffered data from the old connection, so start a fresh one
+	if errors.Is(err, ErrStreamReset) {
+		e.ws.configuration.Logger.Debug("Connection changed, rebuilding stream decoder")
+		e.decoder = e.newDecoder(e.reader)
+		return ErrStreamReset
+	}
+
+	return err
+}
+
+// Close closes the underlying stream, unblocking any pending Decode
+func (e *EncoderDecoder) Close() error {
+	_ = e.reader.Close()
+	return e.writer.Close()
+}
@@ -0,0 +1,214 @@
+package gows
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// errStreamAudited is returned by SendStream while an outbound audit hook is set, since a streamed payload can't be
+// audited before it's written
+var errStreamAudited = errors.New("streamed messages can't be audited, so SendStream is unavailable with OutboundAudit")
+
+// streamTarget defines the connection and frame writer handed to a message stream once the sender reaches it
+type streamTarget struct {
+	connection *websocket.Conn
+	writer     io.WriteCloser
+}
+
+// messageStream defines an outbound message that's written straight to the connection as the application produces it,
+// instead of being buffered in the send queue
+type messageStream struct {
+	ws  *Websocket
+	msg *message
+
+	lock    *sync.Mutex
+	claimed bool // Whether the sender has started writing the message
+	closed  bool // Whether the application has closed the stream
+
+	ready   chan streamTarget // Receives the frame writer once the sender reaches the message
+	done    chan error        // Receives the result of closing the frame writer
+	target  *streamTarget     // The frame writer, once it's been received
+	written int64             // The number of bytes written so far
+}
+
+// SendStream queues a message whose payload is written through the returned writer, so large messages can be
+// sent without holding them in memory. The stream holds its place in the send queue, and Write blocks until the sender
+// reaches it. While the stream is open, nothing else is sent, so it must always be closed. Closing it before the sender
+// reaches it removes it from the queue. Writes that would take the message past the maximum message size fail with
+// ErrMessageTooLarge. Streamed messages bypass the outbound middleware, and aren't resent if the connection drops part
+// way through. Since they can't be audited either, SendStream fails while an outbound audit hook is set
+func (ws *Websocket) SendStream() (io.WriteCloser, error) {
+	if ws.isShuttingDown() {
+		return nil, ErrShuttingDown
+	}
+	if ws.configuration.OutboundAudit != nil {
+		return nil, errStreamAudited
+	}
+
+	msg := newMessage(ws.configuration.getDefaultMessageType(), nil)
+	msg.stream = &messageStream{
+		ws:    ws,
+		msg:   msg,
+		lock:  &sync.Mutex{},
+		ready: make(chan streamTarget, 1),
+		done:  make(chan error, 1),
+	}
+
+	err := ws.enqueue(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.stream, nil
+}
+
+// Write writes part of the message payload, waiting for the sender to reach the message first
+func (s *messageStream) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	closed := s.closed
+	s.lock.Unlock()
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	// Refuse to write past the message size limit
+	if s.ws.configuration.tooLarge(s.written + int64(len(p))) {
+		return 0, s.ws.configuration.messageTooLarge(s.written + int64(len(p)))
+	}
+
+	// Wait for the sender to reach the message, then for the bandwidth cap to allow the chunk
+	target := s.wait()
+	s.ws.waitForBandwidth(nil, len(p))
+
+	_ = target.connection.SetWriteDeadline(time.Now().Add(s.ws.configuration.WriteTimeout))
+	written, err := target.writer.Write(p)
+	s.written += int64(written)
+	return written, err
+}
+
+// Close finishes the message. If the sender hasn't reached it yet, it's removed from the send queue instead
+func (s *messageStream) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	claimed := s.claimed
+	s.lock.Unlock()
+
+	if !claimed {
+		s.ws.sendQueue.remove(s.msg)
+		return nil
+	}
+
+	target := s.wait()
+	_ = target.connection.SetWriteDeadline(time.Now().Add(s.ws.configuration.WriteTimeout))
+	err := target.writer.Close()
+	s.done <- err
+	return err
+}
+
+// wait waits for the sender to hand over the frame writer
+func (s *messageStream) wait() *streamTarget {
+	if s.target == nil {
+		target := <-s.ready
+		s.target = &target
+	}
+
+	return s.target
+}
+
+// claim marks the stream as being written by the sender, returning false if it was already closed
+func (s *messageStream) claim() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.claimed = true
+	return true
+}
+
+// release returns the stream to the queue after the sender failed to start writing it
+func (s *messageStream) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.claimed = false
+}
+
+// writeStream opens a frame for a streamed message and hands it to the application, holding the sender until the
+// application closes the stream
+func (ws *Websocket) writeStream(connection *websocket.Conn, msg *message) error {
+	if !msg.stream.claim() {
+		ws.configuration.Logger.Trace("SENDER: Stream was closed before it was sent, skipping it")
+		return nil
+	}
+
+	_ = connection.SetWriteDeadline(time.Now().Add(ws.configuration.WriteTimeout))
+	writer, err := connection.NextWriter(msg.messageType)
+	if err != nil {
+		msg.stream.release()
+		return err
+	}
+
+	ws.configuration.Logger.Trace("SENDER: Handing frame writer to stream...")
+	msg.stream.ready <- streamTarget{connection: connection, writer: writer}
+	return <-msg.stream.done
+}
+
+// OnMessageStream sets a handler that receives every inbound message as a reader instead of a byte slice, so large
+// messages can be processed without holding them in memory. The handler runs on the read loop, and the next message
+// isn't read until it returns, so it should consume the reader promptly. Anything left unread is discarded. Streamed
+// messages bypass the dispatcher entirely, so the message handlers, middleware, and listeners don't see them. Passing
+// nil switches back to regular message delivery
+func (ws *Websocket) OnMessageStream(handler func(messageType int, r io.Reader)) {
+	ws.messageStreamHandlerLock.Lock()
+	ws.messageStreamHandler = handler
+	ws.messageStreamHandlerLock.Unlock()
+}
+
+// getMessageStreamHandler gets the message stream handler, nil if messages aren't being streamed
+func (ws *Websocket) getMessageStreamHandler() func(int, io.Reader) {
+	ws.messageStreamHandlerLock.Lock()
+	defer ws.messageStreamHandlerLock.Unlock()
+
+	return ws.messageStreamHandler
+}
+
+// readStream reads the next inbound message as a stream, handing it to the supplied handler
+func (ws *Websocket) readStream(connection *websocket.Conn, handler func(int, io.Reader)) error {
+	messageType, reader, err := connection.NextReader()
+	if err != nil {
+		return err
+	}
+
+	counter := &countingReader{reader: reader}
+	handler(messageType, counter)
+
+	// Discard whatever the handler didn't read, so the next message can be read
+	_, err = io.Copy(ioutil.Discard, counter)
+	ws.throughput.received(int(counter.read), ws.now())
+	ws.inboundSizes.record(int(counter.read))
+	return err
+}
+
+// countingReader defines a reader that counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+// Read reads from the underlying reader, counting the bytes read
+func (r *countingReader) Read(p []byte) (int, error) {
+	read, err := r.reader.Read(p)
+	r.read += int64(read)
+	return read, err
+}
@@ -0,0 +1,220 @@
+package gows
+
+import (
+	"sync"
+	"time"
+)
+
+// SubscriptionMatcher defines a function that determines if an inbound message is the server's response to a
+// subscription message. It returns true if the message is a response, along with an error if the subscription was
+// rejected
+type SubscriptionMatcher func(subscription []byte, msg []byte) (bool, error)
+
+// Subscription defines a registered subscription message that is replayed after every reconnect
+type Subscription struct {
+	subscriptions *subscriptions
+	message       *message
+
+	// Confirmation information, protected by the registry lock
+	awaiting            bool        // Whether the subscription is waiting for a confirmation
+	confirmed           bool        // Whether the subscription has been confirmed at least once
+	subscribedHandler   func()      // Called when the initial subscription is confirmed
+	resubscribedHandler func()      // Called when the subscription is confirmed after a reconnect
+	failedHandler       func(error) // Called when the server rejects the subscription
+
+	// Cursor information, protected by the registry lock
+	cursor        string             // The last seen position in the subscription's data
+	sentCursor    string             // The cursor included in the last resubscribe message
+	cursorHandler func(string, bool) // Called with whether the server honored the resubscribe cursor
+
+	// Pruning information, protected by the registry lock
+	topic        string    // The topic pattern the subscription delivers data for
+	lastActivity time.Time // When the subscription last received data, or was last (re)subscribed
+}
+
+// OnSubscribed sets the handler called when the server confirms the initial subscription
+func (s *Subscription) OnSubscribed(handler func()) {
+	s.subscriptions.lock.Lock()
+	s.subscribedHandler = handler
+	s.subscriptions.lock.Unlock()
+}
+
+// OnResubscribed sets the handler called when the server confirms the subscription replayed after a reconnect, meaning
+// data is flowing for it again
+func (s *Subscription) OnResubscribed(handler func()) {
+	s.subscriptions.lock.Lock()
+	s.resubscribedHandler = handler
+	s.subscriptions.lock.Unlock()
+}
+
+// OnSubscribeFailed sets the handler called with the reason when the server rejects the subscription
+func (s *Subscription) OnSubscribeFailed(handler func(error)) {
+	s.subscriptions.lock.Lock()
+	s.failedHandler = handler
+	s.subscriptions.lock.Unlock()
+}
+
+// Remove stops replaying the subscription message on reconnect
+func (s *Subscription) Remove() {
+	s.subscriptions.remove(s)
+}
+
+// subscriptions defines a thread-safe, ordered registry of subscriptions
+type subscriptions struct {
+	lock          *sync.Mutex
+	subscriptions []*Subscription
+}
+
+// newSubscriptions constructs a new subscription registry
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		lock:          &sync.Mutex{},
+		subscriptions: make([]*Subscription, 0),
+	}
+}
+
+// add registers a subscription message at the supplied time
+func (s *subscriptions) add(msg *message, now time.Time) *Subscription {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription := &Subscription{
+		subscriptions:       s,
+		message:             msg,
+		awaiting:            true,
+		subscribedHandler:   func() {},
+		resubscribedHandler: func() {},
+		failedHandler:       func(error) {},
+		cursorHandler:       func(string, bool) {},
+		lastActivity:        now,
+	}
+	s.subscriptions = append(s.subscriptions, subscription)
+	return subscription
+}
+
+// remove unregisters a subscription
+func (s *subscriptions) remove(subscription *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, existing := range s.subscriptions {
+		if existing == subscription {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+// resubscribing gets the subscription messages in registration order, marking every subscription as awaiting a new
+// confirmation as of the supplied time. Subscriptions with a cursor have it injected into their message if an injector is supplied. Any
+// injection failures are returned alongside the messages, and the affected subscriptions are replayed without a cursor
+func (s *subscriptions) resubscribing(injector CursorInjector, now time.Time) ([]*message, []error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	messages := make([]*message, 0, len(s.subscriptions))
+	errs := make([]error, 0)
+	for _, subscription := range s.subscriptions {
+		subscription.awaiting = true
+		subscription.sentCursor = ""
+		subscription.lastActivity = now
+
+		msg, err := subscription.withCursor(injector)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, errs
+}
+
+// confirm matches an inbound message against the subscriptions awaiting confirmation, calling the relevant lifecycle
+// handler for the first one it confirms or rejects. If a resubscribe carried a cursor, the honored function determines
+// whether the server resumed from it. Returns false if the message didn't match any subscription
+func (s *subscriptions) confirm(matcher SubscriptionMatcher, honored func([]byte) bool, msg []byte) bool {
+	s.lock.Lock()
+
+	for _, subscription := range s.subscriptions {
+		if !subscription.awaiting {
+			continue
+		}
+
+		matched, err := matcher(subscription.message.data, msg)
+		if !matched {
+			continue
+		}
+
+		// Pick the handler while holding the lock, but call it after releasing it so it can manage subscriptions
+		subscription.awaiting = false
+		var handler func()
+		switch {
+		case err != nil:
+			failedHandler := subscription.failedHandler
+			handler = func() { failedHandler(err) }
+		case subscription.confirmed && subscription.sentCursor != "" && honored != nil:
+			resubscribedHandler, cursorHandler := subscription.resubscribedHandler, subscription.cursorHandler
+			cursor, cursorHonored := subscription.sentCursor, honored(msg)
+			handler = func() {
+				resubscribedHandler()
+				cursorHandler(cursor, cursorHonored)
+			}
+		case subscription.confirmed:
+			handler = subscription.resubscribedHandler
+		default:
+			handler = subscription.subscribedHandler
+		}
+		subscription.confirmed = subscription.confirmed || err == nil
+
+		s.lock.Unlock()
+		handler()
+		return true
+	}
+
+	s.lock.Unlock()
+	return false
+}
+
+// AddResubscribeMessage registers a binary message that is automatically sent again after every reconnect, ahead of
+// anything already waiting in the send queue. The message is not sent right away, so the initial subscription should
+// still be sent normally
+func (ws *Websocket) AddResubscribeMessage(msg []byte) *Subscription {
+	return ws.subscriptions.add(newMessage(BinaryMessage, msg), ws.now())
+}
+
+// AddResubscribeText registers a text message that is automatically sent again after every reconnect, ahead of anything
+// already waiting in the send queue
+func (ws *Websocket) AddResubscribeText(msg string) *Subscription {
+	return ws.subscriptions.add(newMessage(TextMessage, []byte(msg)), ws.now())
+}
+
+// resubscribe puts every subscription message that passes the audit hook at the front of the send queue, in
+// registration order
+func (ws *Websocket) resubscribe() {
+	replayed, errs := ws.subscriptions.resubscribing(ws.configuration.CursorInjector, ws.now())
+	for _, err := range errs {
+		ws.reportError(err)
+	}
+
+	messages := make([]*message, 0, len(replayed))
+	for _, msg := range replayed {
+		if audited, ok := ws.auditMessage(msg); ok {
+			messages = append(messages, audited)
+		}
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	ws.configuration.Logger.Debug("Replaying", len(messages), "subscription messages")
+	ws.sendQueue.requeueAll(messages)
+}
+
+// confirmSubscription matches an inbound message against the subscriptions awaiting confirmation, returning true if it
+// was a confirmation or rejection
+func (ws *Websocket) confirmSubscription(msg []byte) bool {
+	if ws.configuration.SubscriptionMatcher == nil {
+		return false
+	}
+
+	return ws.subscriptions.confirm(ws.configuration.SubscriptionMatcher, ws.configuration.CursorHonored, msg)
+}
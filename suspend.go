@@ -0,0 +1,110 @@
+package gows
+
+import (
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// SuspendAction defines what the websocket does when it detects that the machine was suspended
+type SuspendAction int
+
+const (
+	SuspendPing      SuspendAction = iota // Ping immediately, dropping the connection if no pong arrives in time
+	SuspendReconnect                      // Drop the connection and reconnect immediately
+)
+
+// OnSuspended sets the onSuspended handler, called when the clock jumps forward because the machine was suspended
+// or the VM was paused, with how long it was gone for
+func (ws *Websocket) OnSuspended(handler func(gone time.Duration)) {
+	ws.suspendedHandlerLock.Lock()
+	ws.suspendedHandler = handler
+	ws.suspendedHandlerLock.Unlock()
+}
+
+// suspendWatcher defines the goroutine responsible for detecting suspends. Timers run on the monotonic clock, which
+// doesn't advance while a laptop is asleep, so after resuming the read deadline can be far from expiring even though
+// the server has long since dropped the connection. Comparing the wall clock against the monotonic clock catches the
+// sleep, and a tick that arrives much later than scheduled catches a paused VM
+func (ws *Websocket) suspendWatcher(stopChannel chan struct{}) {
+	interval := ws.configuration.getSuspendCheckInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+
+		case <-stopChannel:
+			ws.configuration.Logger.Trace("SUSPEND: Shutting down")
+			return
+
+		case <-ticker.C:
+			now := time.Now()
+			gone := clockJump(last, now, interval)
+			last = now
+
+			if gone > ws.configuration.SuspendThreshold && !ws.resumed(gone) {
+				return
+			}
+		}
+	}
+}
+
+// clockJump works out how much longer than the interval passed between two checks, using whichever of the wall clock
+// and the monotonic clock jumped further
+func clockJump(last time.Time, now time.Time, interval time.Duration) time.Duration {
+	monotonic := now.Sub(last)
+	wall := now.Round(0).Sub(last.Round(0))
+
+	jump := monotonic - interval
+	if wall-monotonic > jump {
+		jump = wall - monotonic
+	}
+	return jump
+}
+
+// resumed checks the health of the connection after a suspend, either pinging with a short read deadline or dropping
+// the connection outright. Returns false if the connection is gone and the watcher should exit
+func (ws *Websocket) resumed(gone time.Duration) bool {
+	ws.configuration.Logger.Info("Detected a suspend of", gone, "checking the connection")
+
+	ws.suspendedHandlerLock.Lock()
+	ws.safely("suspended", func() { ws.suspendedHandler(gone) })
+	ws.suspendedHandlerLock.Unlock()
+
+	connection := ws.getConnection()
+	if connection == nil {
+		ws.configuration.Logger.Trace("SUSPEND: No connection to check, shutting down")
+		return false
+	}
+
+	if ws.configuration.SuspendAction == SuspendReconnect {
+		ws.configuration.Logger.Trace("SUSPEND: Flagging the websocket drop...")
+		ws.handleConnectionError(ErrSuspended)
+		return false
+	}
+
+	// The pong handler restores the regular read deadline, so the connection only drops if the pong doesn't arrive
+	timeout := ws.configuration.getControlWriteTimeout()
+	_ = connection.SetReadDeadline(time.Now().Add(timeout))
+	err := ws.writeControl(connection, websocket.PingMessage, nil)
+	if err != nil {
+		ws.configuration.Logger.Trace("SUSPEND: Failed to write ping, flagging the websocket drop...")
+		ws.reportError(err)
+		ws.handleConnectionError(err)
+		return false
+	}
+
+	ws.configuration.Logger.Trace("SUSPEND: Wrote ping, waiting", timeout, "for the pong")
+	return true
+}
+
+// getSuspendCheckInterval gets how often the suspend watcher checks the clock, which is a quarter of the threshold
+// but at most once a second
+func (c *Configuration) getSuspendCheckInterval() time.Duration {
+	interval := c.SuspendThreshold / 4
+	if interval < time.Second {
+		return time.Second
+	}
+	return interval
+}
@@ -0,0 +1,214 @@
+package gows
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemdBufferSize is the number of state updates buffered for systemd before new ones are dropped
+const systemdBufferSize = 16
+
+// SystemdConfiguration defines the options structure for the systemd integration. The defaults come from the
+// environment systemd sets up for the service, so an empty configuration is usually all that's needed
+type SystemdConfiguration struct {
+	Socket           string        // The notification socket, defaults to $NOTIFY_SOCKET
+	WatchdogInterval time.Duration // How often the watchdog is fed, defaults to half of $WATCHDOG_USEC
+	Tolerance        time.Duration // How long the websocket can be disconnected before the watchdog stops being fed
+}
+
+// Systemd defines a goroutine that reports readiness to systemd after the websocket connects, and feeds systemd's
+// watchdog for as long as the connection is healthy. If the websocket stays disconnected for longer than the tolerance,
+// the watchdog goes hungry and systemd restarts the service
+type Systemd struct {
+	ws            *Websocket
+	configuration *SystemdConfiguration
+
+	lock        *sync.Mutex
+	ready       bool      // Whether readiness was reported
+	lastHealthy time.Time // When the websocket was last known to be connected
+
+	detach       func()        // Removes the integration from the websocket's lifecycle listeners
+	stateChannel chan string   // Channel of state updates waiting to be sent
+	stopChannel  chan struct{} // Channel closed when the integration is stopped
+	doneChannel  chan struct{} // Channel closed when the integration's goroutine exits
+	stopOnce     *sync.Once    // Ensures the integration is only stopped once
+}
+
+// Systemd starts the systemd integration, sending READY=1 once the websocket is connected, status updates on every
+// connect and disconnect, and WATCHDOG=1 on the watchdog interval while the connection is healthy. When the service
+// isn't running under systemd, the integration does nothing
+func (ws *Websocket) Systemd(configuration *SystemdConfiguration) *Systemd {
+	systemd := &Systemd{
+		ws:            ws,
+		configuration: configuration.withEnvironment(),
+		lock:          &sync.Mutex{},
+		lastHealthy:   time.Now(),
+		stateChannel:  make(chan string, systemdBufferSize),
+		stopChannel:   make(chan struct{}),
+		doneChannel:   make(chan struct{}),
+		stopOnce:      &sync.Once{},
+	}
+
+	// Not running under systemd, there's nobody to notify
+	if systemd.configuration.Socket == "" {
+		systemd.detach = func() {}
+		close(systemd.doneChannel)
+		return systemd
+	}
+
+	systemd.detach = ws.lifecycleListeners.add(systemd.observe)
+	if ws.IsConnected() {
+		systemd.observe(LifecycleEvent{Type: EventConnected})
+	}
+
+	go systemd.run()
+	return systemd
+}
+
+// withEnvironment gets a copy of the configuration with the defaults from the environment filled in
+func (c *SystemdConfiguration) withEnvironment() *SystemdConfiguration {
+	configuration := *c
+
+	if configuration.Socket == "" {
+		configuration.Socket = os.Getenv("NOTIFY_SOCKET")
+	}
+
+	if configuration.WatchdogInterval <= 0 {
+		microseconds, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+		if err == nil && microseconds > 0 {
+			configuration.WatchdogInterval = time.Duration(microseconds) * time.Microsecond / 2
+		}
+	}
+
+	return &configuration
+}
+
+// Close stops reporting to systemd, telling it the service is stopping
+func (s *Systemd) Close() {
+	s.stopOnce.Do(func() {
+		s.detach()
+		close(s.stopChannel)
+	})
+	<-s.doneChannel
+
+	if s.configuration.Socket != "" {
+		s.notify("STOPPING=1")
+	}
+}
+
+// observe reports lifecycle events to systemd. It runs on the lifecycle listener path, so the state updates are handed
+// to the integration's goroutine instead of being sent here
+func (s *Systemd) observe(event LifecycleEvent) {
+	switch event.Type {
+
+	case EventConnected:
+		s.lock.Lock()
+		s.lastHealthy = time.Now()
+		ready := s.ready
+		s.ready = true
+		s.lock.Unlock()
+
+		if !ready {
+			s.offer("READY=1\nSTATUS=Connected")
+		} else {
+			s.offer("STATUS=Connected")
+		}
+
+	case EventDisconnected:
+		s.offer("STATUS=Disconnected: " + strings.TrimSpace(event.Error))
+
+	case EventGaveUp:
+		s.offer("STATUS=Gave up connecting: " + strings.TrimSpace(event.Error))
+	}
+}
+
+// offer hands a state update to the integration's goroutine, dropping it if the buffer is full
+func (s *Systemd) offer(state string) {
+	select {
+	case s.stateChannel <- state:
+	default:
+		s.ws.reportError(errors.New("systemd buffer is full, dropping state update"))
+	}
+}
+
+// healthy determines if the watchdog should be fed, which is the case while the websocket is connected, and for up to
+// the tolerance after it was last connected
+func (s *Systemd) healthy(now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.ws.IsConnected() {
+		s.lastHealthy = now
+		return true
+	}
+
+	return now.Sub(s.lastHealthy) <= s.configuration.Tolerance
+}
+
+// run defines the goroutine responsible for sending state updates to systemd and feeding its watchdog
+func (s *Systemd) run() {
+	defer close(s.doneChannel)
+
+	// Only tick if a watchdog is configured, a nil channel never fires
+	var tick <-chan time.Time
+	if s.configuration.WatchdogInterval > 0 {
+		ticker := time.NewTicker(s.configuration.WatchdogInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+
+		// Stopped, send whatever is buffered
+		case <-s.stopChannel:
+			for {
+				select {
+				case state := <-s.stateChannel:
+					s.notify(state)
+				default:
+					return
+				}
+			}
+
+		case state := <-s.stateChannel:
+			s.notify(state)
+
+		case now := <-tick:
+			if s.healthy(now) {
+				s.notify("WATCHDOG=1")
+			} else {
+				s.ws.configuration.Logger.Debug("Websocket is unhealthy, not feeding the systemd watchdog")
+			}
+		}
+	}
+}
+
+// notify sends a state update to systemd, reporting any failure to the error handler
+func (s *Systemd) notify(state string) {
+	err := sdNotify(s.configuration.Socket, state)
+	if err != nil {
+		s.ws.reportError(err)
+	}
+}
+
+// sdNotify sends a state update to the systemd notification socket. Socket names starting with @ are abstract sockets
+func sdNotify(socket string, state string) error {
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	connection, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	_, err = connection.Write([]byte(state))
+	return err
+}
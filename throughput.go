@@ -0,0 +1,135 @@
+package gows
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// throughputInterval is how often the moving averages are updated, matching the Unix load average
+const throughputInterval = 5 * time.Second
+
+// throughputMaxCatchUp is the maximum number of idle intervals applied at once, after which the averages are zero for
+// all practical purposes
+const throughputMaxCatchUp = 1000
+
+// Decay factors for the 1, 5, and 15 minute averages over one interval
+var (
+	decay1  = math.Exp(-throughputInterval.Seconds() / time.Minute.Seconds())
+	decay5  = math.Exp(-throughputInterval.Seconds() / (5 * time.Minute).Seconds())
+	decay15 = math.Exp(-throughputInterval.Seconds() / (15 * time.Minute).Seconds())
+)
+
+// Rate defines exponential moving averages of a per-second rate
+type Rate struct {
+	OneMinute     float64 // The 1 minute moving average
+	FiveMinute    float64 // The 5 minute moving average
+	FifteenMinute float64 // The 15 minute moving average
+}
+
+// update folds the rate measured over the last interval into the averages
+func (r *Rate) update(rate float64) {
+	r.OneMinute = r.OneMinute*decay1 + rate*(1-decay1)
+	r.FiveMinute = r.FiveMinute*decay5 + rate*(1-decay5)
+	r.FifteenMinute = r.FifteenMinute*decay15 + rate*(1-decay15)
+}
+
+// Throughput defines moving averages of the per-second message and byte rates in both directions
+type Throughput struct {
+	MessagesIn  Rate // Messages received per second
+	BytesIn     Rate // Bytes received per second
+	MessagesOut Rate // Messages sent per second
+	BytesOut    Rate // Bytes sent per second
+}
+
+// throughput defines a thread-safe tracker of throughput moving averages. The averages are brought up to date lazily
+// whenever traffic is recorded or a snapshot is taken, so no goroutine is needed
+type throughput struct {
+	lock  *sync.Mutex
+	rates Throughput
+	last  time.Time // The start of the current interval
+
+	// Counts for the current interval
+	messagesIn  uint64
+	bytesIn     uint64
+	messagesOut uint64
+	bytesOut    uint64
+
+	// Counts since the websocket was created
+	totalMessagesIn  uint64
+	totalBytesIn     uint64
+	totalMessagesOut uint64
+	totalBytesOut    uint64
+}
+
+// newThroughput constructs a new throughput tracker
+func newThroughput(now time.Time) *throughput {
+	return &throughput{
+		lock: &sync.Mutex{},
+		last: now,
+	}
+}
+
+// received records an inbound message of the supplied size
+func (t *throughput) received(size int, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.tick(now)
+	t.messagesIn++
+	t.bytesIn += uint64(size)
+	t.totalMessagesIn++
+	t.totalBytesIn += uint64(size)
+}
+
+// sent records an outbound message of the supplied size
+func (t *throughput) sent(size int, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.tick(now)
+	t.messagesOut++
+	t.bytesOut += uint64(size)
+	t.totalMessagesOut++
+	t.totalBytesOut += uint64(size)
+}
+
+// snapshot gets the current moving averages
+func (t *throughput) snapshot(now time.Time) Throughput {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.tick(now)
+	return t.rates
+}
+
+// totals fills in the message and byte counts of a stats snapshot
+func (t *throughput) totals(stats *Stats) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats.MessagesReceived = t.totalMessagesIn
+	stats.BytesReceived = t.totalBytesIn
+	stats.MessagesSent = t.totalMessagesOut
+	stats.BytesSent = t.totalBytesOut
+}
+
+// tick folds every interval that has ended into the averages. The counts belong to the first of them, and any others
+// were idle. Must be called with the lock held
+func (t *throughput) tick(now time.Time) {
+	seconds := throughputInterval.Seconds()
+	for i := 0; now.Sub(t.last) >= throughputInterval; i++ {
+		if i == throughputMaxCatchUp {
+			t.rates = Throughput{}
+			t.last = now
+			return
+		}
+
+		t.rates.MessagesIn.update(float64(t.messagesIn) / seconds)
+		t.rates.BytesIn.update(float64(t.bytesIn) / seconds)
+		t.rates.MessagesOut.update(float64(t.messagesOut) / seconds)
+		t.rates.BytesOut.update(float64(t.bytesOut) / seconds)
+		t.messagesIn, t.bytesIn, t.messagesOut, t.bytesOut = 0, 0, 0, 0
+		t.last = t.last.Add(throughputInterval)
+	}
+}
@@ -0,0 +1,230 @@
+package gows
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultTopTalkers is the number of topics reported as top talkers by default
+const defaultTopTalkers = 10
+
+// defaultTopTalkersWindow is the default window top talkers are ranked over
+const defaultTopTalkersWindow = time.Minute
+
+// defaultMaxTrackedTopics is the number of topics statistics are kept for by default
+const defaultMaxTrackedTopics = 10000
+
+// TopicStats defines a snapshot of the traffic received on a single topic
+type TopicStats struct {
+	Messages     uint64    // The number of messages received on the topic
+	Bytes        uint64    // The number of payload bytes received on the topic
+	LastReceived time.Time // When the last message was received on the topic
+}
+
+// TopicVolume defines the traffic received on a single topic over the recent top talkers window
+type TopicVolume struct {
+	Topic    string // The topic
+	Messages uint64 // The number of messages received on the topic during the window
+	Bytes    uint64 // The number of payload bytes received on the topic during the window
+}
+
+// topicStats defines a thread-safe registry of per-topic traffic statistics, along with the recent volume of every
+// topic for ranking the top talkers. Volumes are counted in windows, and a topic's recent volume covers the current
+// window and the one before it, so a flood shows up right away and fades out once it stops. Statistics are kept for up
+// to the limit of topics, evicting the one that received a message least recently, and topics first seen in a window
+// after the limit is reached aren't ranked until the next one
+type topicStats struct {
+	lock        *sync.Mutex
+	limit       int
+	topics      map[string]*list.Element // The list element holding every topic's statistics
+	recency     *list.List               // Every topic's statistics, the one that received a message most recently first
+	window      time.Duration
+	windowStart time.Time
+	current     map[string]*TopicVolume // The volume of every topic during the current window
+	previous    map[string]*TopicVolume // The volume of every topic during the previous window
+}
+
+// topicEntry defines the statistics of a single topic in the recency list
+type topicEntry struct {
+	topic string
+	stats TopicStats
+}
+
+// newTopicStats constructs a new topic statistics registry, keeping statistics for up to the supplied number of topics
+// and counting recent volumes over the supplied window
+func newTopicStats(limit int, window time.Duration) *topicStats {
+	return &topicStats{
+		lock:     &sync.Mutex{},
+		limit:    limit,
+		topics:   make(map[string]*list.Element),
+		recency:  list.New(),
+		window:   window,
+		current:  make(map[string]*TopicVolume),
+		previous: make(map[string]*TopicVolume),
+	}
+}
+
+// record records a message received on the supplied topic
+func (t *topicStats) record(topic string, size int, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	element, ok := t.topics[topic]
+	if ok {
+		t.recency.MoveToFront(element)
+	} else {
+		if len(t.topics) >= t.limit {
+			oldest := t.recency.Back()
+			delete(t.topics, oldest.Value.(*topicEntry).topic)
+			t.recency.Remove(oldest)
+		}
+		element = t.recency.PushFront(&topicEntry{topic: topic})
+		t.topics[topic] = element
+	}
+
+	stats := &element.Value.(*topicEntry).stats
+	stats.Messages++
+	stats.Bytes += uint64(size)
+	stats.LastReceived = now
+
+	t.rotate(now)
+	volume, ok := t.current[topic]
+	if !ok {
+		if len(t.current) >= t.limit {
+			return
+		}
+		volume = &TopicVolume{Topic: topic}
+		t.current[topic] = volume
+	}
+
+	volume.Messages++
+	volume.Bytes += uint64(size)
+}
+
+// rotate moves on to a new window once the current one is over, forgetting the previous window entirely if no message
+// arrived for a whole window. Must be called with the lock held
+func (t *topicStats) rotate(now time.Time) {
+	if t.windowStart.IsZero() {
+		t.windowStart = now
+		return
+	}
+
+	elapsed := now.Sub(t.windowStart)
+	if elapsed < t.window {
+		return
+	}
+
+	if elapsed < 2*t.window {
+		t.previous = t.current
+	} else {
+		t.previous = make(map[string]*TopicVolume)
+	}
+	t.current = make(map[string]*TopicVolume)
+	t.windowStart = now
+}
+
+// topTalkers gets the supplied number of topics with the most bytes received recently, busiest first
+func (t *topicStats) topTalkers(n int, now time.Time) []TopicVolume {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.rotate(now)
+	volumes := make(map[string]TopicVolume, len(t.current)+len(t.previous))
+	for _, window := range []map[string]*TopicVolume{t.previous, t.current} {
+		for topic, volume := range window {
+			total := volumes[topic]
+			total.Topic = topic
+			total.Messages += volume.Messages
+			total.Bytes += volume.Bytes
+			volumes[topic] = total
+		}
+	}
+
+	talkers := make([]TopicVolume, 0, len(volumes))
+	for _, volume := range volumes {
+		talkers = append(talkers, volume)
+	}
+	sort.Slice(talkers, func(i, j int) bool {
+		if talkers[i].Bytes != talkers[j].Bytes {
+			return talkers[i].Bytes > talkers[j].Bytes
+		}
+		return talkers[i].Topic < talkers[j].Topic
+	})
+
+	if len(talkers) > n {
+		talkers = talkers[:n]
+	}
+	return talkers
+}
+
+// snapshot gets a copy of the statistics for every tracked topic
+func (t *topicStats) snapshot() map[string]TopicStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snapshot := make(map[string]TopicStats, len(t.topics))
+	for topic, element := range t.topics {
+		snapshot[topic] = element.Value.(*topicEntry).stats
+	}
+	return snapshot
+}
+
+// extractTopic extracts the topic from an inbound message using the configured topic extractor, recording it in the
+// topic statistics and the activity of matching subscriptions. Returns false if no extractor is configured or the message has no topic
+func (ws *Websocket) extractTopic(data []byte) (string, bool) {
+	if ws.configuration.TopicExtractor == nil {
+		return "", false
+	}
+
+	topic, ok := ws.configuration.TopicExtractor(data)
+	if !ok {
+		return "", false
+	}
+
+	now := ws.now()
+	ws.topicStats.record(topic, len(data), now)
+	ws.subscriptions.touch(topic, ws.router.separator, now)
+	return topic, true
+}
+
+// TopicStats gets a snapshot of the traffic received on every tracked topic, keyed by topic. Comparing the last received
+// times and counts between snapshots shows which topics are active, silent, or flooding. Once MaxTrackedTopics topics
+// are tracked, the topic that received a message least recently is forgotten to make room for a new one
+func (ws *Websocket) TopicStats() map[string]TopicStats {
+	return ws.topicStats.snapshot()
+}
+
+// TopTalkers gets the topics with the most inbound bytes over the last one to two top talkers windows, busiest first
+// (also included in Stats()). Unlike the totals in TopicStats(), this shows what is flooding the connection right now
+func (ws *Websocket) TopTalkers() []TopicVolume {
+	return ws.topicStats.topTalkers(ws.configuration.getTopTalkers(), ws.now())
+}
+
+// getTopTalkers gets the number of topics reported as top talkers
+func (c *Configuration) getTopTalkers() int {
+	if c.TopTalkers > 0 {
+		return c.TopTalkers
+	}
+
+	return defaultTopTalkers
+}
+
+// getMaxTrackedTopics gets the number of topics statistics are kept for
+func (c *Configuration) getMaxTrackedTopics() int {
+	if c.MaxTrackedTopics > 0 {
+		return c.MaxTrackedTopics
+	}
+
+	return defaultMaxTrackedTopics
+}
+
+// getTopTalkersWindow gets the window top talkers are ranked over
+func (c *Configuration) getTopTalkersWindow() time.Duration {
+	if c.TopTalkersWindow > 0 {
+		return c.TopTalkersWindow
+	}
+
+	return defaultTopTalkersWindow
+}
@@ -0,0 +1,111 @@
+package gows
+
+import (
+	"context"
+	"net/http"
+)
+
+// tracerName is the instrumentation name the tracer is requested with
+const tracerName = "github.com/miratronix/gows"
+
+// TracerProvider defines a source of tracers. It's shaped after OpenTelemetry's tracing API, so an adapter for an
+// OpenTelemetry TracerProvider only takes a few lines, without gows depending on OpenTelemetry itself
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+// Tracer defines a tracer that starts spans
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span defines a span in a trace
+type Span interface {
+	SetAttribute(key string, value interface{}) // Annotates the span
+	RecordError(err error)                      // Records an error on the span and marks it as failed
+	End()                                       // Ends the span
+}
+
+// tracer gets the configured tracer, or nil if tracing is disabled
+func (c *Configuration) tracer() Tracer {
+	if c.TracerProvider == nil {
+		return nil
+	}
+
+	return c.TracerProvider.Tracer(tracerName)
+}
+
+// noopSpan defines the span used when tracing is disabled
+type noopSpan struct{}
+
+// SetAttribute does nothing
+func (noopSpan) SetAttribute(string, interface{}) {}
+
+// RecordError does nothing
+func (noopSpan) RecordError(error) {}
+
+// End does nothing
+func (noopSpan) End() {}
+
+// startDialSpan starts the span for a connection attempt
+func (ws *Websocket) startDialSpan(ctx context.Context, attempt int) (context.Context, Span) {
+	if ws.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	ctx, span := ws.tracer.Start(ctx, "gows.dial")
+	span.SetAttribute("gows.attempt", attempt)
+	return ctx, span
+}
+
+// startSendSpan starts the span for writing a message
+func (ws *Websocket) startSendSpan(msg *message) Span {
+	if ws.tracer == nil {
+		return noopSpan{}
+	}
+
+	_, span := ws.tracer.Start(context.Background(), "gows.send")
+	span.SetAttribute("gows.message_type", msg.messageType)
+	span.SetAttribute("gows.size", msg.size())
+	return span
+}
+
+// endSpan records the error on a span, if there is one, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// injectTraceContext adds the trace context of the supplied context to the handshake headers, returning the headers
+func (ws *Websocket) injectTraceContext(ctx context.Context, header http.Header) http.Header {
+	if ws.configuration.TracePropagator == nil {
+		return header
+	}
+
+	// Copy the headers, since they may belong to the application
+	if header == nil {
+		header = http.Header{}
+	} else {
+		header = header.Clone()
+	}
+	ws.configuration.TracePropagator(ctx, header)
+	return header
+}
+
+// traceHandlers wraps a handle function so every handler invocation runs in its own span. Returns the handle function
+// as is if tracing is disabled
+func (ws *Websocket) traceHandlers(handle func(func())) func(func()) {
+	if ws.tracer == nil {
+		return handle
+	}
+
+	return func(handler func()) {
+		handle(func() {
+			_, span := ws.tracer.Start(context.Background(), "gows.handle")
+			defer span.End()
+			handler()
+		})
+	}
+}
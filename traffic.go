@@ -0,0 +1,88 @@
+package gows
+
+import "sync"
+
+// TrafficStats defines a snapshot of the traffic in a single category, as determined by the traffic classifier
+type TrafficStats struct {
+	MessagesSent     uint64 // The number of messages in the category written to the connection
+	BytesSent        uint64 // The number of payload bytes in the category written to the connection
+	MessagesReceived uint64 // The number of messages in the category read from the connection
+	BytesReceived    uint64 // The number of payload bytes in the category read from the connection
+}
+
+// trafficStats defines a thread-safe registry of per-category traffic statistics
+type trafficStats struct {
+	lock       *sync.Mutex
+	categories map[string]*TrafficStats
+}
+
+// newTrafficStats constructs a new traffic statistics registry
+func newTrafficStats() *trafficStats {
+	return &trafficStats{
+		lock:       &sync.Mutex{},
+		categories: make(map[string]*TrafficStats),
+	}
+}
+
+// record applies a change to the statistics of a category. Messages without a category aren't recorded
+func (t *trafficStats) record(category string, change func(*TrafficStats)) {
+	if category == "" {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats, ok := t.categories[category]
+	if !ok {
+		stats = &TrafficStats{}
+		t.categories[category] = stats
+	}
+	change(stats)
+}
+
+// snapshot gets a copy of the statistics for every category seen so far
+func (t *trafficStats) snapshot() map[string]TrafficStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snapshot := make(map[string]TrafficStats, len(t.categories))
+	for category, stats := range t.categories {
+		snapshot[category] = *stats
+	}
+	return snapshot
+}
+
+// classifyTraffic gets the category of a message using the configured traffic classifier, or an empty category if
+// there's no classifier
+func (ws *Websocket) classifyTraffic(messageType int, data []byte) string {
+	if ws.configuration.TrafficClassifier == nil {
+		return ""
+	}
+
+	return ws.configuration.TrafficClassifier(messageType, data)
+}
+
+// sentTraffic records an outbound message in its category. The message is classified before the outbound middleware,
+// while the size counts the bytes that were written
+func (ws *Websocket) sentTraffic(msg *message, size int) {
+	ws.trafficStats.record(ws.classifyTraffic(msg.messageType, msg.data), func(stats *TrafficStats) {
+		stats.MessagesSent++
+		stats.BytesSent += uint64(size)
+	})
+}
+
+// receivedTraffic records an inbound message in its category. The message is classified after the inbound middleware,
+// while the size counts the bytes that were read
+func (ws *Websocket) receivedTraffic(messageType int, data []byte, size int) {
+	ws.trafficStats.record(ws.classifyTraffic(messageType, data), func(stats *TrafficStats) {
+		stats.MessagesReceived++
+		stats.BytesReceived += uint64(size)
+	})
+}
+
+// TrafficStats gets a snapshot of the traffic in every category seen so far, keyed by the category returned by the
+// traffic classifier, e.g. to attribute bandwidth to features like chat, telemetry, and file sync
+func (ws *Websocket) TrafficStats() map[string]TrafficStats {
+	return ws.trafficStats.snapshot()
+}
@@ -0,0 +1,58 @@
+package gows
+
+import "time"
+
+// checkTTL determines if an inbound message is fresh enough to dispatch, based on the age of the timestamp extracted
+// with the configured extractor. Messages without a timestamp are always dispatched. Expired messages are counted
+func (ws *Websocket) checkTTL(data []byte, now time.Time) bool {
+	if ws.configuration.InboundTTL <= 0 || ws.configuration.InboundTimestamp == nil {
+		return true
+	}
+
+	timestamp, ok := ws.configuration.InboundTimestamp(data)
+	if !ok {
+		return true
+	}
+
+	age := now.Sub(timestamp)
+	if age <= ws.configuration.InboundTTL {
+		return true
+	}
+
+	ws.configuration.Logger.Trace("DISPATCHER: Inbound message is", age, "old")
+	ws.inboundExpired.increment()
+	return false
+}
+
+// SendWithTTL sends a message with the provided body that's discarded instead of sent if it's still waiting in
+// the queue once the TTL has passed, e.g. a heartbeat or presence update that's worse than nothing after an outage.
+// Expired messages are reported to the expired and message dropped handlers
+func (ws *Websocket) SendWithTTL(msg []byte, ttl time.Duration) error {
+	return ws.sendMessage(ws.configuration.getDefaultMessageType(), msg, func(queued *message) {
+		now := ws.now()
+		queued.queuedAt = now
+		queued.expiresAt = now.Add(ttl)
+	})
+}
+
+// OnExpired sets the onExpired handler, called with messages sent with SendWithTTL that expired in the queue, along
+// with how long they were queued
+func (ws *Websocket) OnExpired(handler func(msg []byte, queued time.Duration)) {
+	ws.expiredHandlerLock.Lock()
+	ws.expiredHandler = handler
+	ws.expiredHandlerLock.Unlock()
+}
+
+// expired determines if an outbound message has outlived its TTL, reporting it to the expired and message dropped
+// handlers if so
+func (ws *Websocket) expired(msg *message, now time.Time) bool {
+	if msg.expiresAt.IsZero() || now.Before(msg.expiresAt) {
+		return false
+	}
+
+	ws.expiredHandlerLock.Lock()
+	ws.expiredHandler(msg.data, now.Sub(msg.queuedAt))
+	ws.expiredHandlerLock.Unlock()
+	ws.dropMessage(msg.data, ErrExpired)
+	return true
+}
@@ -0,0 +1,118 @@
+package gows
+
+import "sync"
+
+// watermarks defines a thread-safe tracker of send queue depth against a high and low watermark, with hysteresis so
+// the crossings aren't reported over and over while the depth hovers around a watermark
+type watermarks struct {
+	lock     *sync.Mutex
+	high     int
+	low      int
+	above    bool
+	pressure chan struct{} // Closed while the depth is above the high watermark
+}
+
+// newWatermarks constructs a new watermark tracker. A high watermark of zero disables it, and the low watermark
+// defaults to half the high watermark
+func newWatermarks(high int, low int) *watermarks {
+	if low <= 0 || low >= high {
+		low = high / 2
+	}
+
+	return &watermarks{
+		lock:     &sync.Mutex{},
+		high:     high,
+		low:      low,
+		pressure: make(chan struct{}),
+	}
+}
+
+// update records the current depth, returning 1 if it just reached the high watermark, -1 if it just fell back to the
+// low watermark, or 0 otherwise
+func (w *watermarks) update(depth int) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.high <= 0 {
+		return 0
+	}
+
+	if !w.above && depth >= w.high {
+		w.above = true
+		close(w.pressure)
+		return 1
+	}
+
+	if w.above && depth <= w.low {
+		w.above = false
+		w.pressure = make(chan struct{})
+		return -1
+	}
+
+	return 0
+}
+
+// reached determines if the depth reached the high watermark and hasn't fallen back to the low watermark since
+func (w *watermarks) reached() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.above
+}
+
+// signal gets a channel that's closed once the depth reaches the high watermark, and stays closed until it falls back to
+// the low watermark
+func (w *watermarks) signal() <-chan struct{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.pressure
+}
+
+// OnQueueHighWatermark sets the onQueueHighWatermark handler, called with the queue depth when it reaches the
+// configured high watermark, and whether sending is currently blocked with BlockSend()
+func (ws *Websocket) OnQueueHighWatermark(handler func(depth int, blocked bool)) {
+	ws.queueHighWatermarkHandlerLock.Lock()
+	ws.queueHighWatermarkHandler = handler
+	ws.queueHighWatermarkHandlerLock.Unlock()
+}
+
+// OnQueueLowWatermark sets the onQueueLowWatermark handler, called with the queue depth when it falls back to the
+// configured low watermark after reaching the high watermark, and whether sending is currently blocked
+func (ws *Websocket) OnQueueLowWatermark(handler func(depth int, blocked bool)) {
+	ws.queueLowWatermarkHandlerLock.Lock()
+	ws.queueLowWatermarkHandler = handler
+	ws.queueLowWatermarkHandlerLock.Unlock()
+}
+
+// QueueLength gets the number of messages waiting in the send queue
+func (ws *Websocket) QueueLength() int {
+	return ws.sendQueue.length()
+}
+
+// Backpressure gets a channel that's closed while the send queue is backed up, from the moment it reaches the high
+// watermark until it falls back to the low watermark, so producers can slow down instead of piling messages into a
+// growing queue during degraded connectivity. Once the queue drains, a new channel is returned, so producers should
+// call it again rather than holding on to it. Without a high watermark, the channel is never closed
+func (ws *Websocket) Backpressure() <-chan struct{} {
+	return ws.watermarks.signal()
+}
+
+// checkWatermarks compares the send queue depth against the watermarks, notifying the relevant handler on a crossing
+func (ws *Websocket) checkWatermarks() {
+	depth, blocked := ws.sendQueue.depth()
+	switch ws.watermarks.update(depth) {
+
+	case 1:
+		ws.configuration.Logger.Debug("Send queue reached high watermark with", depth, "messages")
+		ws.queueHighWatermarkHandlerLock.Lock()
+		ws.queueHighWatermarkHandler(depth, blocked)
+		ws.queueHighWatermarkHandlerLock.Unlock()
+
+	case -1:
+		ws.configuration.Logger.Debug("Send queue fell back to low watermark with", depth, "messages")
+		ws.queueLowWatermarkHandlerLock.Lock()
+		ws.queueLowWatermarkHandler(depth, blocked)
+		ws.queueLowWatermarkHandlerLock.Unlock()
+	}
+}
@@ -0,0 +1,164 @@
+package gows
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultWebhookBufferSize is the number of events buffered for a webhook when none is configured
+const defaultWebhookBufferSize = 64
+
+// WebhookConfiguration defines the options structure for a webhook
+type WebhookConfiguration struct {
+	URL           string        // The endpoint events are POSTed to as JSON
+	Header        http.Header   // Extra headers added to every request, e.g. for authentication
+	Client        *http.Client  // The HTTP client used to deliver events, defaults to http.DefaultClient
+	Timeout       time.Duration // The timeout for a single delivery attempt
+	RetryAttempts int           // The number of times a failed delivery is retried before the event is dropped
+	RetryInterval time.Duration // The time to wait between delivery retries
+	BufferSize    int           // The number of events buffered before new ones are dropped, defaults to 64
+}
+
+// Webhook defines a goroutine that POSTs lifecycle events to an HTTP endpoint, so headless daemons can alert on
+// connection problems without a metrics pipeline
+type Webhook struct {
+	ws            *Websocket
+	configuration *WebhookConfiguration
+
+	eventChannel chan LifecycleEvent // Channel of events waiting to be delivered
+	detach       func()              // Removes the webhook from the websocket's lifecycle listeners
+	stopChannel  chan struct{}       // Channel closed when the webhook is stopped
+	doneChannel  chan struct{}       // Channel closed when the webhook has delivered its last event
+	stopOnce     *sync.Once          // Ensures the webhook is only stopped once
+}
+
+// Webhook starts POSTing lifecycle events (connected, disconnected, and gave up) to the configured endpoint. Events are
+// delivered in the background, in order, and retried on failure
+func (ws *Websocket) Webhook(configuration *WebhookConfiguration) *Webhook {
+	bufferSize := configuration.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultWebhookBufferSize
+	}
+
+	webhook := &Webhook{
+		ws:            ws,
+		configuration: configuration,
+		eventChannel:  make(chan LifecycleEvent, bufferSize),
+		stopChannel:   make(chan struct{}),
+		doneChannel:   make(chan struct{}),
+		stopOnce:      &sync.Once{},
+	}
+
+	webhook.detach = ws.lifecycleListeners.add(webhook.offer)
+	go webhook.run()
+	return webhook
+}
+
+// Close stops observing lifecycle events, delivering whatever is already buffered before returning. Deliveries made
+// after Close are attempted once, without retries, so Close doesn't wait out the retry interval
+func (w *Webhook) Close() {
+	w.stopOnce.Do(func() {
+		w.detach()
+		close(w.stopChannel)
+	})
+	<-w.doneChannel
+}
+
+// offer hands an event to the webhook, dropping it if the buffer is full
+func (w *Webhook) offer(event LifecycleEvent) {
+	select {
+	case w.eventChannel <- event:
+	default:
+		w.ws.reportError(errors.New("webhook buffer is full, dropping lifecycle event"))
+	}
+}
+
+// run defines the goroutine responsible for delivering events
+func (w *Webhook) run() {
+	defer close(w.doneChannel)
+
+	for {
+		select {
+
+		// Stopped, deliver whatever is buffered
+		case <-w.stopChannel:
+			for {
+				select {
+				case event := <-w.eventChannel:
+					w.deliver(event)
+				default:
+					return
+				}
+			}
+
+		case event := <-w.eventChannel:
+			w.deliver(event)
+		}
+	}
+}
+
+// deliver POSTs an event to the endpoint, retrying on failure until the webhook is closed, and reporting the event as
+// lost if it never succeeds
+func (w *Webhook) deliver(event LifecycleEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		w.ws.reportError(fmt.Errorf("failed to encode lifecycle event: %w", err))
+		return
+	}
+
+	for attempt := 0; attempt <= w.configuration.RetryAttempts; attempt++ {
+		if attempt > 0 && !sleep(w.stopChannel, w.configuration.RetryInterval) {
+			break
+		}
+
+		err = w.post(body)
+		if err == nil {
+			return
+		}
+		w.ws.configuration.Logger.Debug("Failed to deliver lifecycle event to webhook:", err)
+	}
+
+	w.ws.reportError(fmt.Errorf("failed to deliver %s event to webhook: %w", event.Type, err))
+}
+
+// post makes a single delivery attempt, treating any non-2xx response as a failure
+func (w *Webhook) post(body []byte) error {
+
+	// Only apply a timeout if one is configured
+	ctx, cancel := context.Background(), func() {}
+	if w.configuration.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), w.configuration.Timeout)
+	}
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.configuration.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range w.configuration.Header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := w.configuration.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", response.Status)
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package gows
 
 import (
 	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
 	"sync"
+	"time"
 )
 
 // Websocket defines a simple websocket structure
@@ -12,66 +15,437 @@ type Websocket struct {
 	// Connection information
 	connection               *websocket.Conn // The websocket connection
 	connectionLock           *sync.Mutex     // Lock for the connection
-	stopChannel              chan struct{}   // The channel to send to when stopping the connection reviver
+	stopChannel              chan struct{}   // The channel to close when stopping the connection reviver
+	doneChannel              chan struct{}   // The channel closed once the connection reviver has exited
+	lifecycleLock            *sync.Mutex     // Lock for starting and stopping the connection reviver
+	shuttingDown             bool            // Whether new messages are refused because the websocket is shutting down
+	shuttingDownLock         *sync.Mutex     // Lock for the shutting down flag
 	connectionDroppedChannel chan error      // The connection drop channel to listen on for connection failures
+	generation               uint64          // Incremented every time a new connection is established
+	upgradedConnection       *websocket.Conn // The connection for a server-side websocket, until it's started
+	handshakeResponse        *http.Response  // The server's response to the most recent successful handshake
+
+	// State information
+	state        State         // The lifecycle state of the websocket
+	stateLock    *sync.Mutex   // Lock for the state
+	connected    chan struct{} // Closed while the websocket is connected, replaced when the connection drops
+	availability *availability // Tracks connected versus disconnected time
+
+	// Backoff information, only accessed by the reviver
+	backoff        BackoffStrategy // The strategy used to compute the delay between connection attempts
+	backoffAttempt int             // The number of consecutive failed attempts since the backoff was last reset
+	connectedAt    time.Time       // When the current connection was established
+
+	// Failover information, only accessed by the reviver
+	urlIndex     int // The index of the configured URL to dial next
+	dialFailures int // The number of consecutive failed connection attempts
 
 	// Consumer stop information
 	consumerStopChannel chan struct{} // Stop channel for the consumer
 
 	// Sender information
 	sendQueue         *queue        // Queue of messages to send
+	retries           *retries      // Messages waiting out their retry backoff before going back on the queue
 	senderStopChannel chan struct{} // Stop channel for the sender
+	watermarks        *watermarks   // Tracks the send queue depth against the configured watermarks
+	fence             *fence        // Messages queued before a reconnect, held back while epoch fencing
+	bandwidth         *TokenBucket  // Shapes outbound traffic to the bandwidth cap, nil if there's no cap
+	persistence       *persistence  // Durable storage for the send queue, nil if it isn't persistent
+	backlog           *backlog      // Messages queued before a connection, held while the connected handler runs
+
+	// Request information
+	requests *requests // Registry of in-flight requests awaiting a response
+	barriers *requests // Registry of barriers awaiting their echo
+
+	// Login information
+	login *loginState // The login in progress
+
+	// Subscription information
+	subscriptions *subscriptions // Registry of subscription messages replayed on reconnect
+
+	// Reliable delivery information
+	unacked *unacked // Registry of reliable messages awaiting an acknowledgement
+
+	// Session information
+	session *sessionState // Sequence numbers and replay buffer of the resumable session
+
+	// Replay information
+	replayGuard *replayGuard // Tracks the highest inbound sequence seen
+
+	// Statistics information
+	connectionStats *connectionStats // Reconnects, connection timestamps, and the last error
+	inboundExpired  *counter         // The number of inbound messages dropped for exceeding the inbound TTL
+	inboundSampled  *counter         // The number of inbound messages skipped by sampling
+	spillStats      *spillStats      // Inbound messages spilled to disk, pending replay, and lost to corruption
+	inboundSizes    *sizeHistogram   // The distribution of inbound message sizes
+	trafficStats    *trafficStats    // Messages and bytes in both directions for every traffic category
+	pingState       *pingState       // The adaptive ping interval and missed pongs
+	heartbeatState  *heartbeatState  // Whether an application-level heartbeat is waiting for its reply
+	batching        *watermarks      // Whether adaptive batching is batching, based on the send queue depth
+	throughput      *throughput      // Moving averages of the message and byte rates
+	profiler        *profiler        // Measures time and allocations in the sender and dispatcher, when enabled
+	handlerMetrics  *handlerMetrics  // Invocation counts and latencies of every handler, when enabled
+	tracer          Tracer           // Starts spans for dials, sends, and handlers, nil when tracing is disabled
+
+	// Listener information
+	listeners          *listeners          // Functions observing every inbound message, such as bridges and streams
+	messageChannel     *messageChannel     // The channel returned by Messages()
+	lifecycleListeners *lifecycleListeners // Functions observing lifecycle events, such as webhooks
+
+	// Topic information
+	topicStats *topicStats // Traffic statistics for every inbound topic
+	router     *router     // Handlers registered for topic patterns
+	sampler    *sampler    // Sampling policies for inbound messages
+
+	// Channel information
+	channels *channels // Logical channels multiplexed over the connection
+
+	// Handler concurrency information
+	handlerLimiter *handlerLimiter // Cap on the number of message handlers running at once
+
+	// Middleware information
+	inboundMiddleware  *middlewareChain // Middleware applied to every inbound message
+	outboundMiddleware *middlewareChain // Middleware applied to every outbound message
 
 	// Handler information
-	messageHandler          func([]byte) // The websocket handler
-	messageHandlerLock      *sync.Mutex  // Lock for the handler
-	connectedHandler        func()       // The connected handler
-	connectedHandlerLock    *sync.Mutex  // Lock for the connection handler
-	disconnectedHandler     func()       // The disconnected handler
-	disconnectedHandlerLock *sync.Mutex  // Lock for the disconnectedHandler
+	messageHandler            func(int, []byte)          // The websocket handler
+	messageHandlerLock        *sync.Mutex                // Lock for the handler
+	connectedHandler          func()                     // The connected handler
+	connectedHandlerLock      *sync.Mutex                // Lock for the connection handler
+	disconnectedHandler       func()                     // The disconnected handler
+	disconnectedHandlerLock   *sync.Mutex                // Lock for the disconnectedHandler
+	messageDroppedHandler     func([]byte, error)        // The message dropped handler
+	messageDroppedHandlerLock *sync.Mutex                // Lock for the message dropped handler
+	errorHandler              func(error)                // The error handler
+	errorHandlerLock          *sync.Mutex                // Lock for the error handler
+	replayHandler             func([]byte, int64, int64) // The replay handler
+	replayHandlerLock         *sync.Mutex                // Lock for the replay handler
+	reconnectingHandler       func(int, time.Duration)   // The reconnecting handler
+	reconnectingHandlerLock   *sync.Mutex                // Lock for the reconnecting handler
+	reconnectedHandler        func(int)                  // The reconnected handler
+	reconnectedHandlerLock    *sync.Mutex                // Lock for the reconnected handler
+
+	connectionEstablishedHandler     func(ConnectionInfo) // The connection established handler
+	connectionEstablishedHandlerLock *sync.Mutex          // Lock for the connection established handler
+	stateChangeHandler               func(State, State)   // The state change handler
+	stateChangeHandlerLock           *sync.Mutex          // Lock for the state change handler
+
+	disconnectedWithReasonHandler     func(int, string, error) // The disconnected with reason handler
+	disconnectedWithReasonHandlerLock *sync.Mutex              // Lock for the disconnected with reason handler
+
+	queueHighWatermarkHandler     func(int, bool) // The queue high watermark handler
+	queueHighWatermarkHandlerLock *sync.Mutex     // Lock for the queue high watermark handler
+	queueLowWatermarkHandler      func(int, bool) // The queue low watermark handler
+	queueLowWatermarkHandlerLock  *sync.Mutex     // Lock for the queue low watermark handler
+
+	loginFailedHandler     func(error) // The login failed handler
+	loginFailedHandlerLock *sync.Mutex // Lock for the login failed handler
+
+	messageStreamHandler     func(int, io.Reader) // The message stream handler, nil when messages aren't streamed
+	messageStreamHandlerLock *sync.Mutex          // Lock for the message stream handler
+
+	sessionResumedHandler     func(int)   // The session resumed handler
+	sessionResumedHandlerLock *sync.Mutex // Lock for the session resumed handler
+	sessionResetHandler       func()      // The session reset handler
+	sessionResetHandlerLock   *sync.Mutex // Lock for the session reset handler
+
+	terminatedHandler     func(int, string, error) // The terminated handler
+	terminatedHandlerLock *sync.Mutex              // Lock for the terminated handler
+
+	deliveryHandler     func([]byte, *Delivery) // The delivery handler, nil when deliveries go to the message handler
+	deliveryHandlerLock *sync.Mutex             // Lock for the delivery handler
+
+	panicHandler     func(interface{}, []byte) // The panic handler
+	panicHandlerLock *sync.Mutex               // Lock for the panic handler
+
+	fencedHandler     func(uint64, int) // The fenced handler
+	fencedHandlerLock *sync.Mutex       // Lock for the fenced handler
+
+	expiredHandler     func([]byte, time.Duration) // The expired handler
+	expiredHandlerLock *sync.Mutex                 // Lock for the expired handler
+
+	suspendedHandler     func(time.Duration) // The suspended handler
+	suspendedHandlerLock *sync.Mutex         // Lock for the suspended handler
+
+	batchingHandler     func(bool, int) // The batching handler
+	batchingHandlerLock *sync.Mutex     // Lock for the batching handler
 }
 
-// New constructs a new websocket object
+// New constructs a new websocket object. If the send queue is persistent, the messages it still holds are queued again
 func New(configuration *Configuration) *Websocket {
-	return &Websocket{
+	ws := &Websocket{
 		configuration: configuration,
 
 		// Connection information
 		connection:               nil,
 		connectionLock:           &sync.Mutex{},
-		stopChannel:              make(chan struct{}),
+		stopChannel:              nil,
+		doneChannel:              nil,
+		lifecycleLock:            &sync.Mutex{},
+		shuttingDownLock:         &sync.Mutex{},
 		connectionDroppedChannel: nil,
 
+		// Backoff information
+		backoff: configuration.getBackoff(),
+
+		// State information
+		state:        Disconnected,
+		stateLock:    &sync.Mutex{},
+		connected:    make(chan struct{}),
+		availability: newAvailability(configuration.AvailabilityWindow),
+
 		// Consumer stop information
 		consumerStopChannel: nil,
 
 		// Sender information
 		sendQueue:         newQueue(),
+		retries:           newRetries(),
 		senderStopChannel: nil,
+		watermarks:        newWatermarks(configuration.QueueHighWatermark, configuration.QueueLowWatermark),
+		fence:             newFence(),
+		backlog:           newBacklog(),
+		bandwidth:         newBandwidthLimiter(configuration.BandwidthLimit, configuration.BandwidthBurst),
+
+		// Request information
+		requests: newRequests(configuration.IDGenerator),
+		barriers: newRequests(configuration.IDGenerator),
+
+		// Login information
+		login: newLoginState(),
+
+		// Subscription information
+		subscriptions: newSubscriptions(),
+
+		// Reliable delivery information
+		unacked: newUnacked(configuration.IDGenerator),
+
+		// Session information
+		session: newSessionState(configuration.getSessionBufferSize()),
+
+		// Replay information
+		replayGuard: newReplayGuard(),
+
+		// Statistics information
+		connectionStats: newConnectionStats(),
+		inboundExpired:  newCounter(),
+		inboundSampled:  newCounter(),
+		trafficStats:    newTrafficStats(),
+		pingState:       newPingState(configuration.PingInterval),
+		heartbeatState:  newHeartbeatState(),
+		batching:        newWatermarks(configuration.BatchingThreshold, 0),
+		spillStats:      newSpillStats(),
+		inboundSizes:    newSizeHistogram(),
+		throughput:      newThroughput(configuration.getClock().Now()),
+		profiler:        newProfiler(configuration.SelfProfiling, configuration.ProfileInterval),
+		handlerMetrics:  newHandlerMetrics(configuration.HandlerMetrics),
+		tracer:          configuration.tracer(),
+
+		// Listener information
+		listeners:          newListeners(),
+		lifecycleListeners: newLifecycleListeners(),
+		messageChannel:     newMessageChannel(),
+
+		// Topic information
+		topicStats: newTopicStats(configuration.getMaxTrackedTopics(), configuration.getTopTalkersWindow()),
+		router:     newRouter(configuration.TopicSeparator),
+		sampler:    newSampler(configuration.TopicSeparator, configuration.getMaxTrackedTopics()),
+
+		// Channel information
+		channels: newChannels(),
+
+		// Handler concurrency information
+		handlerLimiter: newHandlerLimiter(configuration.MaxConcurrentHandlers, configuration.HandlerOverflowPolicy),
+
+		// Middleware information
+		inboundMiddleware:  newMiddlewareChain(),
+		outboundMiddleware: newMiddlewareChain(),
 
 		// Handler information
-		messageHandler:          func([]byte) {},
-		messageHandlerLock:      &sync.Mutex{},
-		connectedHandler:        func() {},
-		connectedHandlerLock:    &sync.Mutex{},
-		disconnectedHandler:     func() {},
-		disconnectedHandlerLock: &sync.Mutex{},
+		messageHandler:            func(int, []byte) {},
+		messageHandlerLock:        &sync.Mutex{},
+		connectedHandler:          func() {},
+		connectedHandlerLock:      &sync.Mutex{},
+		disconnectedHandler:       func() {},
+		disconnectedHandlerLock:   &sync.Mutex{},
+		messageDroppedHandler:     func([]byte, error) {},
+		messageDroppedHandlerLock: &sync.Mutex{},
+		errorHandler:              func(error) {},
+		errorHandlerLock:          &sync.Mutex{},
+		replayHandler:             func([]byte, int64, int64) {},
+		replayHandlerLock:         &sync.Mutex{},
+		reconnectingHandler:       func(int, time.Duration) {},
+		reconnectingHandlerLock:   &sync.Mutex{},
+		reconnectedHandler:        func(int) {},
+		reconnectedHandlerLock:    &sync.Mutex{},
+
+		connectionEstablishedHandler:     func(ConnectionInfo) {},
+		connectionEstablishedHandlerLock: &sync.Mutex{},
+		stateChangeHandler:               func(State, State) {},
+		stateChangeHandlerLock:           &sync.Mutex{},
+
+		disconnectedWithReasonHandler:     func(int, string, error) {},
+		disconnectedWithReasonHandlerLock: &sync.Mutex{},
+
+		queueHighWatermarkHandler:     func(int, bool) {},
+		queueHighWatermarkHandlerLock: &sync.Mutex{},
+		queueLowWatermarkHandler:      func(int, bool) {},
+		queueLowWatermarkHandlerLock:  &sync.Mutex{},
+
+		loginFailedHandler:     func(error) {},
+		loginFailedHandlerLock: &sync.Mutex{},
+
+		messageStreamHandlerLock: &sync.Mutex{},
+
+		sessionResumedHandler:     func(int) {},
+		sessionResumedHandlerLock: &sync.Mutex{},
+		sessionResetHandler:       func() {},
+		sessionResetHandlerLock:   &sync.Mutex{},
+
+		terminatedHandler:     func(int, string, error) {},
+		terminatedHandlerLock: &sync.Mutex{},
+
+		deliveryHandlerLock: &sync.Mutex{},
+
+		panicHandler:     func(interface{}, []byte) {},
+		panicHandlerLock: &sync.Mutex{},
+
+		fencedHandler:     func(uint64, int) {},
+		fencedHandlerLock: &sync.Mutex{},
+
+		expiredHandler:     func([]byte, time.Duration) {},
+		expiredHandlerLock: &sync.Mutex{},
+
+		suspendedHandler:     func(time.Duration) {},
+		suspendedHandlerLock: &sync.Mutex{},
+
+		batchingHandler:     func(bool, int) {},
+		batchingHandlerLock: &sync.Mutex{},
 	}
+
+	ws.restoreQueue()
+	return ws
 }
 
-// Connect connects the websocket
+// Connect connects the websocket. For server-side websockets returned by Upgrade(), it starts processing messages on
+// the upgraded connection instead. Returns ErrAlreadyStarted if the websocket is already running. A websocket that was
+// disconnected, or gave up reconnecting, can be connected again, which starts a fresh reviver once the previous one
+// has finished cleaning up
 func (ws *Websocket) Connect() error {
+	ws.lifecycleLock.Lock()
+
+	// Refuse to start a second reviver while one is running. If the current one is stopping, wait for it to finish
+	// without holding the lock, since its handlers may still send or disconnect
+	for ws.doneChannel != nil && !isClosed(ws.doneChannel) {
+		if !isClosed(ws.stopChannel) {
+			ws.lifecycleLock.Unlock()
+			return ErrAlreadyStarted
+		}
+
+		doneChannel := ws.doneChannel
+		ws.lifecycleLock.Unlock()
+		<-doneChannel
+		ws.lifecycleLock.Lock()
+	}
+
+	stopChannel := make(chan struct{})
+	doneChannel := make(chan struct{})
+	ws.stopChannel = stopChannel
+	ws.doneChannel = doneChannel
+	ws.setShuttingDown(false)
+
+	if ws.upgradedConnection != nil {
+		go ws.server(stopChannel, doneChannel)
+		ws.lifecycleLock.Unlock()
+		return nil
+	}
+
+	ws.setState(Connecting)
 	initialConnectionErrorChannel := make(chan error)
 
-	// Start up the reviver
-	go ws.reviver(initialConnectionErrorChannel)
+	// Start up the reviver, releasing the lock before waiting on it so the initial connection can be disconnected
+	go ws.reviver(stopChannel, doneChannel, initialConnectionErrorChannel)
+	ws.lifecycleLock.Unlock()
 
 	return <-initialConnectionErrorChannel
 }
 
-// Send sends a binary message with the provided body
+// Send sends a message with the provided body, as a binary message unless another default message type is configured
 func (ws *Websocket) Send(msg []byte) {
-	ws.sendQueue.push(msg)
+	_ = ws.send(ws.configuration.getDefaultMessageType(), msg)
+}
+
+// SendText sends a text message with the provided body
+func (ws *Websocket) SendText(msg string) {
+	_ = ws.send(TextMessage, []byte(msg))
+}
+
+// SendType sends a message with the provided frame type (TextMessage or BinaryMessage) and body
+func (ws *Websocket) SendType(messageType int, msg []byte) {
+	_ = ws.send(messageType, msg)
+}
+
+// SendErr sends a message of the default message type with the provided body, returning an error instead of silently
+// dropping the message if it's denied by the audit hook, the queue is full, or fail-fast mode is enabled and the
+// websocket isn't connected
+func (ws *Websocket) SendErr(msg []byte) error {
+	return ws.send(ws.configuration.getDefaultMessageType(), msg)
+}
+
+// send audits the message and pushes it onto the send queue. Messages that can't be queued are reported to the message
+// dropped handler, and the reason is returned
+func (ws *Websocket) send(messageType int, msg []byte) error {
+	return ws.sendMessage(messageType, msg, nil)
+}
+
+// sendMessage audits the message, builds it with the approved payload, and pushes it onto the send queue. Every send
+// variant goes through here, setting its own fields on the message with the configure function (if any) before it's
+// queued. Messages that are denied or can't be queued are reported to the message dropped handler, and the reason is
+// returned
+func (ws *Websocket) sendMessage(messageType int, msg []byte, configure func(*message)) error {
+	approved, err := ws.audit(msg)
+	if err != nil {
+		ws.dropMessage(msg, err)
+		return err
+	}
+
+	queued := newMessage(messageType, approved)
+	if configure != nil {
+		configure(queued)
+	}
+	return ws.enqueue(queued)
+}
+
+// enqueue pushes an audited message onto the send queue, storing it first if the queue is persistent. Reports it to the
+// message dropped handler if a shutdown, the message size limit, fail-fast mode, or the queue limit prevents it from
+// being queued
+func (ws *Websocket) enqueue(msg *message) error {
+	msg.epoch = ws.getGeneration()
+	if msg.queuedAt.IsZero() {
+		msg.queuedAt = ws.now()
+	}
+
+	var err error
+	if ws.isShuttingDown() {
+		err = ErrShuttingDown
+	} else if ws.configuration.tooLarge(int64(len(msg.data))) {
+		err = ws.configuration.messageTooLarge(int64(len(msg.data)))
+	} else if ws.configuration.FailFast && !ws.IsConnected() {
+		err = ErrNotConnected
+	} else {
+		ws.persist(msg)
+		if !ws.sendQueue.offer(msg, ws.configuration.MaxQueueSize) {
+			ws.unpersist(msg)
+			err = ErrQueueFull
+		}
+	}
+
+	if err != nil {
+		ws.dropMessage(msg.data, err)
+		return err
+	}
+
+	ws.checkWatermarks()
+	return nil
 }
 
 // OnConnected sets the onConnected handler
@@ -83,6 +457,14 @@ func (ws *Websocket) OnConnected(handler func()) {
 
 // OnMessage sets the onMessage handler
 func (ws *Websocket) OnMessage(handler func([]byte)) {
+	ws.OnTypedMessage(func(_ int, msg []byte) {
+		handler(msg)
+	})
+}
+
+// OnTypedMessage sets the onMessage handler, passing the received frame type (TextMessage or BinaryMessage) along with
+// the message
+func (ws *Websocket) OnTypedMessage(handler func(messageType int, msg []byte)) {
 	ws.messageHandlerLock.Lock()
 	ws.messageHandler = handler
 	ws.messageHandlerLock.Unlock()
@@ -95,6 +477,63 @@ func (ws *Websocket) OnDisconnected(handler func()) {
 	ws.disconnectedHandlerLock.Unlock()
 }
 
+// OnDisconnectedWithReason sets the onDisconnectedWithReason handler, called after the onDisconnected handler with the
+// close code and message sent by the peer, along with the error that caused the drop. Deliberate disconnects report
+// a normal closure and a nil error, and drops without a close frame report an abnormal closure (1006)
+func (ws *Websocket) OnDisconnectedWithReason(handler func(code int, message string, err error)) {
+	ws.disconnectedWithReasonHandlerLock.Lock()
+	ws.disconnectedWithReasonHandler = handler
+	ws.disconnectedWithReasonHandlerLock.Unlock()
+}
+
+// OnMessageDropped sets the onMessageDropped handler, called with the reason whenever an outbound message is discarded
+// instead of being sent
+func (ws *Websocket) OnMessageDropped(handler func([]byte, error)) {
+	ws.messageDroppedHandlerLock.Lock()
+	ws.messageDroppedHandler = handler
+	ws.messageDroppedHandlerLock.Unlock()
+}
+
+// OnError sets the onError handler, called with internal failures such as dial errors, read failures, and write
+// timeouts
+func (ws *Websocket) OnError(handler func(error)) {
+	ws.errorHandlerLock.Lock()
+	ws.errorHandler = handler
+	ws.errorHandlerLock.Unlock()
+}
+
+// OnReplay sets the onReplay handler, called with the offending sequence and the highest sequence seen so far whenever
+// an inbound message fails replay validation
+func (ws *Websocket) OnReplay(handler func(msg []byte, sequence int64, last int64)) {
+	ws.replayHandlerLock.Lock()
+	ws.replayHandler = handler
+	ws.replayHandlerLock.Unlock()
+}
+
+// OnReconnecting sets the onReconnecting handler, called by the reviver before every reconnect attempt with the
+// attempt number (starting at 1) and how long it will wait before making it
+func (ws *Websocket) OnReconnecting(handler func(attempt int, nextDelay time.Duration)) {
+	ws.reconnectingHandlerLock.Lock()
+	ws.reconnectingHandler = handler
+	ws.reconnectingHandlerLock.Unlock()
+}
+
+// OnReconnected sets the onReconnected handler, called by the reviver after a dropped connection is re-established
+// with the number of attempts it took. Unlike the onConnected handler, it is not called for the initial connection
+func (ws *Websocket) OnReconnected(handler func(attempt int)) {
+	ws.reconnectedHandlerLock.Lock()
+	ws.reconnectedHandler = handler
+	ws.reconnectedHandlerLock.Unlock()
+}
+
+// OnConnectionEstablished sets the onConnectionEstablished handler, called after every successful connection with
+// metadata distinguishing the initial connection from reconnects
+func (ws *Websocket) OnConnectionEstablished(handler func(ConnectionInfo)) {
+	ws.connectionEstablishedHandlerLock.Lock()
+	ws.connectionEstablishedHandler = handler
+	ws.connectionEstablishedHandlerLock.Unlock()
+}
+
 // IsConnected determines if the socket is currently connected
 func (ws *Websocket) IsConnected() bool {
 	return ws.getConnection() != nil
@@ -105,14 +544,38 @@ func (ws *Websocket) BlockSend() {
 	ws.sendQueue.pause()
 }
 
+// BlockSendExcept blocks message sending until UnblockSend() is called, except for messages the allow function lets
+// through, such as login, auth, or resubscribe frames. Allowed messages are sent in order, ahead of the blocked ones
+func (ws *Websocket) BlockSendExcept(allow func(msg []byte) bool) {
+	ws.sendQueue.pauseExcept(allow)
+}
+
 // UnblockSend stops blocking message sending
 func (ws *Websocket) UnblockSend() {
 	ws.sendQueue.resume()
 }
 
-// Disconnect disconnects the websocket
+// Disconnect disconnects the websocket, stopping any reconnect attempts in progress. It's safe to call more than
+// once, and the websocket can be connected again afterwards
 func (ws *Websocket) Disconnect() {
-	if ws.getConnection() != nil {
-		close(ws.stopChannel)
+	ws.lifecycleLock.Lock()
+	defer ws.lifecycleLock.Unlock()
+
+	// Nothing to do if the websocket was never started, is already stopping, or has stopped by itself
+	if ws.doneChannel == nil || isClosed(ws.doneChannel) || isClosed(ws.stopChannel) {
+		return
+	}
+
+	ws.setState(Closing)
+	close(ws.stopChannel)
+}
+
+// isClosed determines if the supplied channel is closed
+func isClosed(channel chan struct{}) bool {
+	select {
+	case <-channel:
+		return true
+	default:
+		return false
 	}
 }
@@ -0,0 +1,25 @@
+package gows
+
+import (
+	"errors"
+	"time"
+)
+
+// SendWindowPolicy defines what the sender does with queued messages while the send window is closed
+type SendWindowPolicy int
+
+const (
+	// SendWindowWait holds messages in the queue until the send window opens again
+	SendWindowWait SendWindowPolicy = iota
+
+	// SendWindowDrop discards messages that would be sent while the send window is closed
+	SendWindowDrop
+)
+
+// errSendWindowClosed is the reason reported for messages dropped outside the send window
+var errSendWindowClosed = errors.New("message dropped outside the send window")
+
+// sendWindowOpen determines if the configured send window allows transmitting at the supplied time
+func (c *Configuration) sendWindowOpen(now time.Time) bool {
+	return c.SendWindow == nil || c.SendWindow(now)
+}
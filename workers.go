@@ -0,0 +1,54 @@
+package gows
+
+import "sync"
+
+// workerPool defines a fixed set of goroutines that run message handlers. Submitting blocks while every worker is busy,
+// which pushes back on the dispatcher and, through the inbound buffer, the read loop
+type workerPool struct {
+	jobs chan func()
+	wait *sync.WaitGroup
+}
+
+// newWorkerPool constructs a new worker pool and starts its workers
+func newWorkerPool(size int) *workerPool {
+	pool := &workerPool{
+		jobs: make(chan func()),
+		wait: &sync.WaitGroup{},
+	}
+
+	pool.wait.Add(size)
+	for i := 0; i < size; i++ {
+		go pool.worker()
+	}
+
+	return pool
+}
+
+// worker runs handlers until the pool is stopped
+func (p *workerPool) worker() {
+	defer p.wait.Done()
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// submit hands a handler to the next free worker, blocking until one is available
+func (p *workerPool) submit(job func()) {
+	p.jobs <- job
+}
+
+// stop stops the workers once they've finished whatever they're running
+func (p *workerPool) stop() {
+	close(p.jobs)
+	p.wait.Wait()
+}
+
+// getHandlerConcurrency gets the number of workers running message handlers, zero meaning handlers aren't run on a
+// worker pool
+func (c *Configuration) getHandlerConcurrency() int {
+	if c.OrderedDelivery {
+		return 1
+	}
+
+	return c.HandlerConcurrency
+}